@@ -39,11 +39,21 @@ type GetListOptions struct {
 	Orderby []string
 	Offset  int
 	Limit   int
+	// continue token of the previous page
+	Continue string
+
+	// for output the continue token of the next page, e.g. orm.WithContinue(&opts.Next)
+	Next string
 
 	// for output count(*)
 	Total *int
 }
 
+// ListMeta returns the ListMeta of the list response with the continue token of the next page
+func (p *GetListOptions) ListMeta() ListMeta {
+	return ListMeta{Continue: p.Next}
+}
+
 type PageParams struct {
 	Offset   int    `param:"query,hidden" description:"offset, priority is more than currentPage"`
 	Limit    int    `param:"query,hidden" description:"limit, priority is more than pageSize"`
@@ -52,6 +62,7 @@ type PageParams struct {
 	Sorter   string `param:"query" description:"column name"`
 	Order    string `param:"query" description:"asc(default)/desc" enum:"asc|desc"`
 	Dump     bool   `param:"query,hidden" description:""`
+	Continue string `param:"query" description:"continue token returned by the previous page, the offset is ignored if set"`
 }
 
 // TODO: validate query
@@ -62,11 +73,12 @@ func (p PageParams) GetListOptions(query string, total *int, orders ...string) (
 			sqlOrder(p.Order)}, orders...)
 	}
 	return &GetListOptions{
-		Query:   strings.Trim(query, ","),
-		Offset:  offset,
-		Limit:   limit,
-		Total:   total,
-		Orderby: orders,
+		Query:    strings.Trim(query, ","),
+		Offset:   offset,
+		Limit:    limit,
+		Continue: p.Continue,
+		Total:    total,
+		Orderby:  orders,
 	}, nil
 }
 
@@ -99,6 +111,11 @@ func (p *PageParams) OffsetLimit() (offset, limit int) {
 		limit = maxLimitPage
 	}
 
+	// the rows are located by the continue token
+	if p.Continue != "" {
+		return 0, limit
+	}
+
 	offset = p.Offset
 
 	if offset <= 0 {
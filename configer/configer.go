@@ -1,16 +1,21 @@
 // the configer is not thread safe,
 // make sure not use it after call process.Start()
+// except the getters of the ParsedConfiger, which are safe with Reload() and Watch()
 package configer
 
 // ## value priority(desc order):
 //  - WithOverrideYaml(), WithOverride()
+//  - WithSource(AfterFlags)
 //  - flag (os.Args)
 //    - args flag
 //    - fileValues (--set-file)
 //    - value (--set, --set-string)
+//    - WithSource(AfterFiles)
 //    - valueFile (--values, -f)
 //  - default
+//    - WithSource(AfterEnv)
 //    - RegisterConfigFields.sample.field.tags.env
+//    - WithSource(AfterDefault)
 //    - WithDefaultYaml(), WithDefault()
 //    - RegisterConfigFields.WithTags(tags.default)
 //    - RegisterConfigFields.sample.field.value
@@ -34,16 +39,20 @@ import (
 var (
 	DEBUG           = false
 	DefaultConfiger = New()
+
+	// ErrExplain is returned by Parse with the parsed configer when --config-explain is set,
+	// the caller prints the ParsedConfiger.ExplainString() and exits
+	ErrExplain = errors.New("config explain requested")
 )
 
 type Configer interface {
 	// Var: set config fields to yaml configfile reader and pflags.FlagSet from sample
 	Var(fs *pflag.FlagSet, path string, sample interface{}, opts ...ConfigFieldsOption) error
-	// Parse
+	// Parse, returns ErrExplain with the parsed configer when --config-explain is set
 	Parse(opts ...ConfigerOption) (ParsedConfiger, error)
-	// MustParse
+	// MustParse, panics with ErrExplain when --config-explain is set
 	MustParse(opts ...ConfigerOption) ParsedConfiger
-	// AddFlags: add configer flags to *pflag.FlagSet, like -f, --set, --set-string, --set-file
+	// AddFlags: add configer flags to *pflag.FlagSet, like -f, --set, --set-string, --set-file, --config-explain
 	AddFlags(fs *pflag.FlagSet)
 	// ValueFiles: return files list, which set by --set-file
 	ValueFiles() []string
@@ -51,6 +60,8 @@ type Configer interface {
 	Envs() []string
 	// Envs: return flags list
 	Flags() []string
+	// Schema: return the json schema of the registered fields
+	Schema() *Schema
 }
 
 func New() Configer {
@@ -72,7 +83,7 @@ func MustParse(opts ...ConfigerOption) ParsedConfiger {
 	return DefaultConfiger.MustParse(opts...)
 }
 
-// AddFlags: add configer flags to *pflag.FlagSet, like -f, --set, --set-string, --set-file
+// AddFlags: add configer flags to *pflag.FlagSet, like -f, --set, --set-string, --set-file, --config-explain
 func AddFlags(fs *pflag.FlagSet) {
 	DefaultConfiger.AddFlags(fs)
 }
@@ -100,12 +111,14 @@ func Flags() []string {
 var _ Configer = new(configer)
 
 func newConfiger() *configer {
-	return &configer{
+	p := &configer{
 		ConfigerOptions: newConfigerOptions(),
 		data:            map[string]interface{}{},
-		env:             map[string]interface{}{},
 		path:            []string{},
 	}
+	p.reloader = &reloader{root: p}
+
+	return p
 }
 
 type configer struct {
@@ -115,12 +128,20 @@ type configer struct {
 	values       []string       // values, --set servers[0].port=80
 	stringValues []string       // values, --set-string servers[0].name=007
 	fileValues   []string       // values from file, --set-file=rsaPubData=/etc/ssh/ssh_host_rsa_key.pub
+	explain      bool           // return ErrExplain from Parse, --config-explain
 	fields       []*configField // all of config fields
+	samples      []configSample // the samples of Var(), used to validate the reloaded config
 
-	data   map[string]interface{}
-	env    map[string]interface{}
-	path   []string
-	parsed bool
+	data     map[string]interface{}
+	origins  origins // the origins of the leaf values in data
+	path     []string
+	parsed   bool
+	reloader *reloader // shared with the configers from GetConfiger
+}
+
+type configSample struct {
+	path string
+	typ  reflect.Type
 }
 
 func (p *configer) Path(names ...string) (ret *field.Path) {
@@ -160,12 +181,13 @@ func (p *configer) Flags() (names []string) {
 	return
 }
 
-// AddFlags: add configer flags to *pflag.FlagSet, like -f, --set, --set-string, --set-file
+// AddFlags: add configer flags to *pflag.FlagSet, like -f, --set, --set-string, --set-file, --config-explain
 func (p *configer) AddFlags(f *pflag.FlagSet) {
 	f.StringSliceVarP(&p.valueFiles, "values", "f", p.valueFiles, "specify values in a YAML file or a URL (can specify multiple)")
 	f.StringArrayVar(&p.values, "set", p.values, "set values on the command line (can specify multiple or separate values with commas: key1=val1,key2=val2)")
 	f.StringArrayVar(&p.stringValues, "set-string", p.stringValues, "set STRING values on the command line (can specify multiple or separate values with commas: key1=val1,key2=val2)")
 	f.StringArrayVar(&p.fileValues, "set-file", p.fileValues, "set values from respective files specified via the command line (can specify multiple or separate values with commas: key1=path1,key2=path2)")
+	f.BoolVar(&p.explain, "config-explain", p.explain, "print the config with the source of each value and exit")
 }
 
 // Var: set config fields to yaml configfile reader and pflags.FlagSet from sample
@@ -206,6 +228,8 @@ func (p *configer) Var(fs *pflag.FlagSet, path string, sample interface{}, opts
 		return err
 	}
 
+	p.samples = append(p.samples, configSample{path: path, typ: rt})
+
 	return nil
 }
 
@@ -239,6 +263,7 @@ func (p *configer) setVar(path []string, fs *pflag.FlagSet, sampleRv reflect.Val
 
 		// env
 		ps := joinPath(curPath...)
+		schemaTag := *tag // before the default is changed by the env or override
 		def := opt.getDefaultValue(ps, tag, p.ConfigerOptions)
 		var field *configField
 
@@ -307,6 +332,9 @@ func (p *configer) setVar(path []string, fs *pflag.FlagSet, sampleRv reflect.Val
 			}
 
 		}
+		sample, _ := Values(opt.defaultValues).PathValue(ps)
+		field.schema = newFieldSchema(rt, &schemaTag, sample)
+		field.typ = rt
 		p.fields = append(p.fields, field)
 	}
 	return nil
@@ -340,20 +368,67 @@ func (p *configer) Parse(opts ...ConfigerOption) (ParsedConfiger, error) {
 		return nil, err
 	}
 
-	return &parsedConfiger{p}, nil
+	pc := &parsedConfiger{p}
+	if p.explain {
+		return pc, ErrExplain
+	}
+
+	return pc, nil
+}
+
+func (p *configer) parse() error {
+	base, origins, err := p.merge()
+	if err != nil {
+		return err
+	}
+
+	p.data = base
+	p.origins = origins
+	p.parsed = true
+	return nil
 }
 
-func (p *configer) parse() (err error) {
-	base := map[string]interface{}{}
+// merge returns a new config tree from all of the sources, and records where the values came from,
+// the sources are cloned, so it can be called again by Reload()
+func (p *configer) merge() (map[string]interface{}, origins, error) {
+	srcs := origins{}
 
 	// merge default from RegisterConfigFields.sample
-	base = mergePathFields(base, p.path, p.fields)
+	base := cloneValues(mergePathFields(map[string]interface{}{}, p.path, p.fields))
+	srcs.set("", base, Origin{Type: OriginDefault})
 
 	// merge WithDefault values
-	base = mergeValues(base, p.defaultValues)
+	base = mergeValues(base, cloneValues(p.defaultValues))
+	srcs.set("", p.defaultValues, Origin{Type: OriginWithDefault})
+
+	base, err := p.mergeSources(base, srcs, AfterDefault)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// merge env from RegisterConfigFields.sample, it's read again by Reload()
+	if p.enableEnv {
+		env, _ := p.envValues(osEnv{})
+		if err := p.convertValues(env); err != nil {
+			return nil, nil, fmt.Errorf("failed to read env: %s", err)
+		}
+		base = mergeValues(base, env)
+		for _, f := range p.fields {
+			path := joinPath(append(p.path, f.configPath)...)
+			if _, err := Values(env).PathValue(path); err == nil && f.envName != "" {
+				srcs[path] = Origin{Type: OriginEnv, Name: f.envName}
+			}
+		}
+	}
+
+	if base, err = p.mergeSources(base, srcs, AfterEnv); err != nil {
+		return nil, nil, err
+	}
 
-	// merge env from RegisterConfigFields.sample
-	base = mergeValues(base, p.env)
+	var schema *Schema
+	if p.strict {
+		schema = p.Schema()
+	}
 
 	// configFile & valueFile --values
 	for _, filePath := range append(p.valueFiles, p.filesOverride...) {
@@ -361,28 +436,44 @@ func (p *configer) parse() (err error) {
 
 		bytes, err := template.ParseTemplateFile(nil, filePath)
 		if err != nil {
-			return err
+			return nil, nil, err
 		}
 
 		if err := yaml.Unmarshal(bytes, &m); err != nil {
-			return fmt.Errorf("failed to parse %s: %s", filePath, err)
+			return nil, nil, fmt.Errorf("failed to parse %s: %s", filePath, err)
+		}
+
+		if schema != nil {
+			known := mergeValues(cloneValues(p.defaultValues), cloneValues(p.overrideValues))
+			if errs := unknownFields(m, schema, known, nil, "unknown field in "+filePath); len(errs) > 0 {
+				return nil, nil, errs.ToAggregate()
+			}
 		}
 		// Merge with the previous map
 		base = mergeValues(base, m)
+		srcs.setFile(m, filePath, bytes)
+	}
+
+	if base, err = p.mergeSources(base, srcs, AfterFiles); err != nil {
+		return nil, nil, err
 	}
 
 	// User specified a value via --set
 	for _, value := range p.values {
 		if err := strvals.ParseInto(value, base); err != nil {
-			return fmt.Errorf("failed parsing --set data: %s", err)
+			return nil, nil, fmt.Errorf("failed parsing --set data: %s", err)
 		}
+		m, _ := strvals.Parse(value)
+		srcs.set("", m, Origin{Type: OriginSet, Name: value})
 	}
 
 	// User specified a value via --set-string
 	for _, value := range p.stringValues {
 		if err := strvals.ParseIntoString(value, base); err != nil {
-			return fmt.Errorf("failed parsing --set-string data: %s", err)
+			return nil, nil, fmt.Errorf("failed parsing --set-string data: %s", err)
 		}
+		m, _ := strvals.ParseString(value)
+		srcs.set("", m, Origin{Type: OriginSetString, Name: value})
 		dlog("config load", "filepath(string)", value)
 	}
 
@@ -393,26 +484,40 @@ func (p *configer) parse() (err error) {
 			return string(bytes), err
 		}
 		if err := strvals.ParseIntoFile(value, base, reader); err != nil {
-			return fmt.Errorf("failed parsing --set-file data: %s", err)
+			return nil, nil, fmt.Errorf("failed parsing --set-file data: %s", err)
 		}
+		m, _ := strvals.ParseFile(value, func(rs []rune) (interface{}, error) { return string(rs), nil })
+		srcs.set("", m, Origin{Type: OriginSetFile, Name: value})
 	}
 
-	base = p.mergeFlagValues(base)
+	base = p.mergeFlagValues(base, srcs)
+
+	if base, err = p.mergeSources(base, srcs, AfterFlags); err != nil {
+		return nil, nil, err
+	}
 
 	// override
-	base = mergeValues(base, p.overrideValues)
+	base = mergeValues(base, cloneValues(p.overrideValues))
+	srcs.set("", p.overrideValues, Origin{Type: OriginOverride})
 
-	p.data = base
-	p.parsed = true
-	return nil
+	// ${secret:name}
+	if p.secretResolver != nil {
+		if err := resolveSecrets(base, p.secretResolver, srcs, nil); err != nil {
+			return nil, nil, fmt.Errorf("failed to resolve secret: %s", err)
+		}
+	}
+
+	return base, srcs, nil
 }
 
 // merge flag value into ${into}
-func (p *configer) mergeFlagValues(into map[string]interface{}) map[string]interface{} {
+func (p *configer) mergeFlagValues(into map[string]interface{}, srcs origins) map[string]interface{} {
 	for _, f := range p.fields {
 		if v := f.getFlagValue(); v != nil {
-			dlog("flag", "path", joinPath(append(p.path, f.configPath)...), "value", v)
-			mergeValues(into, pathValueToValues(joinPath(append(p.path, f.configPath)...), v))
+			path := joinPath(append(p.path, f.configPath)...)
+			dlog("flag", "path", path, "value", v)
+			mergeValues(into, pathValueToValues(path, v))
+			srcs.set(path, v, Origin{Type: OriginFlag, Name: "--" + f.flag})
 		}
 	}
 
@@ -15,6 +15,10 @@ type ConfigerOptions struct {
 	maxDepth       int
 	enableEnv      bool
 	allowEmptyEnv  bool
+	onReloadError  func(error)                 // WithReloadErrorHandler()
+	strict         bool                        // WithStrict()
+	sources        map[SourcePosition][]Source // WithSource()
+	secretResolver SecretResolver              // WithSecretResolver()
 	err            error
 	//enableFlag     bool
 	//flagSet       *pflag.FlagSet
@@ -87,6 +91,22 @@ func WithMaxDepth(maxDepth int) ConfigerOption {
 	}
 }
 
+// WithStrict rejects the keys in the value files which are not registered by Var(),
+// WithDefault() or WithOverride()
+func WithStrict() ConfigerOption {
+	return func(p *ConfigerOptions) {
+		p.strict = true
+	}
+}
+
+// WithReloadErrorHandler set the handler of the failed reload by Watch(),
+// the old config is kept and the error is logged by default
+func WithReloadErrorHandler(fn func(error)) ConfigerOption {
+	return func(p *ConfigerOptions) {
+		p.onReloadError = fn
+	}
+}
+
 // ############# config fields
 
 func newConfigFieldsOptions(c *configer) *configFieldsOptions {
@@ -123,6 +143,9 @@ func (p *configFieldsOptions) getTagOpts(sf reflect.StructField, paths []string)
 		if len(o.Env) > 0 {
 			tag.Env = o.Env
 		}
+		if len(o.Enum) > 0 {
+			tag.Enum = o.Enum
+		}
 	}
 
 	return tag
@@ -144,7 +167,6 @@ func (p *configFieldsOptions) getDefaultValue(path string, tag *FieldTag, opts *
 		if def, ok := p.getEnv(tag.Env); ok {
 			if len(def) > 0 {
 				tag.Default = def
-				p.env = mergePathValue(p.env, path, def)
 				return def
 			}
 		}
@@ -0,0 +1,166 @@
+package configer
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	yaml3 "gopkg.in/yaml.v3"
+)
+
+// OriginType is the layer of the config merge, see the value priority in configer.go
+type OriginType string
+
+const (
+	OriginDefault     OriginType = "default"      // the sample value or the tag default of Var()
+	OriginWithDefault OriginType = "WithDefault"  // WithDefault(), WithDefaultYaml()
+	OriginEnv         OriginType = "env"          // the tag env of Var()
+	OriginFile        OriginType = "file"         // --values, WithValueFile()
+	OriginSet         OriginType = "--set"        // --set
+	OriginSetString   OriginType = "--set-string" // --set-string
+	OriginSetFile     OriginType = "--set-file"   // --set-file
+	OriginFlag        OriginType = "flag"         // the tag flag of Var()
+	OriginOverride    OriginType = "override"     // WithOverride(), WithOverrideYaml()
+	OriginSource      OriginType = "source"       // WithSource()
+)
+
+// Origin is where the value came from
+type Origin struct {
+	Type   OriginType
+	Name   string // env name, file path, flag name, the value of --set or the name of the source
+	Line   int    // the line in the file
+	Secret bool   // the value has the resolved ${secret:name}
+}
+
+func (p Origin) String() string {
+	var s string
+	switch {
+	case p.Type == "":
+		s = "unknown"
+	case p.Type == OriginFile && p.Line > 0:
+		s = fmt.Sprintf("%s %s:%d", p.Type, p.Name, p.Line)
+	case p.Name != "":
+		s = fmt.Sprintf("%s %s", p.Type, p.Name)
+	default:
+		s = string(p.Type)
+	}
+
+	if p.Secret {
+		s += " (secret)"
+	}
+	return s
+}
+
+// ExplainedValue is the leaf value of the config with its source
+type ExplainedValue struct {
+	Path   string
+	Value  interface{}
+	Origin Origin
+}
+
+// origins records the source of the leaf values, the later layer overwrites the earlier one
+type origins map[string]Origin
+
+func (p origins) set(path string, values interface{}, src Origin) {
+	walkLeaves(values, parsePath(path), func(path []string, _ interface{}) {
+		p[joinPath(path...)] = src
+	})
+}
+
+// setFile records the values of the file with the lines of the keys
+func (p origins) setFile(values map[string]interface{}, file string, data []byte) {
+	lines := map[string]int{}
+	var node yaml3.Node
+	if err := yaml3.Unmarshal(data, &node); err == nil {
+		yamlLines(&node, nil, lines)
+	}
+
+	walkLeaves(values, nil, func(path []string, _ interface{}) {
+		key := joinPath(path...)
+		p[key] = Origin{Type: OriginFile, Name: file, Line: lines[key]}
+	})
+}
+
+// yamlLines records the line of the key of each mapping entry
+func yamlLines(node *yaml3.Node, path []string, lines map[string]int) {
+	switch node.Kind {
+	case yaml3.DocumentNode:
+		for _, n := range node.Content {
+			yamlLines(n, path, lines)
+		}
+	case yaml3.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			cur := append(clonePath(path), node.Content[i].Value)
+			lines[joinPath(cur...)] = node.Content[i].Line
+			yamlLines(node.Content[i+1], cur, lines)
+		}
+	}
+}
+
+// walkLeaves calls fn with the values which are not a map or an empty map
+func walkLeaves(v interface{}, path []string, fn func(path []string, v interface{})) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		if values, isValues := v.(Values); isValues {
+			m, ok = values, true
+		}
+	}
+
+	if !ok || len(m) == 0 {
+		fn(path, v)
+		return
+	}
+
+	for k, v := range m {
+		walkLeaves(v, append(clonePath(path), k), fn)
+	}
+}
+
+// Explain returns the leaf values under the path with their origins, ordered by the path
+func (p *parsedConfiger) Explain(path string) ([]ExplainedValue, error) {
+	data, origins := p.getOrigins()
+
+	v, err := rawValue(data, path)
+	if err != nil {
+		return nil, err
+	}
+
+	var ret []ExplainedValue
+	walkLeaves(v, parsePath(path), func(path []string, v interface{}) {
+		if len(path) == 0 {
+			return
+		}
+		ret = append(ret, ExplainedValue{
+			Path:   joinPath(path...),
+			Value:  v,
+			Origin: origins[joinPath(append(clonePath(p.path), path...)...)],
+		})
+	})
+
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Path < ret[j].Path })
+
+	return ret, nil
+}
+
+// ExplainString returns the config with the source of each value, one value per line
+func (p *parsedConfiger) ExplainString() string {
+	values, err := p.Explain("")
+	if err != nil {
+		return err.Error()
+	}
+
+	var b strings.Builder
+	for _, v := range values {
+		value, err := json.Marshal(v.Value)
+		if err != nil {
+			value = []byte(fmt.Sprintf("%q", fmt.Sprint(v.Value)))
+		}
+		if v.Origin.Secret {
+			value = []byte(`"******"`)
+		}
+		fmt.Fprintf(&b, "%s: %s # %s\n", v.Path, value, v.Origin)
+	}
+
+	return b.String()
+}
@@ -0,0 +1,129 @@
+package configer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExplain(t *testing.T) {
+	dir := createTestDir([]templateFile{
+		{"conf.yml", "server:\n  name: file\n  tags: [a, b]\n  tls:\n    cert: /a.crt\n"},
+		{"cert.pem", "pem"},
+	})
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "conf.yml")
+
+	t.Setenv("TEST_EXPLAIN_ADDR", "127.0.0.1")
+
+	type config struct {
+		Name  string   `json:"name" default:"def"`
+		Port  int      `json:"port" flag:"port" default:"80"`
+		Addr  string   `json:"addr" env:"TEST_EXPLAIN_ADDR"`
+		Tags  []string `json:"tags"`
+		Debug bool     `json:"debug"`
+		Level string   `json:"level"`
+		Key   string   `json:"key"`
+		Host  string   `json:"host" default:"localhost"`
+	}
+
+	c := New()
+	fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	c.AddFlags(fs)
+	require.NoError(t, c.Var(fs, "server", &config{}))
+	require.NoError(t, fs.Parse([]string{
+		"-f", file,
+		"--port=8080",
+		"--set", "server.debug=true",
+		"--set-string", "server.level=1",
+		"--set-file", "server.key=" + filepath.Join(dir, "cert.pem"),
+	}))
+
+	cf, err := c.Parse(
+		WithDefaultYaml("server", "timeout: 5s"),
+		WithOverrideYaml("server", "host: example.com"),
+	)
+	require.NoError(t, err)
+
+	got, err := cf.Explain("server")
+	require.NoError(t, err)
+
+	origins := map[string]string{}
+	for _, v := range got {
+		origins[v.Path] = v.Origin.String()
+	}
+	assert.Equal(t, map[string]string{
+		"server.name":     "file " + file + ":2",
+		"server.port":     "flag --port",
+		"server.addr":     "env TEST_EXPLAIN_ADDR",
+		"server.tags":     "file " + file + ":3",
+		"server.debug":    "--set server.debug=true",
+		"server.level":    "--set-string server.level=1",
+		"server.key":      "--set-file server.key=" + filepath.Join(dir, "cert.pem"),
+		"server.host":     "override",
+		"server.timeout":  "WithDefault",
+		"server.tls.cert": "file " + file + ":5",
+	}, origins)
+
+	// the leaf value
+	got, err = cf.Explain("server.port")
+	require.NoError(t, err)
+	assert.Equal(t, []ExplainedValue{{"server.port", 8080, Origin{Type: OriginFlag, Name: "--port"}}}, got)
+
+	// the sub configer
+	sub, err := cf.GetConfiger("server.tls")
+	require.NoError(t, err)
+	got, err = sub.Explain("")
+	require.NoError(t, err)
+	assert.Equal(t, []ExplainedValue{{"cert", "/a.crt", Origin{Type: OriginFile, Name: file, Line: 5}}}, got)
+
+	_, err = cf.Explain("unknown")
+	assert.Error(t, err)
+
+	assert.Contains(t, cf.ExplainString(), `server.tags: ["a","b"] # file `+file+":3\n")
+	assert.Contains(t, cf.ExplainString(), `server.name: "file" # file `+file+":2\n")
+
+	// default
+	cf, err = New().Parse(WithDefault("", map[string]string{"foo": "bar"}))
+	require.NoError(t, err)
+	assert.Equal(t, "foo: \"bar\" # WithDefault\n", cf.ExplainString())
+}
+
+func TestExplainFlag(t *testing.T) {
+	c := New()
+	fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	c.AddFlags(fs)
+	require.NoError(t, fs.Parse([]string{"--config-explain"}))
+
+	// the printing and exiting are left to the caller
+	cf, err := c.Parse(WithDefault("", map[string]string{"foo": "bar"}))
+	assert.ErrorIs(t, err, ErrExplain)
+	require.NotNil(t, cf)
+	assert.Equal(t, "foo: \"bar\" # WithDefault\n", cf.ExplainString())
+
+	assert.PanicsWithValue(t, ErrExplain, func() {
+		c := New()
+		fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+		c.AddFlags(fs)
+		fs.Parse([]string{"--config-explain"})
+		c.MustParse()
+	})
+}
+
+func TestExplainReload(t *testing.T) {
+	dir := createTestDir([]templateFile{{"conf.yml", "foo: a"}})
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "conf.yml")
+
+	cf, err := New().Parse(WithValueFile(file), WithDefaultYaml("", "foo: def\nbar: def"))
+	require.NoError(t, err)
+	assert.Equal(t, "bar: \"def\" # WithDefault\nfoo: \"a\" # file "+file+":1\n", cf.ExplainString())
+
+	require.NoError(t, os.WriteFile(file, []byte("bar: b"), 0644))
+	require.NoError(t, cf.Reload())
+	assert.Equal(t, "bar: \"b\" # file "+file+":1\nfoo: \"def\" # WithDefault\n", cf.ExplainString())
+}
@@ -0,0 +1,198 @@
+package configer
+
+import (
+	"fmt"
+	"math/big"
+	"regexp"
+	"time"
+
+	"github.com/yubo/golib/api/resource"
+	"github.com/yubo/golib/util"
+)
+
+// ValueError is returned by the typed getters when the value is not found
+// or can not be converted to the type
+type ValueError struct {
+	Path   string
+	Type   string      // the type of the getter, e.g. duration
+	Value  interface{} // the raw value, nil if not found
+	Origin Origin      // where the value came from
+	Err    error
+}
+
+func (e *ValueError) Error() string {
+	if e.Value == nil {
+		return fmt.Sprintf("config %s: %s", e.Path, e.Err)
+	}
+
+	value := fmt.Sprintf("%#v", e.Value)
+	if e.Origin.Secret {
+		value = "******"
+	}
+
+	msg := fmt.Sprintf("config %s: unable to convert %s to %s", e.Path, value, e.Type)
+	if e.Origin.Type != "" {
+		msg += " from " + e.Origin.String()
+	}
+	return msg + ": " + e.Err.Error()
+}
+
+func (e *ValueError) Unwrap() error { return e.Err }
+
+// getValue returns the raw value of the path and converts it by fn
+func getValue[T any](p *parsedConfiger, path, typ string, fn func(interface{}) (T, error)) (T, error) {
+	data, origins := p.getOrigins()
+
+	var ret T
+	v, err := rawValue(data, path)
+	if err == nil && v == nil {
+		err = fmt.Errorf("value is null")
+	}
+	if err != nil {
+		return ret, &ValueError{Path: path, Type: typ, Err: err}
+	}
+
+	if ret, err = fn(v); err != nil {
+		return ret, &ValueError{
+			Path:   path,
+			Type:   typ,
+			Value:  v,
+			Origin: origins[joinPath(append(clonePath(p.path), parsePath(path)...)...)],
+			Err:    err,
+		}
+	}
+
+	return ret, nil
+}
+
+// GetDuration: the value like 30s, 1h30m, 2d, the number is nanoseconds
+func (p *parsedConfiger) GetDuration(path string) (time.Duration, error) {
+	return getValue(p, path, "duration", toDuration)
+}
+
+// GetQuantity: the value like 512Mi, 1.5G, 100m
+func (p *parsedConfiger) GetQuantity(path string) (resource.Quantity, error) {
+	return getValue(p, path, "quantity", toQuantity)
+}
+
+// GetByteSize: the value like 512k, 1.5G (1024 based, the same as util.SizeOf), or the quantity like 512Mi
+func (p *parsedConfiger) GetByteSize(path string) (int64, error) {
+	return getValue(p, path, "byte size", toByteSize)
+}
+
+// GetStringSlice: the list, or the string split by the spaces
+func (p *parsedConfiger) GetStringSlice(path string) ([]string, error) {
+	return getValue(p, path, "[]string", util.ToStringSliceE)
+}
+
+// GetStringMap: the map, or the json object string
+func (p *parsedConfiger) GetStringMap(path string) (map[string]string, error) {
+	return getValue(p, path, "map[string]string", util.ToStringMapStringE)
+}
+
+// GetTime: the value like 2006-01-02T15:04:05Z07:00, 2006-01-02, or the unix timestamp
+func (p *parsedConfiger) GetTime(path string) (time.Time, error) {
+	return getValue(p, path, "time", util.ToTimeE)
+}
+
+// Get returns the value of the path as T, the unsupported type is decoded by Read()
+func Get[T any](pc ParsedConfiger, path string) (T, error) {
+	var ret T
+
+	p, ok := pc.(*parsedConfiger)
+	if !ok {
+		return ret, fmt.Errorf("unsupported configer %T", pc)
+	}
+
+	var v interface{}
+	var err error
+	switch any(ret).(type) {
+	case string:
+		v, err = getValue(p, path, "string", util.ToStringE)
+	case bool:
+		v, err = getValue(p, path, "bool", util.ToBoolE)
+	case int:
+		v, err = getValue(p, path, "int", util.ToIntE)
+	case int64:
+		v, err = getValue(p, path, "int64", util.ToInt64E)
+	case float64:
+		v, err = getValue(p, path, "float64", util.ToFloat64E)
+	case time.Duration:
+		v, err = p.GetDuration(path)
+	case time.Time:
+		v, err = p.GetTime(path)
+	case resource.Quantity:
+		v, err = p.GetQuantity(path)
+	case []string:
+		v, err = p.GetStringSlice(path)
+	case map[string]string:
+		v, err = p.GetStringMap(path)
+	default:
+		return getValue(p, path, fmt.Sprintf("%T", ret), func(raw interface{}) (T, error) {
+			var out T
+			err := readValue(raw, &out)
+			return out, err
+		})
+	}
+	if err != nil {
+		return ret, err
+	}
+
+	return v.(T), nil
+}
+
+func toDuration(v interface{}) (time.Duration, error) {
+	d, err := util.ToDurationE(v)
+	if err == nil {
+		return d, nil
+	}
+
+	// the days, e.g. 2d
+	if s, ok := v.(string); ok && daysRegexp.MatchString(s) {
+		return time.Duration(util.TimeOf(s)) * time.Second, nil
+	}
+
+	return 0, err
+}
+
+func toQuantity(v interface{}) (resource.Quantity, error) {
+	s, err := util.ToStringE(v)
+	if err != nil {
+		return resource.Quantity{}, err
+	}
+	return resource.ParseQuantity(s)
+}
+
+var (
+	daysRegexp = regexp.MustCompile(`^[0-9]+[dD]$`)
+	sizeRegexp = regexp.MustCompile(`^([0-9]+(\.[0-9]+)?)([kKmMgGtTpPeE])$`)
+)
+
+// toByteSize parses the suffixes k, m, g, t, p, e as 1024 based, including the fraction like 1.5G,
+// the fraction is rounded up to the byte, like the quantity
+func toByteSize(v interface{}) (int64, error) {
+	s, err := util.ToStringE(v)
+	if err != nil {
+		return 0, err
+	}
+
+	if m := sizeRegexp.FindStringSubmatch(s); m != nil {
+		n, _ := new(big.Rat).SetString(m[1])
+		n.Mul(n, new(big.Rat).SetInt64(int64(util.SizeOf("1"+m[3]))))
+
+		q, r := new(big.Int).QuoRem(n.Num(), n.Denom(), new(big.Int))
+		if r.Sign() > 0 {
+			q.Add(q, big.NewInt(1))
+		}
+		if !q.IsInt64() {
+			return 0, fmt.Errorf("%s overflows int64", s)
+		}
+		return q.Int64(), nil
+	}
+
+	q, err := resource.ParseQuantity(s)
+	if err != nil {
+		return 0, err
+	}
+	return q.Value(), nil
+}
@@ -0,0 +1,105 @@
+package configer
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yubo/golib/api/resource"
+)
+
+func TestGetters(t *testing.T) {
+	yml := `
+timeout: 30s
+days: 2d
+nanos: 1000
+size: 512Mi
+sizek: 2k
+sizeg: 1.5G
+sizef: 1.3k
+sizeq: 1.5Gi
+sizee: 8E
+bad: abc
+tags: [a, b]
+words: a b
+labels: {a: b}
+date: 2026-01-02
+time: "2026-01-02T03:04:05Z"
+token: ${secret:token}
+empty:
+`
+	cf, err := New().Parse(WithDefaultYaml("", yml), WithSecretResolver(SecretResolverFunc(func(string) (string, error) {
+		return "x", nil
+	})))
+	require.NoError(t, err)
+
+	cases := []struct {
+		fn   func() (interface{}, error)
+		want interface{}
+	}{
+		{func() (interface{}, error) { return cf.GetDuration("timeout") }, 30 * time.Second},
+		{func() (interface{}, error) { return cf.GetDuration("days") }, 48 * time.Hour},
+		{func() (interface{}, error) { return cf.GetDuration("nanos") }, time.Microsecond},
+		{func() (interface{}, error) { return cf.GetQuantity("size") }, resource.MustParse("512Mi")},
+		{func() (interface{}, error) { return cf.GetByteSize("size") }, int64(512 << 20)},
+		{func() (interface{}, error) { return cf.GetByteSize("sizek") }, int64(2 << 10)},
+		{func() (interface{}, error) { return cf.GetByteSize("nanos") }, int64(1000)},
+		// the fraction is 1024 based too, rounded up to the byte
+		{func() (interface{}, error) { return cf.GetByteSize("sizeg") }, int64(3 << 29)},
+		{func() (interface{}, error) { return cf.GetByteSize("sizef") }, int64(1332)},
+		{func() (interface{}, error) { return cf.GetByteSize("sizeq") }, int64(3 << 29)},
+		{func() (interface{}, error) { return cf.GetStringSlice("tags") }, []string{"a", "b"}},
+		{func() (interface{}, error) { return cf.GetStringSlice("words") }, []string{"a", "b"}},
+		{func() (interface{}, error) { return cf.GetStringMap("labels") }, map[string]string{"a": "b"}},
+		{func() (interface{}, error) { return cf.GetTime("date") }, time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{func() (interface{}, error) { return cf.GetTime("time") }, time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)},
+		{func() (interface{}, error) { return Get[time.Duration](cf, "timeout") }, 30 * time.Second},
+		{func() (interface{}, error) { return Get[string](cf, "bad") }, "abc"},
+		{func() (interface{}, error) { return Get[int](cf, "nanos") }, 1000},
+		{func() (interface{}, error) { return Get[[]string](cf, "tags") }, []string{"a", "b"}},
+		{func() (interface{}, error) { return Get[map[string]string](cf, "labels") }, map[string]string{"a": "b"}},
+		{func() (interface{}, error) { return Get[struct{ A string }](cf, "labels") }, struct{ A string }{"b"}},
+		{func() (interface{}, error) { return Get[[]int](cf, "tags") }, nil},
+	}
+	for i, c := range cases {
+		got, err := c.fn()
+		if c.want == nil {
+			assert.Error(t, err, fmt.Sprintf("case-%d", i))
+			continue
+		}
+		assert.NoError(t, err, fmt.Sprintf("case-%d", i))
+		assert.Equal(t, c.want, got, fmt.Sprintf("case-%d", i))
+	}
+
+	errCases := []struct {
+		fn   func() error
+		want string
+	}{
+		{func() error { _, err := cf.GetDuration("bad"); return err }, `config bad: unable to convert "abc" to duration from WithDefault: `},
+		{func() error { _, err := cf.GetQuantity("bad"); return err }, `config bad: unable to convert "abc" to quantity from WithDefault: `},
+		{func() error { _, err := cf.GetByteSize("bad"); return err }, `config bad: unable to convert "abc" to byte size from WithDefault: `},
+		{func() error { _, err := cf.GetByteSize("sizee"); return err }, `config sizee: unable to convert "8E" to byte size from WithDefault: 8E overflows int64`},
+		{func() error { _, err := cf.GetTime("bad"); return err }, `config bad: unable to convert "abc" to time from WithDefault: `},
+		{func() error { _, err := cf.GetStringMap("tags"); return err }, `config tags: unable to convert []interface {}{"a", "b"} to map[string]string from WithDefault: `},
+		{func() error { _, err := cf.GetDuration("token"); return err }, `config token: unable to convert ****** to duration from WithDefault (secret): `},
+		{func() error { _, err := cf.GetDuration("unknown"); return err }, `config unknown: "unknown" is not a value`},
+		{func() error { _, err := cf.GetDuration("empty"); return err }, `config empty: value is null`},
+		{func() error { _, err := Get[bool](cf, "tags"); return err }, `config tags: unable to convert []interface {}{"a", "b"} to bool from WithDefault: `},
+	}
+	for i, c := range errCases {
+		err := c.fn()
+		var e *ValueError
+		if assert.True(t, errors.As(err, &e), fmt.Sprintf("case-%d", i)) {
+			assert.Contains(t, err.Error(), c.want, fmt.Sprintf("case-%d", i))
+		}
+	}
+
+	// the sub configer
+	sub, err := cf.GetConfiger("labels")
+	require.NoError(t, err)
+	_, err = Get[int](sub, "a")
+	assert.EqualError(t, err, `config a: unable to convert "b" to int from WithDefault: unable to cast "b" of type string to int`)
+}
@@ -1,8 +1,11 @@
 package configer
 
 import (
+	"context"
 	"fmt"
+	"time"
 
+	"github.com/yubo/golib/api/resource"
 	"github.com/yubo/golib/util"
 	"github.com/yubo/golib/util/errors"
 	"github.com/yubo/golib/util/yaml"
@@ -29,9 +32,27 @@ type ParsedConfiger interface {
 	GetInt64Def(path string, def int64) int64
 	GetInt(path string) (int, error)
 	GetIntDef(path string, def int) int
+	GetDuration(path string) (time.Duration, error)
+	GetQuantity(path string) (resource.Quantity, error)
+	GetByteSize(path string) (int64, error)
+	GetStringSlice(path string) ([]string, error)
+	GetStringMap(path string) (map[string]string, error)
+	GetTime(path string) (time.Time, error)
 	IsSet(path string) bool
 	Read(path string, into interface{}) error
 	String() string
+
+	// Reload: merge all of the sources again, and swap the config if it is valid
+	Reload() error
+	// Watch: reload the config when the value files are changed, until the ctx is done
+	Watch(ctx context.Context) error
+	// OnChange: call fn with the old and new value of the path after the config is reloaded
+	OnChange(path string, fn func(old, new interface{}))
+
+	// Explain: return the leaf values under the path with their origins
+	Explain(path string) ([]ExplainedValue, error)
+	// ExplainString: return the config with the source of each value, like --config-explain
+	ExplainString() string
 }
 
 var _ ParsedConfiger = new(parsedConfiger)
@@ -71,13 +92,21 @@ func (p *parsedConfiger) GetConfiger(path string) (ParsedConfiger, error) {
 	if err != nil {
 		return nil, err
 	}
+	switch raw.(type) {
+	case map[string]interface{}, Values:
+	default:
+		return nil, fmt.Errorf("config %s: %T is not a map", path, raw)
+	}
 
-	// noneed deepCopy
+	// the data is read through the root, see getData()
 	out := &parsedConfiger{&configer{}}
+	p.reloader.RLock()
 	*out.configer = *p.configer
+	p.reloader.RUnlock()
 
 	out.path = append(clonePath(p.path), parsePath(path)...)
-	out.data = raw.(map[string]interface{})
+	out.data = nil
+	out.origins = nil
 
 	return out, nil
 }
@@ -91,11 +120,15 @@ func (p *parsedConfiger) MustGetRaw(path string) interface{} {
 }
 
 func (p *parsedConfiger) GetRaw(path string) (interface{}, error) {
+	return rawValue(p.getData(), path)
+}
+
+func rawValue(data Values, path string) (interface{}, error) {
 	if path == "" {
-		return Values(p.data), nil
+		return data, nil
 	}
 
-	v, err := Values(p.data).PathValue(path)
+	v, err := data.PathValue(path)
 	if err != nil {
 		return nil, err
 	}
@@ -103,7 +136,7 @@ func (p *parsedConfiger) GetRaw(path string) (interface{}, error) {
 }
 
 func (p *parsedConfiger) GetString(path string) (string, error) {
-	v, err := Values(p.data).PathValue(path)
+	v, err := p.getData().PathValue(path)
 	if err != nil {
 		return "", nil
 	}
@@ -112,7 +145,7 @@ func (p *parsedConfiger) GetString(path string) (string, error) {
 }
 
 func (p *parsedConfiger) GetBool(path string) (bool, error) {
-	v, err := Values(p.data).PathValue(path)
+	v, err := p.getData().PathValue(path)
 	if err != nil {
 		return false, err
 	}
@@ -129,7 +162,7 @@ func (p *parsedConfiger) GetBoolDef(path string, def bool) bool {
 }
 
 func (p *parsedConfiger) GetFloat64(path string) (float64, error) {
-	v, err := Values(p.data).PathValue(path)
+	v, err := p.getData().PathValue(path)
 	if err != nil {
 		return 0, err
 	}
@@ -181,7 +214,7 @@ func (p *parsedConfiger) GetIntDef(path string, def int) int {
 }
 
 func (p *parsedConfiger) IsSet(path string) bool {
-	_, err := Values(p.data).PathValue(path)
+	_, err := p.getData().PathValue(path)
 	return err == nil
 }
 
@@ -195,6 +228,11 @@ func (p *parsedConfiger) Read(path string, into interface{}) error {
 		return err
 	}
 
+	return readValue(v, into)
+}
+
+// readValue decodes v into the into, and calls into.Validate() if it implements the validator
+func readValue(v, into interface{}) error {
 	data, err := yaml.Marshal(v)
 	if err != nil {
 		return errors.Wrap(err, fmt.Sprintf("%#v", v))
@@ -215,7 +253,7 @@ func (p *parsedConfiger) Read(path string, into interface{}) error {
 }
 
 func (p *parsedConfiger) String() string {
-	buf, err := yaml.Marshal(p.data)
+	buf, err := yaml.Marshal(p.getData())
 	if err != nil {
 		return err.Error()
 	}
@@ -223,7 +261,7 @@ func (p *parsedConfiger) String() string {
 }
 
 func (p *parsedConfiger) Document() string {
-	buf, err := yaml.Marshal(p.data)
+	buf, err := yaml.Marshal(p.getData())
 	if err != nil {
 		return err.Error()
 	}
@@ -0,0 +1,146 @@
+package configer
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+var (
+	// the events of a file write are merged in the reloadDelay
+	reloadDelay   = 100 * time.Millisecond
+	validatorType = reflect.TypeOf((*validator)(nil)).Elem()
+)
+
+// reloader reloads the config of the root configer,
+// it's shared by the configers from GetConfiger
+type reloader struct {
+	sync.RWMutex // guards configer.data, configer.origins and subscribers
+	root         *configer
+	subscribers  []subscriber
+
+	mu sync.Mutex // serializes the reload
+}
+
+type subscriber struct {
+	path string
+	fn   func(old, new interface{})
+}
+
+// getData returns the config tree under the path, the tree is not modified after swapped in,
+// the configers from GetConfiger read through the data of the root, so the reloaded config is seen
+func (p *configer) getData() Values {
+	p.reloader.RLock()
+	defer p.reloader.RUnlock()
+
+	return p.subData()
+}
+
+// getOrigins returns the config tree and the origins of the values,
+// the origins are keyed by the path from the root
+func (p *configer) getOrigins() (Values, origins) {
+	p.reloader.RLock()
+	defer p.reloader.RUnlock()
+
+	return p.subData(), p.reloader.root.origins
+}
+
+// subData returns the data of the root under the path, it's empty if the path is removed by the reload
+func (p *configer) subData() Values {
+	data := p.reloader.root.data
+	if len(p.path) == 0 {
+		return data
+	}
+
+	v, _ := Values(data).PathValue(joinPath(p.path...))
+	if m, ok := v.(map[string]interface{}); ok {
+		return m
+	}
+	return Values{}
+}
+
+// Reload: merge all of the sources again, and swap the config if it is valid,
+// the configers from GetConfiger see the new config too
+func (p *configer) Reload() error {
+	return p.reloader.reload()
+}
+
+// Watch: reload the config when the value files are changed, until the ctx is done
+func (p *configer) Watch(ctx context.Context) error {
+	return p.reloader.watch(ctx)
+}
+
+// OnChange: call fn with the old and new value of the path after the config is reloaded,
+// the path is relative to the configer, fn must not call Reload()
+func (p *configer) OnChange(path string, fn func(old, new interface{})) {
+	p.reloader.Lock()
+	defer p.reloader.Unlock()
+
+	p.reloader.subscribers = append(p.reloader.subscribers, subscriber{
+		path: joinPath(append(clonePath(p.path), parsePath(path)...)...),
+		fn:   fn,
+	})
+}
+
+// validate reads the samples of Var() which implement the validator from the data
+func (p *configer) validate(data map[string]interface{}) error {
+	for _, s := range p.samples {
+		if !reflect.PtrTo(s.typ).Implements(validatorType) {
+			continue
+		}
+
+		v, err := rawValue(data, s.path)
+		if err != nil {
+			continue
+		}
+
+		if err := readValue(v, reflect.New(s.typ).Interface()); err != nil {
+			return fmt.Errorf("invalid config %q: %s", s.path, err)
+		}
+	}
+
+	return nil
+}
+
+func (p *reloader) reload() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	data, origins, err := p.root.merge()
+	if err != nil {
+		return err
+	}
+
+	if err := p.root.validate(data); err != nil {
+		return err
+	}
+
+	p.Lock()
+	old := p.root.data
+	p.root.data = data
+	p.root.origins = origins
+	subscribers := p.subscribers
+	p.Unlock()
+
+	for _, s := range subscribers {
+		oldValue, _ := rawValue(old, s.path)
+		newValue, _ := rawValue(data, s.path)
+		if !reflect.DeepEqual(oldValue, newValue) {
+			s.fn(oldValue, newValue)
+		}
+	}
+
+	return nil
+}
+
+func (p *reloader) handleError(err error) {
+	klog.ErrorS(err, "reload config")
+
+	if fn := p.root.onReloadError; fn != nil {
+		fn(err)
+	}
+}
@@ -0,0 +1,87 @@
+//go:build linux
+
+package configer
+
+import (
+	"context"
+	"path/filepath"
+	"time"
+
+	"github.com/yubo/golib/util/inotify"
+)
+
+func (p *reloader) watch(ctx context.Context) error {
+	files := map[string]bool{}
+	dirs := map[string]bool{}
+	for _, file := range p.root.ValueFiles() {
+		file, err := filepath.Abs(file)
+		if err != nil {
+			return err
+		}
+		files[file] = true
+		dirs[filepath.Dir(file)] = true
+	}
+
+	if len(files) == 0 {
+		return nil
+	}
+
+	w, err := inotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+
+	// watch the dirs, the file may be replaced by rename, e.g. vim, kubectl
+	for dir := range dirs {
+		if err := w.AddWatch(dir, inotify.InCloseWrite|inotify.InMovedTo|inotify.InCreate); err != nil {
+			closeWatcher(w)
+			return err
+		}
+	}
+
+	go p.run(ctx, w, files)
+
+	return nil
+}
+
+func (p *reloader) run(ctx context.Context, w *inotify.Watcher, files map[string]bool) {
+	defer closeWatcher(w)
+
+	var delay <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev, ok := <-w.Event:
+			if !ok {
+				return
+			}
+			if files[filepath.Clean(ev.Name)] {
+				delay = time.After(reloadDelay)
+			}
+		case err, ok := <-w.Error:
+			if !ok {
+				return
+			}
+			p.handleError(err)
+		case <-delay:
+			delay = nil
+			if err := p.reload(); err != nil {
+				p.handleError(err)
+			}
+		}
+	}
+}
+
+// closeWatcher closes the watcher, and drains the channels until the reader goroutine exits
+func closeWatcher(w *inotify.Watcher) {
+	w.Close()
+	go func() {
+		for range w.Event {
+		}
+	}()
+	go func() {
+		for range w.Error {
+		}
+	}()
+}
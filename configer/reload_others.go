@@ -0,0 +1,19 @@
+//go:build !linux
+
+package configer
+
+import (
+	"context"
+
+	"github.com/yubo/golib/util/inotify"
+)
+
+// watch returns the not supported error of inotify if there are value files
+func (p *reloader) watch(ctx context.Context) error {
+	if len(p.root.ValueFiles()) == 0 {
+		return nil
+	}
+
+	_, err := inotify.NewWatcher()
+	return err
+}
@@ -0,0 +1,162 @@
+package configer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testReloadConfig struct {
+	Port int    `json:"port"`
+	Name string `json:"name"`
+}
+
+func (p *testReloadConfig) Validate() error {
+	if p.Port <= 0 {
+		return errors.New("invalid port")
+	}
+	return nil
+}
+
+func TestReload(t *testing.T) {
+	dir := createTestDir([]templateFile{{"conf.yml", "server:\n  name: a\nother: x"}})
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "conf.yml")
+
+	c := New()
+	require.NoError(t, c.Var(pflag.NewFlagSet("test", pflag.ContinueOnError), "server", &testReloadConfig{Port: 80}))
+	cf, err := c.Parse(WithValueFile(file), WithOverrideYaml("server", "name: b"))
+	require.NoError(t, err)
+
+	sub, err := cf.GetConfiger("server")
+	require.NoError(t, err)
+
+	var got []string
+	onChange := func(old, new interface{}) { got = append(got, fmt.Sprintf("%v->%v", old, new)) }
+	cf.OnChange("server.port", onChange)
+	sub.OnChange("name", onChange)
+
+	cases := []struct {
+		content string
+		wantErr bool
+		port    int
+		want    []string
+	}{
+		{"server:\n  name: a\nother: x", false, 80, nil},
+		{"server:\n  port: 8080\nother: y", false, 8080, []string{"80->8080"}},
+		// the override value is not changed
+		{"server:\n  port: 8080\n  name: c", false, 8080, nil},
+		// keep the old config
+		{"server:\n  port: -1", true, 8080, nil},
+		{"server: [", true, 8080, nil},
+		{"other: z", false, 80, []string{"8080->80"}},
+	}
+	for i, c := range cases {
+		got = nil
+		require.NoError(t, os.WriteFile(file, []byte(c.content), 0644), fmt.Sprintf("case-%d", i))
+
+		err := cf.Reload()
+		if c.wantErr {
+			assert.Error(t, err, fmt.Sprintf("case-%d", i))
+		} else {
+			assert.NoError(t, err, fmt.Sprintf("case-%d", i))
+		}
+		assert.Equal(t, c.port, cf.GetIntDef("server.port", 0), fmt.Sprintf("case-%d", i))
+		assert.Equal(t, "b", cf.MustGetRaw("server.name"), fmt.Sprintf("case-%d", i))
+		assert.Equal(t, c.want, got, fmt.Sprintf("case-%d", i))
+
+		// the sub configer reads the reloaded config
+		assert.Equal(t, c.port, sub.GetIntDef("port", 0), fmt.Sprintf("case-%d", i))
+	}
+}
+
+func TestReloadEnv(t *testing.T) {
+	type config struct {
+		Name string `json:"name" env:"TEST_RELOAD_NAME"`
+	}
+
+	t.Setenv("TEST_RELOAD_NAME", "a")
+
+	c := New()
+	require.NoError(t, c.Var(pflag.NewFlagSet("test", pflag.ContinueOnError), "server", &config{}))
+	cf, err := c.Parse()
+	require.NoError(t, err)
+	assert.Equal(t, "a", cf.MustGetRaw("server.name"))
+
+	// the env is read again
+	t.Setenv("TEST_RELOAD_NAME", "b")
+	require.NoError(t, cf.Reload())
+	assert.Equal(t, "b", cf.MustGetRaw("server.name"))
+
+	sub, err := cf.GetConfiger("server")
+	require.NoError(t, err)
+	values, err := sub.Explain("")
+	require.NoError(t, err)
+	require.Len(t, values, 1)
+	assert.Equal(t, Origin{Type: OriginEnv, Name: "TEST_RELOAD_NAME"}, values[0].Origin)
+}
+
+func TestWatch(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skipf("watch not supported on %s", runtime.GOOS)
+	}
+
+	dir := createTestDir([]templateFile{{"conf.yml", "foo: a"}})
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "conf.yml")
+
+	errs := make(chan error, 10)
+	cf, err := New().Parse(WithValueFile(file), WithReloadErrorHandler(func(err error) { errs <- err }))
+	require.NoError(t, err)
+
+	changes := make(chan interface{}, 10)
+	cf.OnChange("foo", func(old, new interface{}) { changes <- new })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, cf.Watch(ctx))
+
+	wait := func() interface{} {
+		select {
+		case v := <-changes:
+			return v
+		case err := <-errs:
+			return err
+		case <-time.After(5 * time.Second):
+			return nil
+		}
+	}
+
+	// write
+	require.NoError(t, os.WriteFile(file, []byte("foo: b"), 0644))
+	assert.Equal(t, "b", wait())
+
+	// rename
+	tmp := filepath.Join(dir, "conf.yml.tmp")
+	require.NoError(t, os.WriteFile(tmp, []byte("foo: c"), 0644))
+	require.NoError(t, os.Rename(tmp, file))
+	assert.Equal(t, "c", wait())
+
+	// the other file in the dir
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "other.yml"), []byte("foo: d"), 0644))
+	// the failed reload
+	require.NoError(t, os.WriteFile(file, []byte("foo: ["), 0644))
+	assert.Error(t, wait().(error))
+	assert.Equal(t, "c", cf.MustGetRaw("foo"))
+
+	// stopped
+	cancel()
+	time.Sleep(10 * time.Millisecond)
+	require.NoError(t, os.WriteFile(file, []byte("foo: e"), 0644))
+	time.Sleep(2 * reloadDelay)
+	assert.Equal(t, "c", cf.MustGetRaw("foo"))
+}
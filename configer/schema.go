@@ -0,0 +1,277 @@
+package configer
+
+import (
+	"encoding"
+	"encoding/json"
+	"net"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/spf13/pflag"
+	"github.com/yubo/golib/util"
+	"github.com/yubo/golib/util/validation/field"
+)
+
+const schemaVersion = "http://json-schema.org/draft-07/schema#"
+
+var (
+	pflagValueType     = reflect.TypeOf((*pflag.Value)(nil)).Elem()
+	jsonMarshalerType  = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType  = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	durationType       = reflect.TypeOf(time.Duration(0))
+	ipType             = reflect.TypeOf(net.IP{})
+	emptyInterfaceType = reflect.TypeOf((*interface{})(nil)).Elem()
+)
+
+// Schema is the json schema of the config, generated from the fields of Var()
+type Schema struct {
+	Schema               string             `json:"$schema,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Default              interface{}        `json:"default,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+	Deprecated           bool               `json:"deprecated,omitempty"`
+	DeprecationMessage   string             `json:"deprecationMessage,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+}
+
+// Schema: return the json schema of the registered fields
+func (p *configer) Schema() *Schema {
+	root := &Schema{Schema: schemaVersion, Type: "object"}
+
+	for _, f := range p.fields {
+		path := parsePath(joinPath(append(p.path, f.configPath)...))
+		if len(path) == 0 {
+			continue
+		}
+
+		node := root
+		for _, name := range path[:len(path)-1] {
+			node = node.property(name, true)
+		}
+		node.setProperty(path[len(path)-1], f.schema)
+	}
+
+	return root
+}
+
+// property returns the schema of the key, creates the object if create is true
+func (p *Schema) property(key string, create bool) *Schema {
+	if s, ok := p.Properties[key]; ok {
+		return s
+	}
+
+	if p.AdditionalProperties != nil {
+		return p.AdditionalProperties
+	}
+
+	if !create {
+		return nil
+	}
+
+	s := &Schema{Type: "object"}
+	p.setProperty(key, s)
+	return s
+}
+
+func (p *Schema) setProperty(key string, s *Schema) {
+	if p.Properties == nil {
+		p.Properties = map[string]*Schema{}
+	}
+	p.Properties[key] = s
+}
+
+func newFieldSchema(rt reflect.Type, tag *FieldTag, sample interface{}) *Schema {
+	s := typeSchema(rt, map[reflect.Type]bool{})
+	s.Description = tag.Description
+	s.Deprecated = tag.Deprecated != ""
+	s.DeprecationMessage = tag.Deprecated
+
+	if !isZeroValue(sample) {
+		s.Default = sample
+	} else if tag.Default != "" {
+		s.Default = schemaValue(rt, tag.Default)
+	}
+
+	for _, v := range tag.Enum {
+		s.Enum = append(s.Enum, schemaValue(rt, v))
+	}
+
+	return s
+}
+
+// typeSchema returns the schema of the type, the recursive struct is an object without properties
+func typeSchema(rt reflect.Type, seen map[reflect.Type]bool) *Schema {
+	for rt.Kind() == reflect.Ptr {
+		rt = rt.Elem()
+	}
+
+	ptr := reflect.PtrTo(rt)
+	switch {
+	case rt == ipType || rt == durationType:
+		return &Schema{Type: "string"}
+	case ptr.Implements(pflagValueType) || ptr.Implements(jsonMarshalerType) || ptr.Implements(textMarshalerType):
+		return &Schema{Type: "string"}
+	}
+
+	switch rt.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if rt.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string"}
+		}
+		return &Schema{Type: "array", Items: typeSchema(rt.Elem(), seen)}
+	case reflect.Map:
+		if rt.Elem() == emptyInterfaceType {
+			return &Schema{Type: "object"}
+		}
+		return &Schema{Type: "object", AdditionalProperties: typeSchema(rt.Elem(), seen)}
+	case reflect.Struct:
+		s := &Schema{Type: "object"}
+		if seen[rt] {
+			return s
+		}
+		seen[rt] = true
+		defer delete(seen, rt)
+
+		structSchema(s, rt, seen)
+		return s
+	default:
+		return &Schema{}
+	}
+}
+
+func structSchema(s *Schema, rt reflect.Type, seen map[reflect.Type]bool) {
+	for i := 0; i < rt.NumField(); i++ {
+		sf := rt.Field(i)
+		if sf.PkgPath != "" && !sf.Anonymous {
+			continue
+		}
+
+		tag := GetFieldTag(sf)
+		if tag.skip {
+			continue
+		}
+
+		// inline the embedded struct
+		if sf.Anonymous {
+			ft := sf.Type
+			for ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct && !seen[ft] {
+				structSchema(s, ft, seen)
+			}
+			continue
+		}
+
+		fs := typeSchema(sf.Type, seen)
+		fs.Description = tag.Description
+		fs.Deprecated = tag.Deprecated != ""
+		fs.DeprecationMessage = tag.Deprecated
+		if tag.Default != "" {
+			fs.Default = schemaValue(sf.Type, tag.Default)
+		}
+		for _, v := range tag.Enum {
+			fs.Enum = append(fs.Enum, schemaValue(sf.Type, v))
+		}
+		s.setProperty(tag.json, fs)
+	}
+}
+
+// schemaValue converts the value of the tag to the json value of the type
+func schemaValue(rt reflect.Type, value string) interface{} {
+	for rt.Kind() == reflect.Ptr {
+		rt = rt.Elem()
+	}
+
+	if rt == durationType {
+		return value
+	}
+
+	switch rt.Kind() {
+	case reflect.Bool:
+		return util.ToBool(value)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return util.ToInt64(value)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return util.ToUint64(value)
+	case reflect.Float32, reflect.Float64:
+		return util.ToFloat64(value)
+	default:
+		return value
+	}
+}
+
+func isZeroValue(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Map, reflect.Slice:
+		return rv.Len() == 0
+	default:
+		return rv.IsZero()
+	}
+}
+
+// unknownFields returns the keys of the values which are neither in the schema nor in the known values
+func unknownFields(values map[string]interface{}, schema *Schema, known map[string]interface{}, path *field.Path, detail string) (errs field.ErrorList) {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		fp := path.Child(k)
+
+		var s *Schema
+		if schema != nil {
+			s = schema.property(k, false)
+		}
+		knownValue, isKnown := known[k]
+
+		if s == nil && !isKnown {
+			errs = append(errs, field.Forbidden(fp, detail))
+			continue
+		}
+
+		knownMap, _ := knownValue.(map[string]interface{})
+		switch v := values[k].(type) {
+		case map[string]interface{}:
+			// the object without properties accepts any key
+			if s != nil && (s.Type != "object" || (s.Properties == nil && s.AdditionalProperties == nil)) {
+				continue
+			}
+			if s == nil && knownMap == nil {
+				continue
+			}
+			errs = append(errs, unknownFields(v, s, knownMap, fp, detail)...)
+		case []interface{}:
+			if s == nil || s.Items == nil || s.Items.Type != "object" || s.Items.Properties == nil {
+				continue
+			}
+			for i, item := range v {
+				if m, ok := item.(map[string]interface{}); ok {
+					errs = append(errs, unknownFields(m, s.Items, nil, fp.Index(i), detail)...)
+				}
+			}
+		}
+	}
+
+	return errs
+}
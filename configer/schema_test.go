@@ -0,0 +1,127 @@
+package configer
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yubo/golib/api"
+)
+
+type testSchemaTLS struct {
+	Cert string `json:"cert" description:"cert file"`
+}
+
+type testSchemaBackend struct {
+	Addr   string `json:"addr"`
+	Weight int    `json:"weight" default:"1"`
+}
+
+type testSchemaConfig struct {
+	Name     string                       `json:"name" description:"server name" default:"foo"`
+	Port     int                          `json:"port" flag:"port" default:"80"`
+	Mode     string                       `json:"mode" enum:"dev,prod" default:"dev"`
+	Debug    bool                         `json:"debug" deprecated:"use level"`
+	Timeout  api.Duration                 `json:"timeout" default:"5s"`
+	Interval time.Duration                `json:"interval"`
+	Ratio    float64                      `json:"ratio"`
+	Tags     []string                     `json:"tags"`
+	Labels   map[string]string            `json:"labels"`
+	Extra    map[string]interface{}       `json:"extra"`
+	Backends []testSchemaBackend          `json:"backends"`
+	Groups   map[string]testSchemaBackend `json:"groups"`
+	TLS      *testSchemaTLS               `json:"tls"`
+	Skip     string                       `json:"-"`
+}
+
+func TestSchema(t *testing.T) {
+	c := New()
+	require.NoError(t, c.Var(pflag.NewFlagSet("test", pflag.ContinueOnError), "server", &testSchemaConfig{Ratio: 0.5}))
+
+	b, err := json.Marshal(c.Schema())
+	require.NoError(t, err)
+
+	var got map[string]interface{}
+	require.NoError(t, json.Unmarshal(b, &got))
+	server := Values(got)
+
+	cases := []struct {
+		path string
+		want interface{}
+	}{
+		{"$schema", schemaVersion},
+		{"properties.server.type", "object"},
+		{"properties.server.properties.name", map[string]interface{}{"type": "string", "description": "server name", "default": "foo"}},
+		{"properties.server.properties.port", map[string]interface{}{"type": "integer", "default": float64(80)}},
+		{"properties.server.properties.mode.enum", []interface{}{"dev", "prod"}},
+		{"properties.server.properties.debug", map[string]interface{}{"type": "boolean", "deprecated": true, "deprecationMessage": "use level"}},
+		{"properties.server.properties.timeout", map[string]interface{}{"type": "string", "default": "5s"}},
+		{"properties.server.properties.interval.type", "string"},
+		{"properties.server.properties.ratio", map[string]interface{}{"type": "number", "default": 0.5}},
+		{"properties.server.properties.tags", map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}}},
+		{"properties.server.properties.labels.additionalProperties.type", "string"},
+		{"properties.server.properties.extra", map[string]interface{}{"type": "object"}},
+		{"properties.server.properties.backends.items.properties.weight", map[string]interface{}{"type": "integer", "default": float64(1)}},
+		{"properties.server.properties.groups.additionalProperties.properties.addr.type", "string"},
+		{"properties.server.properties.tls.properties.cert.description", "cert file"},
+	}
+	for i, c := range cases {
+		v, err := server.PathValue(c.path)
+		assert.NoError(t, err, fmt.Sprintf("case-%d", i))
+		assert.Equal(t, c.want, v, fmt.Sprintf("case-%d", i))
+	}
+
+	_, err = server.PathValue("properties.server.properties.Skip")
+	assert.Error(t, err)
+}
+
+func TestStrict(t *testing.T) {
+	cases := []struct {
+		content string
+		wantErr string
+	}{
+		{"server:\n  name: a\n  tls:\n    cert: a.crt\n  labels:\n    a: b\n  extra:\n    a: {b: c}", ""},
+		{"server:\n  backends:\n  - addr: a\n  groups:\n    a:\n      addr: a", ""},
+		// WithDefault and WithOverride
+		{"server:\n  timeout2: 1s\nlog:\n  level: 1", ""},
+		{"server:\n  nmae: a", "server.nmae: Forbidden: unknown field in"},
+		{"server:\n  tls:\n    crt: a.crt", "server.tls.crt: Forbidden: unknown field in"},
+		{"server:\n  backends:\n  - adr: a", "server.backends[0].adr: Forbidden: unknown field in"},
+		{"server:\n  groups:\n    a:\n      adr: a", "server.groups.a.adr: Forbidden: unknown field in"},
+		{"log:\n  lvl: 1", "log.lvl: Forbidden: unknown field in"},
+		{"foo: 1\nbar: 2", "[bar: Forbidden: unknown field in"},
+	}
+
+	for i, c := range cases {
+		dir := createTestDir([]templateFile{{"conf.yml", c.content}})
+		defer os.RemoveAll(dir)
+
+		cf := New()
+		require.NoError(t, cf.Var(pflag.NewFlagSet("test", pflag.ContinueOnError), "server", &testSchemaConfig{}))
+
+		opts := []ConfigerOption{
+			WithValueFile(filepath.Join(dir, "conf.yml")),
+			WithDefaultYaml("log", "level: 0"),
+			WithOverrideYaml("server", "timeout2: 2s"),
+		}
+
+		// without strict
+		_, err := cf.Parse(opts...)
+		require.NoError(t, err, fmt.Sprintf("case-%d", i))
+
+		cf = New()
+		require.NoError(t, cf.Var(pflag.NewFlagSet("test", pflag.ContinueOnError), "server", &testSchemaConfig{}))
+		_, err = cf.Parse(append(opts, WithStrict())...)
+		if c.wantErr == "" {
+			assert.NoError(t, err, fmt.Sprintf("case-%d", i))
+		} else if assert.Error(t, err, fmt.Sprintf("case-%d", i)) {
+			assert.Contains(t, err.Error(), c.wantErr, fmt.Sprintf("case-%d", i))
+		}
+	}
+}
@@ -0,0 +1,427 @@
+package configer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yubo/golib/util/yaml"
+)
+
+// Source provides the values of the config, see WithSource
+type Source interface {
+	// Name is used in the error and the origin of the values
+	Name() string
+	// Values returns the values to merge, it's called by Parse() and Reload()
+	Values() (map[string]interface{}, error)
+}
+
+// envSource provides the env variables,
+// the values are set to the fields by the env tag of Var(), like the env layer
+type envSource interface {
+	Envs() (map[string]string, error)
+}
+
+// SourcePosition is where the source is merged
+type SourcePosition int
+
+const (
+	AfterDefault SourcePosition = iota // after WithDefault(), before the env
+	AfterEnv                           // after the env, before the value files
+	AfterFiles                         // after the value files, before --set
+	AfterFlags                         // after the flags, before WithOverride()
+)
+
+// WithSource merges the values of the source at the position,
+// the sources at the same position are merged in order
+func WithSource(pos SourcePosition, source Source) ConfigerOption {
+	return func(p *ConfigerOptions) {
+		if p.sources == nil {
+			p.sources = map[SourcePosition][]Source{}
+		}
+		p.sources[pos] = append(p.sources[pos], source)
+	}
+}
+
+// merge the values of the sources at the position into ${into}
+func (p *configer) mergeSources(into map[string]interface{}, srcs origins, pos SourcePosition) (map[string]interface{}, error) {
+	for _, source := range p.sources[pos] {
+		var values map[string]interface{}
+		var err error
+
+		if s, ok := source.(envSource); ok {
+			values, err = p.envValues(s)
+		} else {
+			values, err = source.Values()
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %s", source.Name(), err)
+		}
+
+		values = cloneValues(values)
+		if err := p.convertValues(values); err != nil {
+			return nil, fmt.Errorf("failed to read %s: %s", source.Name(), err)
+		}
+		into = mergeValues(into, values)
+		srcs.set("", values, Origin{Type: OriginSource, Name: source.Name()})
+	}
+
+	return into, nil
+}
+
+// envValues returns the values of the fields which env are set by the source
+func (p *configer) envValues(s envSource) (map[string]interface{}, error) {
+	envs, err := s.Envs()
+	if err != nil {
+		return nil, err
+	}
+
+	values := map[string]interface{}{}
+	for _, f := range p.fields {
+		if f.envName == "" {
+			continue
+		}
+		if v, ok := envs[f.envName]; ok && (p.allowEmptyEnv || v != "") {
+			values = mergePathValue(values, joinPath(append(p.path, f.configPath)...), v)
+		}
+	}
+
+	return values, nil
+}
+
+// convertValues converts the string values of the fields registered by Var() to the types of the fields,
+// the env and the sources like dir only have the strings
+func (p *configer) convertValues(values map[string]interface{}) error {
+	for _, f := range p.fields {
+		path := joinPath(append(p.path, f.configPath)...)
+		v, err := Values(values).PathValue(path)
+		if err != nil {
+			continue
+		}
+		s, ok := v.(string)
+		if !ok {
+			continue
+		}
+
+		out, err := f.convert(s)
+		if err != nil {
+			return fmt.Errorf("%s: %s", path, err)
+		}
+		mergePathValue(values, path, out)
+	}
+
+	return nil
+}
+
+// osEnv is the envSource of the env variables of the process
+type osEnv struct{}
+
+func (osEnv) Envs() (map[string]string, error) {
+	envs := map[string]string{}
+	for _, kv := range os.Environ() {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			envs[k] = v
+		}
+	}
+	return envs, nil
+}
+
+// NewDirSource returns the source of a directory, one key per file,
+// like the configmap or secret mounted by kubernetes.
+// the file name is the path of the value under the path, e.g. server.port
+func NewDirSource(dir, path string) Source {
+	return &dirSource{dir: dir, path: path}
+}
+
+type dirSource struct {
+	dir  string
+	path string
+}
+
+func (p *dirSource) Name() string { return "dir " + p.dir }
+
+func (p *dirSource) Values() (map[string]interface{}, error) {
+	entries, err := os.ReadDir(p.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	values := map[string]interface{}{}
+	for _, entry := range entries {
+		// skip the hidden files, e.g. ..data of kubernetes
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		file := filepath.Join(p.dir, entry.Name())
+		// follow the symlink
+		if fi, err := os.Stat(file); err != nil || !fi.Mode().IsRegular() {
+			continue
+		}
+
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		values = mergePathValue(values, joinPath(append(parsePath(p.path), entry.Name())...),
+			strings.TrimSuffix(string(b), "\n"))
+	}
+
+	return values, nil
+}
+
+// NewEnvFileSource returns the source of a .env file,
+// the variables are set to the fields by the env tag of Var(), like the env variables
+func NewEnvFileSource(file string) Source {
+	return &envFileSource{file: file}
+}
+
+type envFileSource struct {
+	file string
+}
+
+func (p *envFileSource) Name() string { return "envfile " + p.file }
+
+// Values returns the variables of the file
+func (p *envFileSource) Values() (map[string]interface{}, error) {
+	envs, err := p.Envs()
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]interface{}, len(envs))
+	for k, v := range envs {
+		values[k] = v
+	}
+	return values, nil
+}
+
+func (p *envFileSource) Envs() (map[string]string, error) {
+	b, err := os.ReadFile(p.file)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseEnvFile(p.file, b)
+}
+
+// parseEnvFile parses the lines like `[export ]KEY=VALUE`, the value can be quoted
+func parseEnvFile(name string, data []byte) (map[string]string, error) {
+	envs := map[string]string{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, value, ok := strings.Cut(strings.TrimPrefix(line, "export "), "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("%s:%d: invalid line %q", name, n, line)
+		}
+
+		value = strings.TrimSpace(value)
+		switch {
+		case len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"':
+			v, err := strconv.Unquote(value)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %s", name, n, err)
+			}
+			value = v
+		case len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'':
+			value = value[1 : len(value)-1]
+		default:
+			if i := strings.Index(value, " #"); i >= 0 {
+				value = strings.TrimSpace(value[:i])
+			}
+		}
+
+		envs[key] = value
+	}
+
+	return envs, scanner.Err()
+}
+
+// httpSourceTimeout bounds the request of the http source,
+// a hung endpoint should not block Parse and Reload
+var httpSourceTimeout = 10 * time.Second
+
+// NewHTTPSource returns the source of a http endpoint which returns yaml or json,
+// a client with the timeout of 10s is used if the client is nil
+func NewHTTPSource(url string, client *http.Client) Source {
+	if client == nil {
+		client = &http.Client{Timeout: httpSourceTimeout}
+	}
+	return &httpSource{url: url, client: client, timeout: httpSourceTimeout}
+}
+
+type httpSource struct {
+	url     string
+	client  *http.Client
+	timeout time.Duration
+}
+
+func (p *httpSource) Name() string { return "http " + p.url }
+
+func (p *httpSource) Values() (map[string]interface{}, error) {
+	// the client may have no timeout
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	values := map[string]interface{}{}
+	if err := yaml.Unmarshal(b, &values); err != nil {
+		return nil, err
+	}
+
+	return values, nil
+}
+
+var secretRefRegexp = regexp.MustCompile(`\$\{secret:([^}]+)\}`)
+
+// SecretResolver returns the value of the secret reference ${secret:name}
+type SecretResolver interface {
+	Resolve(name string) (string, error)
+}
+
+// SecretResolverFunc is an adapter to allow the use of ordinary functions as SecretResolver
+type SecretResolverFunc func(name string) (string, error)
+
+func (f SecretResolverFunc) Resolve(name string) (string, error) { return f(name) }
+
+// WithSecretResolver resolves the ${secret:name} references in the string values after the merge
+func WithSecretResolver(resolver SecretResolver) ConfigerOption {
+	return func(p *ConfigerOptions) {
+		p.secretResolver = resolver
+	}
+}
+
+// NewDirSecretResolver returns the resolver which reads the secret from the file ${dir}/${name},
+// like the secret mounted by kubernetes
+func NewDirSecretResolver(dir string) SecretResolver {
+	return SecretResolverFunc(func(name string) (string, error) {
+		if name != filepath.Base(name) {
+			return "", fmt.Errorf("invalid secret name %q", name)
+		}
+
+		b, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSuffix(string(b), "\n"), nil
+	})
+}
+
+// resolveSecrets replaces the secret references in the values, and marks the origins of the values
+func resolveSecrets(values map[string]interface{}, resolver SecretResolver, srcs origins, path []string) error {
+	// in order, the first error is the same every time
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		v := values[k]
+		cur := append(clonePath(path), k)
+
+		switch v := v.(type) {
+		case map[string]interface{}:
+			if err := resolveSecrets(v, resolver, srcs, cur); err != nil {
+				return err
+			}
+		default:
+			resolved, ok, err := resolveSecretValue(v, resolver)
+			if err != nil {
+				return fmt.Errorf("%s: %s", joinPath(cur...), err)
+			}
+			if ok {
+				values[k] = resolved
+				o := srcs[joinPath(cur...)]
+				o.Secret = true
+				srcs[joinPath(cur...)] = o
+			}
+		}
+	}
+
+	return nil
+}
+
+// resolveSecretValue resolves the string or the strings in the list
+func resolveSecretValue(v interface{}, resolver SecretResolver) (ret interface{}, resolved bool, err error) {
+	switch v := v.(type) {
+	case string:
+		if !secretRefRegexp.MatchString(v) {
+			return v, false, nil
+		}
+
+		ret = secretRefRegexp.ReplaceAllStringFunc(v, func(ref string) string {
+			if err != nil {
+				return ref
+			}
+			var s string
+			s, err = resolver.Resolve(secretRefRegexp.FindStringSubmatch(ref)[1])
+			return s
+		})
+		return ret, err == nil, err
+	case []interface{}:
+		for i := range v {
+			item, ok, err := resolveSecretValue(v[i], resolver)
+			if err != nil {
+				return nil, false, err
+			}
+			if ok {
+				v[i] = item
+				resolved = true
+			}
+		}
+		return v, resolved, nil
+	case map[string]interface{}:
+		// the map in the list
+		for k := range v {
+			item, ok, err := resolveSecretValue(v[k], resolver)
+			if err != nil {
+				return nil, false, err
+			}
+			if ok {
+				v[k] = item
+				resolved = true
+			}
+		}
+		return v, resolved, nil
+	default:
+		return v, false, nil
+	}
+}
@@ -0,0 +1,177 @@
+package configer
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSource(t *testing.T) {
+	dir := createTestDir([]templateFile{
+		{"conf.yml", "server:\n  name: file\n  port: 81"},
+		{".env", "# comment\nexport TEST_SOURCE_HOST=example.com\nTEST_SOURCE_USER=\"to\\\"m\" \nTEST_SOURCE_EMPTY=\nTEST_SOURCE_DEBUG=true\nOTHER=x # comment"},
+	})
+	defer os.RemoveAll(dir)
+
+	// the configmap
+	cm := filepath.Join(dir, "configmap")
+	require.NoError(t, os.MkdirAll(filepath.Join(cm, "..data"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(cm, "..data", "port"), []byte("8080\n"), 0644))
+	require.NoError(t, os.Symlink(filepath.Join("..data", "port"), filepath.Join(cm, "port")))
+	require.NoError(t, os.WriteFile(filepath.Join(cm, "tls.cert"), []byte("a.crt"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(cm, "tags"), []byte("[a, b]"), 0644))
+
+	var status int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		fmt.Fprint(w, `{"server": {"name": "http", "timeout": "5s"}}`)
+	}))
+	defer ts.Close()
+
+	type config struct {
+		Name  string   `json:"name"`
+		Port  int      `json:"port"`
+		Host  string   `json:"host" env:"TEST_SOURCE_HOST"`
+		User  string   `json:"user" env:"TEST_SOURCE_USER"`
+		Empty string   `json:"empty" env:"TEST_SOURCE_EMPTY" default:"def"`
+		Debug bool     `json:"debug" env:"TEST_SOURCE_DEBUG"`
+		Tags  []string `json:"tags"`
+	}
+
+	parse := func(opts ...ConfigerOption) (ParsedConfiger, error) {
+		c := New()
+		require.NoError(t, c.Var(pflag.NewFlagSet("test", pflag.ContinueOnError), "server", &config{}))
+		return c.Parse(append([]ConfigerOption{WithValueFile(filepath.Join(dir, "conf.yml"))}, opts...)...)
+	}
+
+	status = http.StatusOK
+	cf, err := parse(
+		WithSource(AfterDefault, NewEnvFileSource(filepath.Join(dir, ".env"))),
+		WithSource(AfterFiles, NewDirSource(cm, "server")),
+		WithSource(AfterDefault, NewHTTPSource(ts.URL, nil)),
+	)
+	require.NoError(t, err)
+
+	cases := []struct {
+		path   string
+		want   interface{}
+		origin string
+	}{
+		// the http source is overwritten by the value file
+		{"server.name", "file", "file " + filepath.Join(dir, "conf.yml") + ":2"},
+		{"server.timeout", "5s", "source http " + ts.URL},
+		{"server.port", 8080, "source dir " + cm},
+		{"server.tags", []interface{}{"a", "b"}, "source dir " + cm},
+		{"server.debug", true, "source envfile " + filepath.Join(dir, ".env")},
+		{"server.tls.cert", "a.crt", "source dir " + cm},
+		{"server.host", "example.com", "source envfile " + filepath.Join(dir, ".env")},
+		{"server.user", "to\"m", "source envfile " + filepath.Join(dir, ".env")},
+		{"server.empty", "def", "default"},
+	}
+	for i, c := range cases {
+		assert.Equal(t, c.want, cf.MustGetRaw(c.path), fmt.Sprintf("case-%d", i))
+
+		got, err := cf.Explain(c.path)
+		require.NoError(t, err, fmt.Sprintf("case-%d", i))
+		assert.Equal(t, c.origin, got[0].Origin.String(), fmt.Sprintf("case-%d", i))
+	}
+	assert.False(t, cf.IsSet("OTHER"))
+
+	// the strings are converted by the types of the fields
+	var got config
+	require.NoError(t, cf.Read("server", &got))
+	assert.Equal(t, config{Name: "file", Port: 8080, Host: "example.com", User: "to\"m", Empty: "def", Debug: true, Tags: []string{"a", "b"}}, got)
+
+	// the source at AfterFlags is overwritten by override only
+	cf, err = parse(WithSource(AfterFlags, NewDirSource(cm, "server")), WithOverrideYaml("server", "port: 1"))
+	require.NoError(t, err)
+	assert.Equal(t, "a.crt", cf.MustGetRaw("server.tls.cert"))
+	assert.Equal(t, 1, cf.GetIntDef("server.port", 0))
+
+	// errors
+	status = http.StatusInternalServerError
+	_, err = parse(WithSource(AfterEnv, NewHTTPSource(ts.URL, nil)))
+	assert.ErrorContains(t, err, "unexpected status")
+
+	// the hung endpoint is timed out, even with a client without timeout
+	hung := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer hung.Close()
+	defer func(d time.Duration) { httpSourceTimeout = d }(httpSourceTimeout)
+	httpSourceTimeout = 100 * time.Millisecond
+	_, err = parse(WithSource(AfterEnv, NewHTTPSource(hung.URL, &http.Client{})))
+	assert.ErrorContains(t, err, "deadline exceeded")
+
+	_, err = parse(WithSource(AfterEnv, NewDirSource(filepath.Join(dir, "unknown"), "")))
+	assert.Error(t, err)
+
+	bad := filepath.Join(dir, "bad")
+	require.NoError(t, os.MkdirAll(bad, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(bad, "port"), []byte("abc"), 0644))
+	_, err = parse(WithSource(AfterFiles, NewDirSource(bad, "server")))
+	assert.ErrorContains(t, err, "failed to read dir "+bad+": server.port")
+
+	envs, err := NewEnvFileSource(filepath.Join(dir, ".env")).Values()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"TEST_SOURCE_HOST":  "example.com",
+		"TEST_SOURCE_USER":  "to\"m",
+		"TEST_SOURCE_EMPTY": "",
+		"TEST_SOURCE_DEBUG": "true",
+		"OTHER":             "x",
+	}, envs)
+
+	_, err = parseEnvFile(".env", []byte("FOO"))
+	assert.ErrorContains(t, err, ".env:1: invalid line")
+}
+
+func TestSecret(t *testing.T) {
+	dir := createTestDir([]templateFile{
+		{"conf.yml", "db:\n  dsn: \"user:${secret:password}@tcp(${secret:host})\"\n  tokens: [\"${secret:token}\", b]\n  name: foo"},
+		{"password", "pass\n"},
+		{"host", "127.0.0.1"},
+		{"token", "a"},
+	})
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "conf.yml")
+
+	// not resolved without the resolver
+	cf, err := New().Parse(WithValueFile(file))
+	require.NoError(t, err)
+	assert.Equal(t, "user:${secret:password}@tcp(${secret:host})", cf.MustGetRaw("db.dsn"))
+
+	cf, err = New().Parse(WithValueFile(file), WithSecretResolver(NewDirSecretResolver(dir)))
+	require.NoError(t, err)
+	assert.Equal(t, "user:pass@tcp(127.0.0.1)", cf.MustGetRaw("db.dsn"))
+	assert.Equal(t, []interface{}{"a", "b"}, cf.MustGetRaw("db.tokens"))
+
+	// the secret is masked
+	assert.Equal(t, `db.dsn: "******" # file `+file+`:2 (secret)
+db.name: "foo" # file `+file+`:4
+db.tokens: "******" # file `+file+`:3 (secret)
+`, cf.ExplainString())
+
+	// the secret is resolved again by reload
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "password"), []byte("pass2"), 0644))
+	require.NoError(t, cf.Reload())
+	assert.Equal(t, "user:pass2@tcp(127.0.0.1)", cf.MustGetRaw("db.dsn"))
+
+	// errors
+	_, err = New().Parse(WithValueFile(file), WithSecretResolver(SecretResolverFunc(func(name string) (string, error) {
+		return "", errors.New("not found")
+	})))
+	assert.ErrorContains(t, err, "db.dsn: not found")
+
+	_, err = NewDirSecretResolver(dir).Resolve("../password")
+	assert.Error(t, err)
+}
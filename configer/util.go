@@ -110,6 +110,35 @@ func clonePath(path []string) []string {
 	return ret
 }
 
+// cloneValues returns a deep copy of the maps and slices in values,
+// mergeValues modifies the maps in place
+func cloneValues(values map[string]interface{}) map[string]interface{} {
+	if values == nil {
+		return nil
+	}
+
+	ret := make(map[string]interface{}, len(values))
+	for k, v := range values {
+		ret[k] = cloneValue(v)
+	}
+	return ret
+}
+
+func cloneValue(in interface{}) interface{} {
+	switch v := in.(type) {
+	case map[string]interface{}:
+		return cloneValues(v)
+	case []interface{}:
+		ret := make([]interface{}, len(v))
+		for i := range v {
+			ret[i] = cloneValue(v[i])
+		}
+		return ret
+	default:
+		return v
+	}
+}
+
 func objToValues(in interface{}) (map[string]interface{}, error) {
 	b, err := yaml.Marshal(in)
 	if err != nil {
@@ -174,6 +203,7 @@ type FieldTag struct {
 	Env         string   // env:"{env}"
 	Description string   // description:"{description}"
 	Deprecated  string   // deprecated:""
+	Enum        []string // enum:"{value1},{value2}"
 }
 
 func (p FieldTag) String() string {
@@ -215,6 +245,9 @@ func GetFieldTag(sf reflect.StructField) (tag *FieldTag) {
 	tag.Default = sf.Tag.Get("default")
 	tag.Description = sf.Tag.Get("description")
 	tag.Deprecated = sf.Tag.Get("deprecated")
+	if enum := strings.TrimSpace(sf.Tag.Get("enum")); enum != "" {
+		tag.Enum = strings.Split(enum, ",")
+	}
 	tag.Env = strings.Replace(strings.ToUpper(sf.Tag.Get("env")), "-", "_", -1)
 	if tag.Env != "" {
 		tag.Description = fmt.Sprintf("%s (env %s)", tag.Description, tag.Env)
@@ -335,12 +368,14 @@ func ToFloat64SliceE(i interface{}) ([]float64, error) {
 
 type configField struct {
 	fs           *pflag.FlagSet
-	envName      string      // env name
-	flag         string      // flag
-	shothand     string      // flag shothand
-	configPath   string      // config path
-	flagValue    interface{} // flag's value
-	defaultValue interface{} // field's default value
+	envName      string       // env name
+	flag         string       // flag
+	shothand     string       // flag shothand
+	configPath   string       // config path
+	flagValue    interface{}  // flag's value
+	defaultValue interface{}  // field's default value
+	schema       *Schema      // json schema of the field
+	typ          reflect.Type // the type of the field, used to convert the string values
 }
 
 func (f configField) getFlagValue() interface{} {
@@ -351,6 +386,54 @@ func (f configField) getFlagValue() interface{} {
 	return nil
 }
 
+// convert converts the string of the env or the source to the type of the field, like the flag value,
+// e.g. "8080" -> 8080, the string is kept for the types which are decoded from the string
+func (f configField) convert(s string) (interface{}, error) {
+	rt := f.typ
+	if rt == nil || rt == durationType || reflect.PtrTo(rt).Implements(pflagValueType) {
+		return s, nil
+	}
+
+	switch rt.Kind() {
+	case reflect.Bool:
+		return util.ToBoolE(s)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return util.ToIntE(s)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return util.ToUint64E(s)
+	case reflect.Float32, reflect.Float64:
+		return util.ToFloat64E(s)
+	case reflect.Slice:
+		switch rt.Elem().Kind() {
+		case reflect.String:
+			return toInterfaces(ToStringArrayVar(s)), nil
+		case reflect.Int:
+			return toInterfaces(ToIntSlice(s)), nil
+		case reflect.Float64:
+			return toInterfaces(ToFloat64Slice(s)), nil
+		}
+	case reflect.Map:
+		if rt.Key().Kind() == reflect.String && rt.Elem().Kind() == reflect.String {
+			m := map[string]interface{}{}
+			for k, v := range ToStringMapString(s) {
+				m[k] = v
+			}
+			return m, nil
+		}
+	}
+
+	return s, nil
+}
+
+// toInterfaces returns the list like the one decoded from yaml
+func toInterfaces[T any](in []T) []interface{} {
+	out := make([]interface{}, len(in))
+	for i, v := range in {
+		out[i] = v
+	}
+	return out
+}
+
 type defaultSetter interface {
 	SetDefault(string) error
 }
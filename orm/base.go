@@ -4,8 +4,10 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"time"
 
 	"github.com/yubo/golib/api/errors"
+	"github.com/yubo/golib/watch"
 	"k8s.io/klog/v2"
 )
 
@@ -15,44 +17,62 @@ func NewBaseInterface(driver Driver, db RawDB, opts *DBOptions) Interface {
 	if driver == nil {
 		driver = &nonDriver{}
 	}
-	return &baseInterface{opts, driver, db}
+	return &baseInterface{DBOptions: opts, Driver: driver, db: db}
 }
 
-func newRawDBWrapper(db RawDB) RawDB {
-	return &rawDBWrapper{db}
+func newRawDBWrapper(db RawDB, dialect Dialect, hooks []Hook) RawDB {
+	if dialect == nil {
+		dialect = DefaultDialect
+	}
+	return &rawDBWrapper{db, dialect, hooks}
 }
 
 type rawDBWrapper struct {
-	db RawDB
+	db      RawDB
+	dialect Dialect
+	hooks   []Hook
 }
 
 func (p *rawDBWrapper) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
-	if err := p.prepareInterpolateParams(ctx, &query, &args); err != nil {
+	e, err := p.prepareInterpolateParams(ctx, query, args)
+	if err != nil {
 		return nil, err
 	}
-	return p.db.ExecContext(ctx, query, args...)
+
+	ctx = p.beforeQuery(ctx, e)
+	ret, err := p.db.ExecContext(ctx, p.dialect.Rebind(e.Query), e.Args...)
+	if len(p.hooks) > 0 && err == nil {
+		e.Rows, _ = ret.RowsAffected()
+	}
+	p.afterQuery(ctx, e, err)
+
+	return ret, err
 }
 
 func (p *rawDBWrapper) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
-	if err := p.prepareInterpolateParams(ctx, &query, &args); err != nil {
+	e, err := p.prepareInterpolateParams(ctx, query, args)
+	if err != nil {
 		return nil, err
 	}
 
-	return p.db.QueryContext(ctx, query, args...)
+	ctx = p.beforeQuery(ctx, e)
+	ret, err := p.db.QueryContext(ctx, p.dialect.Rebind(e.Query), e.Args...)
+	p.afterQuery(ctx, e, err)
+
+	return ret, err
 }
 
-func (p *rawDBWrapper) prepareInterpolateParams(ctx context.Context, query *string, args *[]interface{}) error {
-	query_, args_, err := prepareInterpolateParams(*query, *args)
+func (p *rawDBWrapper) prepareInterpolateParams(ctx context.Context, query string, args []interface{}) (*QueryEvent, error) {
+	query_, args_, err := prepareInterpolateParams(query, args)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	*query = query_
-	*args = args_
+	e := newQueryEvent(query_, args_)
 
 	if out := SqlOutFrom(ctx); out != nil || DEBUG {
 		sql, err := interpolateParams(query_, args_)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		if out != nil {
 			out(sql)
@@ -62,13 +82,41 @@ func (p *rawDBWrapper) prepareInterpolateParams(ctx context.Context, query *stri
 		}
 	}
 
-	return nil
+	return e, nil
+}
+
+func (p *rawDBWrapper) beforeQuery(ctx context.Context, e *QueryEvent) context.Context {
+	if len(p.hooks) == 0 {
+		return ctx
+	}
+
+	for _, hook := range p.hooks {
+		ctx = hook.BeforeQuery(ctx, e)
+	}
+	e.Start = time.Now()
+
+	return ctx
+}
+
+func (p *rawDBWrapper) afterQuery(ctx context.Context, e *QueryEvent, err error) {
+	if len(p.hooks) == 0 {
+		return
+	}
+
+	e.Duration = time.Since(e.Start)
+	e.Err = err
+	for _, hook := range p.hooks {
+		hook.AfterQuery(ctx, e)
+	}
 }
 
 type baseInterface struct {
 	*DBOptions
 	Driver
 	db RawDB
+
+	// the pending changes of the Tx, see WithWatchAfterCommit
+	pending *pendingChanges
 }
 
 func (p *baseInterface) RawDB() RawDB {
@@ -173,7 +221,18 @@ func (p *baseInterface) Insert(ctx context.Context, sample interface{}, opts ...
 		return err
 	}
 
-	return p.execNumErr(ctx, query, args...)
+	// the affected rows of upsert may be 0 if nothing changed
+	if o.upsert {
+		_, err = p.Exec(ctx, query, args...)
+	} else {
+		err = p.execNumErr(ctx, query, args...)
+	}
+	if err != nil {
+		return err
+	}
+
+	p.emit(ctx, watch.Added, o.Table(), sample, nil)
+	return nil
 }
 
 func (p *baseInterface) InsertLastId(ctx context.Context, sample interface{}, opts ...QueryOption) (int64, error) {
@@ -187,7 +246,71 @@ func (p *baseInterface) InsertLastId(ctx context.Context, sample interface{}, op
 		return 0, err
 	}
 
-	return p.execLastId(ctx, query, args...)
+	var id int64
+	if d := dialectOf(p.Driver); d.Returning() {
+		id, err = p.insertReturningId(ctx, d, o, query, args...)
+	} else {
+		id, err = p.execLastId(ctx, query, args...)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	p.emit(ctx, watch.Added, o.Table(), sample, nil)
+	return id, nil
+}
+
+// insertReturningId used for the driver which does not support LastInsertId, e.g. postgres
+// INSERT INTO ... RETURNING <auto_increment field>
+func (p *baseInterface) insertReturningId(ctx context.Context, d Dialect, o *queryOptions, query string, args ...interface{}) (int64, error) {
+	var field *StructField
+	for _, f := range GetFields(o.Sample(), p.Driver).Fields {
+		if f.AutoIncrement {
+			field = f
+			break
+		}
+		if f.PrimaryKey && field == nil {
+			field = f
+		}
+	}
+	if field == nil {
+		return 0, fmt.Errorf("unable to get the insert id, auto_increment or primary_key field is not set")
+	}
+
+	// it's a write, should not be sent to the replicas
+	var id int64
+	if err := p.query(WithPrimary(ctx), query+" RETURNING "+d.Quote(field.Name), args...).Row(&id); err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// InsertBatch insert the slice of struct with multi-row statements,
+// the statements are executed one by one, use it in a Tx if it should be atomic
+func (p *baseInterface) InsertBatch(ctx context.Context, samples interface{}, opts ...QueryOption) error {
+	o, err := NewOptions(append(opts, WithSample(samples))...)
+	if err != nil {
+		return err
+	}
+
+	if o.table == "" {
+		o.table = typeOfArray(samples)
+	}
+
+	queries, args, err := o.GenInsertBatchSql(p)
+	if err != nil {
+		return err
+	}
+
+	for i := range queries {
+		if _, err := p.Exec(ctx, queries[i], args[i]...); err != nil {
+			return err
+		}
+	}
+
+	p.emitBatch(ctx, o.Table(), samples)
+	return nil
 }
 
 func (p *baseInterface) List(ctx context.Context, into interface{}, opts ...QueryOption) error {
@@ -196,11 +319,15 @@ func (p *baseInterface) List(ctx context.Context, into interface{}, opts ...Quer
 		return err
 	}
 
+	if err := p.encryptSelector(o); err != nil {
+		return err
+	}
+
 	if o.table == "" {
 		o.table = typeOfArray(into)
 	}
 
-	querySql, countSql, args, err := o.GenListSql()
+	querySql, countSql, args, countArgs, err := o.GenListSql(p)
 	if err != nil {
 		return err
 	}
@@ -209,16 +336,39 @@ func (p *baseInterface) List(ctx context.Context, into interface{}, opts ...Quer
 	//	*o.output, _ =
 	//}
 
+	ttl := p.cacheTTL(ctx, o)
+	var key queryCacheKey
+	if ttl > 0 {
+		key = p.cache.key(o.Table(), querySql, args)
+		if p.cache.get(key, into, o) {
+			return nil
+		}
+	}
+
 	if err := p.query(ctx, querySql, args...).Rows(into); err != nil {
 		return err
 	}
 
+	if o.next != nil {
+		if *o.next, err = o.nextCursor(into); err != nil {
+			return err
+		}
+	}
+
+	if err := p.preload(ctx, o, into); err != nil {
+		return err
+	}
+
 	if o.total != nil {
-		if err := p.query(ctx, countSql, args...).Row(o.total); err != nil {
+		if err := p.query(ctx, countSql, countArgs...).Row(o.total); err != nil {
 			return err
 		}
 	}
 
+	if ttl > 0 {
+		p.cache.add(key, into, o, ttl)
+	}
+
 	return nil
 }
 
@@ -228,12 +378,33 @@ func (p *baseInterface) Get(ctx context.Context, into interface{}, opts ...Query
 		return err
 	}
 
-	query, args, err := o.GenGetSql()
+	if err := p.encryptSelector(o); err != nil {
+		return err
+	}
+
+	query, args, err := o.GenGetSql(p)
 	if err != nil {
 		return err
 	}
 
-	return o.Error(p.query(ctx, query, args...).Row(into))
+	ttl := p.cacheTTL(ctx, o)
+	var key queryCacheKey
+	if ttl > 0 {
+		key = p.cache.key(o.Table(), query, args)
+		if p.cache.get(key, into, o) {
+			return nil
+		}
+	}
+
+	if err := p.query(ctx, query, args...).Row(into); err != nil {
+		return o.Error(err)
+	}
+
+	if ttl > 0 {
+		p.cache.add(key, into, o, ttl)
+	}
+
+	return p.preload(ctx, o, into)
 }
 
 func (p *baseInterface) Update(ctx context.Context, sample interface{}, opts ...QueryOption) error {
@@ -241,13 +412,38 @@ func (p *baseInterface) Update(ctx context.Context, sample interface{}, opts ...
 	if err != nil {
 		return err
 	}
+	selector := o.Selector()
+
+	if err := p.encryptSelector(o); err != nil {
+		return err
+	}
 
 	query, args, err := o.GenUpdateSql(p)
 	if err != nil {
 		return err
 	}
 
-	return o.Error(p.execNumErr(ctx, query, args...))
+	fv, ok := versionValue(sample, p.Driver)
+	if !ok {
+		if err := p.execNumErr(ctx, query, args...); err != nil {
+			return o.Error(err)
+		}
+		p.emit(ctx, watch.Modified, o.Table(), sample, selector)
+		return nil
+	}
+
+	version := versionOf(fv)
+	if err := p.execNumErr(ctx, query, args...); err != nil {
+		if errors.IsNotFound(err) {
+			return errors.NewConflict(o.Table(), fmt.Errorf("the object has been modified, version %d is not found", version))
+		}
+		return err
+	}
+
+	setVersion(fv, version+1)
+	p.emit(ctx, watch.Modified, o.Table(), sample, selector)
+
+	return nil
 }
 
 func (p *baseInterface) Delete(ctx context.Context, sample interface{}, opts ...QueryOption) error {
@@ -255,11 +451,21 @@ func (p *baseInterface) Delete(ctx context.Context, sample interface{}, opts ...
 	if err != nil {
 		return err
 	}
+	selector := o.Selector()
 
-	query, args, err := o.GenDeleteSql()
+	if err := p.encryptSelector(o); err != nil {
+		return err
+	}
+
+	query, args, err := o.GenDeleteSql(p)
 	if err != nil {
 		return err
 	}
 
-	return o.Error(p.execNumErr(ctx, query, args...))
+	if err := p.execNumErr(ctx, query, args...); err != nil {
+		return o.Error(err)
+	}
+
+	p.emit(ctx, watch.Deleted, o.Table(), sample, selector)
+	return nil
 }
@@ -0,0 +1,540 @@
+package orm
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// Format is the file format of Export and Import
+type Format string
+
+const (
+	// CSV the first line is the header of the column names,
+	// the NULL is exported as an empty string
+	CSV Format = "csv"
+	// NDJSON the newline-delimited json, one object per line
+	NDJSON Format = "ndjson"
+)
+
+const defaultBulkBatchSize = 500
+
+type bulkOptions struct {
+	queryOptions []QueryOption
+	batchSize    int
+	progress     func(rows int64)
+}
+
+type BulkOption func(*bulkOptions)
+
+func newBulkOptions(opts ...BulkOption) *bulkOptions {
+	o := &bulkOptions{batchSize: defaultBulkBatchSize}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(o)
+		}
+	}
+	return o
+}
+
+// WithBulkQuery set the query options of Export and Import,
+// e.g. WithTable, WithSelector, WithOrderby for Export, WithTable, WithUpsert for Import
+func WithBulkQuery(opts ...QueryOption) BulkOption {
+	return func(o *bulkOptions) {
+		o.queryOptions = append(o.queryOptions, opts...)
+	}
+}
+
+// WithBatchSize set the number of the rows inserted in one transaction of Import,
+// and the interval of the progress callback, default is 500
+func WithBatchSize(n int) BulkOption {
+	return func(o *bulkOptions) {
+		if n > 0 {
+			o.batchSize = n
+		}
+	}
+}
+
+// WithProgress set the callback which is called with the number of the rows
+// exported or imported so far, after each batch and at the end
+func WithProgress(progress func(rows int64)) BulkOption {
+	return func(o *bulkOptions) {
+		o.progress = progress
+	}
+}
+
+// bulkFields returns the fields of the columns, in the order of the struct or WithCols
+func bulkFields(rt reflect.Type, db Driver, cols []string) ([]*StructField, error) {
+	fields := cachedTypeFields(rt, db)
+	if len(cols) == 0 {
+		return fields.Fields, nil
+	}
+
+	ret := make([]*StructField, 0, len(cols))
+	for _, col := range cols {
+		i, ok := fields.nameIndex[col]
+		if !ok {
+			return nil, fmt.Errorf("column %s not found in %s", col, rt)
+		}
+		ret = append(ret, fields.Fields[i])
+	}
+	return ret, nil
+}
+
+// Export writes the rows of the table of the sample to w without loading them into memory,
+// the columns are the fields of the sample, e.g.
+//
+//	n, err := orm.Export(ctx, db, w, orm.CSV, &User{}, orm.WithBulkQuery(orm.WithSelector("age>18")))
+func Export(ctx context.Context, db Interface, w io.Writer, format Format, sample interface{}, opts ...BulkOption) (int64, error) {
+	o := newBulkOptions(opts...)
+
+	rt, ok := structTypeOf(sample)
+	if !ok {
+		return 0, fmt.Errorf("export: unsupported type %T, it should be a pointer to a struct", sample)
+	}
+
+	qo, err := NewOptions(append(o.queryOptions, WithSample(sample))...)
+	if err != nil {
+		return 0, err
+	}
+
+	fields, err := bulkFields(rt, db, qo.cols)
+	if err != nil {
+		return 0, err
+	}
+
+	enc, err := newBulkEncoder(w, format, fields)
+	if err != nil {
+		return 0, err
+	}
+
+	// the deterministic fields are selected by the ciphertexts, like List
+	if qo._selector != nil {
+		if qo._selector, err = encryptSelector(qo._selector, cachedTypeFields(rt, db), keyringOf(db)); err != nil {
+			return 0, err
+		}
+	}
+
+	query, _, args, _, err := qo.GenListSql(db)
+	if err != nil {
+		return 0, err
+	}
+
+	rows := db.Query(ctx, query, args...)
+	it, err := rows.Iterator()
+	if err != nil {
+		return 0, err
+	}
+	defer it.Close()
+
+	var n int64
+	for it.Next() {
+		row := reflect.New(rt)
+		if err := it.Row(row.Interface()); err != nil {
+			return n, err
+		}
+
+		if err := enc.encode(row.Elem()); err != nil {
+			return n, err
+		}
+
+		if n++; o.progress != nil && n%int64(o.batchSize) == 0 {
+			o.progress(n)
+		}
+	}
+	if err := rows.rows.Err(); err != nil {
+		return n, err
+	}
+
+	if err := enc.flush(); err != nil {
+		return n, err
+	}
+
+	if o.progress != nil && n%int64(o.batchSize) != 0 {
+		o.progress(n)
+	}
+
+	return n, nil
+}
+
+// Import reads the rows from r and inserts them into the table of the sample,
+// each batch of WithBatchSize is inserted in a transaction, the imported rows are returned
+// if an error occurs, the failed batch is rolled back, e.g.
+//
+//	n, err := orm.Import(ctx, db, r, orm.NDJSON, &User{}, orm.WithBatchSize(1000))
+func Import(ctx context.Context, db DB, r io.Reader, format Format, sample interface{}, opts ...BulkOption) (int64, error) {
+	o := newBulkOptions(opts...)
+
+	rt, ok := structTypeOf(sample)
+	if !ok {
+		return 0, fmt.Errorf("import: unsupported type %T, it should be a pointer to a struct", sample)
+	}
+
+	qo, err := NewOptions(append(o.queryOptions, WithSample(sample))...)
+	if err != nil {
+		return 0, err
+	}
+	insertOpts := append(append([]QueryOption{}, o.queryOptions...), WithTable(qo.Table()))
+
+	dec, err := newBulkDecoder(r, format, cachedTypeFields(rt, db))
+	if err != nil {
+		return 0, err
+	}
+
+	var n int64
+	batch := reflect.MakeSlice(reflect.SliceOf(rt), 0, o.batchSize)
+	insert := func() error {
+		if batch.Len() == 0 {
+			return nil
+		}
+
+		err := db.Transaction(ctx, func(ctx context.Context) error {
+			return db.InsertBatch(ctx, batch.Interface(), insertOpts...)
+		})
+		if err != nil {
+			return fmt.Errorf("import rows %d-%d: %s", n+1, n+int64(batch.Len()), err)
+		}
+
+		n += int64(batch.Len())
+		batch = batch.Slice(0, 0)
+		if o.progress != nil {
+			o.progress(n)
+		}
+		return nil
+	}
+
+	for {
+		row := reflect.New(rt).Elem()
+		if err := dec.decode(row); err == io.EOF {
+			break
+		} else if err != nil {
+			return n, fmt.Errorf("import row %d: %s", n+int64(batch.Len())+1, err)
+		}
+
+		// the array of the batch is reused after it's inserted
+		batch = reflect.Append(batch, row)
+		if batch.Len() >= o.batchSize {
+			if err := insert(); err != nil {
+				return n, err
+			}
+		}
+	}
+
+	return n, insert()
+}
+
+type bulkEncoder interface {
+	encode(row reflect.Value) error
+	flush() error
+}
+
+type bulkDecoder interface {
+	// decode reads the next row, returns io.EOF at the end
+	decode(row reflect.Value) error
+}
+
+func newBulkEncoder(w io.Writer, format Format, fields []*StructField) (bulkEncoder, error) {
+	switch format {
+	case CSV:
+		e := &csvEncoder{w: csv.NewWriter(w), fields: fields}
+		header := make([]string, len(fields))
+		for i, f := range fields {
+			header[i] = f.Name
+		}
+		return e, e.w.Write(header)
+	case NDJSON:
+		return &ndjsonEncoder{w: bufio.NewWriter(w), fields: fields}, nil
+	}
+	return nil, fmt.Errorf("unsupported format %q", format)
+}
+
+func newBulkDecoder(r io.Reader, format Format, fields StructFields) (bulkDecoder, error) {
+	switch format {
+	case CSV:
+		d := &csvDecoder{r: csv.NewReader(r)}
+		header, err := d.r.Read()
+		if err == io.EOF {
+			return d, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		// the unknown columns are ignored
+		for _, name := range header {
+			if i, ok := fields.nameIndex[name]; ok {
+				d.fields = append(d.fields, fields.Fields[i])
+			} else {
+				d.fields = append(d.fields, nil)
+			}
+		}
+		return d, nil
+	case NDJSON:
+		return &ndjsonDecoder{d: json.NewDecoder(r), fields: fields}, nil
+	}
+	return nil, fmt.Errorf("unsupported format %q", format)
+}
+
+type csvEncoder struct {
+	w      *csv.Writer
+	fields []*StructField
+	record []string
+}
+
+func (p *csvEncoder) encode(row reflect.Value) error {
+	p.record = p.record[:0]
+	for _, f := range p.fields {
+		fv, err := getSubv(row, f.Index, false)
+		if err != nil || IsNil(fv) {
+			p.record = append(p.record, "")
+			continue
+		}
+
+		s, err := formatBulkValue(f, fv)
+		if err != nil {
+			return fmt.Errorf("column %s: %s", f.Name, err)
+		}
+		p.record = append(p.record, s)
+	}
+
+	return p.w.Write(p.record)
+}
+
+func (p *csvEncoder) flush() error {
+	p.w.Flush()
+	return p.w.Error()
+}
+
+type csvDecoder struct {
+	r      *csv.Reader
+	fields []*StructField // nil for the unknown column
+}
+
+func (p *csvDecoder) decode(row reflect.Value) error {
+	if p.fields == nil {
+		return io.EOF
+	}
+
+	record, err := p.r.Read()
+	if err != nil {
+		return err
+	}
+
+	for i, s := range record {
+		f := p.fields[i]
+		if f == nil {
+			continue
+		}
+
+		fv, err := getSubv(row, f.Index, true)
+		if err != nil {
+			return err
+		}
+
+		if err := parseBulkValue(f, fv, s); err != nil {
+			return fmt.Errorf("column %s: %s", f.Name, err)
+		}
+	}
+
+	return nil
+}
+
+type ndjsonEncoder struct {
+	w      *bufio.Writer
+	fields []*StructField
+}
+
+// encode writes the object with the keys in the order of the fields
+func (p *ndjsonEncoder) encode(row reflect.Value) error {
+	p.w.WriteByte('{')
+	for i, f := range p.fields {
+		if i > 0 {
+			p.w.WriteByte(',')
+		}
+
+		var v interface{}
+		if fv, err := getSubv(row, f.Index, false); err == nil {
+			v = fv.Interface()
+		}
+
+		name, _ := json.Marshal(f.Name)
+		b, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Errorf("column %s: %s", f.Name, err)
+		}
+
+		p.w.Write(name)
+		p.w.WriteByte(':')
+		p.w.Write(b)
+	}
+	p.w.WriteString("}\n")
+
+	return nil
+}
+
+func (p *ndjsonEncoder) flush() error {
+	return p.w.Flush()
+}
+
+type ndjsonDecoder struct {
+	d      *json.Decoder
+	fields StructFields
+}
+
+func (p *ndjsonDecoder) decode(row reflect.Value) error {
+	obj := map[string]json.RawMessage{}
+	if err := p.d.Decode(&obj); err != nil {
+		return err
+	}
+
+	for name, raw := range obj {
+		i, ok := p.fields.nameIndex[name]
+		if !ok {
+			continue
+		}
+		f := p.fields.Fields[i]
+
+		fv, err := getSubv(row, f.Index, true)
+		if err != nil {
+			return err
+		}
+
+		if err := json.Unmarshal(raw, fv.Addr().Interface()); err != nil {
+			return fmt.Errorf("column %s: %s", f.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// formatBulkValue returns the csv value of the field, fv should not be nil
+func formatBulkValue(f *StructField, fv reflect.Value) (string, error) {
+	if fv.Kind() == reflect.Ptr {
+		fv = fv.Elem()
+	}
+
+	if f.Codec != nil {
+		v, err := f.Codec.Encode(fv.Interface())
+		if err != nil {
+			return "", err
+		}
+		if b, ok := v.([]byte); ok {
+			return string(b), nil
+		}
+		return fmt.Sprint(v), nil
+	}
+
+	switch v := fv.Interface().(type) {
+	case time.Time:
+		return v.Format(time.RFC3339Nano), nil
+	case []byte:
+		return base64.StdEncoding.EncodeToString(v), nil
+	}
+
+	switch fv.Kind() {
+	case reflect.String:
+		return fv.String(), nil
+	case reflect.Bool:
+		return strconv.FormatBool(fv.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(fv.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(fv.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(fv.Float(), 'g', -1, fv.Type().Bits()), nil
+	}
+
+	// map, slice, struct are stored as json
+	b, err := json.Marshal(fv.Interface())
+	return string(b), err
+}
+
+// parseBulkValue sets the csv value to the field, the empty string is NULL of the pointer field
+func parseBulkValue(f *StructField, fv reflect.Value, s string) error {
+	if fv.Kind() == reflect.Ptr {
+		if s == "" {
+			fv.Set(reflect.Zero(fv.Type()))
+			return nil
+		}
+		fv.Set(reflect.New(fv.Type().Elem()))
+		fv = fv.Elem()
+	}
+
+	// NULL of the codec field is the zero value, see transfer.unmarshal
+	if f.Codec != nil {
+		if s == "" {
+			return nil
+		}
+		return f.Codec.Decode([]byte(s), fv.Addr().Interface())
+	}
+
+	switch fv.Interface().(type) {
+	case time.Time:
+		if s == "" {
+			return nil
+		}
+		t, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return err
+		}
+		fv.Set(reflect.ValueOf(t))
+		return nil
+	case []byte:
+		if s == "" {
+			return nil
+		}
+		b, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return err
+		}
+		fv.SetBytes(b)
+		return nil
+	}
+
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(s)
+		return nil
+	}
+
+	if s == "" {
+		return nil
+	}
+
+	switch fv.Kind() {
+	case reflect.Bool:
+		v, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		fv.SetBool(v)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v, err := strconv.ParseInt(s, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetInt(v)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v, err := strconv.ParseUint(s, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetUint(v)
+	case reflect.Float32, reflect.Float64:
+		v, err := strconv.ParseFloat(s, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetFloat(v)
+	default:
+		return json.Unmarshal([]byte(s), fv.Addr().Interface())
+	}
+
+	return nil
+}
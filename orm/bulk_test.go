@@ -0,0 +1,174 @@
+package orm
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testBulk struct {
+	ID       int `sql:"primary_key"`
+	Name     string
+	Nick     *string
+	Active   bool
+	Score    float64
+	Avatar   []byte
+	Labels   map[string]string `sql:"type=json"`
+	Birthday time.Time
+}
+
+func TestExportImport(t *testing.T) {
+	runTests(t, func(db DB, ctx context.Context) {
+		require.NoError(t, db.AutoMigrate(ctx, &testBulk{}, WithTable("test")))
+		defer db.Exec(ctx, "DROP TABLE IF EXISTS test_import")
+
+		nick := "t,\"om\"\n"
+		birthday := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+		rows := []testBulk{
+			{ID: 1, Name: "tom", Nick: &nick, Active: true, Score: 1.5, Avatar: []byte{0, 1}, Labels: map[string]string{"a": "b"}, Birthday: birthday},
+			{ID: 2, Name: "jerry", Birthday: birthday},
+			{ID: 3, Name: "", Birthday: birthday},
+		}
+		require.NoError(t, db.InsertBatch(ctx, rows, WithTable("test")))
+
+		for i, format := range []Format{CSV, NDJSON} {
+			db.Exec(ctx, "DROP TABLE IF EXISTS test_import")
+			require.NoError(t, db.AutoMigrate(ctx, &testBulk{}, WithTable("test_import")), fmt.Sprintf("case-%d", i))
+
+			var buf bytes.Buffer
+			var progress []int64
+			n, err := Export(ctx, db, &buf, format, &testBulk{},
+				WithBulkQuery(WithTable("test"), WithOrderby("id")),
+				WithBatchSize(2),
+				WithProgress(func(n int64) { progress = append(progress, n) }))
+			require.NoError(t, err, fmt.Sprintf("case-%d", i))
+			assert.Equal(t, int64(3), n, fmt.Sprintf("case-%d", i))
+			assert.Equal(t, []int64{2, 3}, progress, fmt.Sprintf("case-%d", i))
+
+			progress = nil
+			n, err = Import(ctx, db, &buf, format, &testBulk{},
+				WithBulkQuery(WithTable("test_import")),
+				WithBatchSize(2),
+				WithProgress(func(n int64) { progress = append(progress, n) }))
+			require.NoError(t, err, fmt.Sprintf("case-%d", i))
+			assert.Equal(t, int64(3), n, fmt.Sprintf("case-%d", i))
+			assert.Equal(t, []int64{2, 3}, progress, fmt.Sprintf("case-%d", i))
+
+			var got []testBulk
+			require.NoError(t, db.List(ctx, &got, WithTable("test_import"), WithOrderby("id")), fmt.Sprintf("case-%d", i))
+			require.Len(t, got, 3, fmt.Sprintf("case-%d", i))
+			for j := range rows {
+				assert.True(t, rows[j].Birthday.Equal(got[j].Birthday), fmt.Sprintf("case-%d-%d", i, j))
+				got[j].Birthday = rows[j].Birthday
+			}
+			assert.Equal(t, rows, got, fmt.Sprintf("case-%d", i))
+		}
+	})
+}
+
+func TestExport(t *testing.T) {
+	runTests(t, func(db DB, ctx context.Context) {
+		type test struct {
+			ID   int `sql:"primary_key"`
+			Name string
+			Age  *int
+		}
+		require.NoError(t, db.AutoMigrate(ctx, &test{}))
+
+		age := 10
+		require.NoError(t, db.InsertBatch(ctx, []test{{1, "tom", &age}, {2, "jerry", nil}, {3, "spike", nil}}))
+
+		cases := []struct {
+			format Format
+			opts   []QueryOption
+			want   string
+		}{
+			{CSV, nil, "id,name,age\n1,tom,10\n2,jerry,\n3,spike,\n"},
+			{CSV, []QueryOption{WithSelector("id>1"), WithCols("name", "id")}, "name,id\njerry,2\nspike,3\n"},
+			{NDJSON, []QueryOption{WithSelector("id in (1,2)")}, `{"id":1,"name":"tom","age":10}` + "\n" + `{"id":2,"name":"jerry","age":null}` + "\n"},
+		}
+		for i, c := range cases {
+			var buf bytes.Buffer
+			_, err := Export(ctx, db, &buf, c.format, &test{}, WithBulkQuery(append(c.opts, WithOrderby("id"))...))
+			require.NoError(t, err, fmt.Sprintf("case-%d", i))
+			assert.Equal(t, c.want, buf.String(), fmt.Sprintf("case-%d", i))
+		}
+
+		_, err := Export(ctx, db, &bytes.Buffer{}, "xml", &test{})
+		assert.Error(t, err, "unsupported format")
+
+		_, err = Export(ctx, db, &bytes.Buffer{}, CSV, &test{}, WithBulkQuery(WithCols("unknown")))
+		assert.Error(t, err, "unknown column")
+	})
+}
+
+func TestExportEncrypt(t *testing.T) {
+	if !testAvailable {
+		t.Skipf("SQL server not running on %s:%s", testDriver, testDsn)
+	}
+
+	type test struct {
+		ID    int    `sql:"primary_key"`
+		Email string `sql:"encrypt=deterministic"`
+	}
+
+	ctx := context.Background()
+	db, err := Open(testDriver, testDsn, WithKeyring(newTestKeyring(t, "k1")))
+	require.NoError(t, err)
+	defer db.Close()
+	defer db.Exec(ctx, "DROP TABLE IF EXISTS test")
+
+	require.NoError(t, db.AutoMigrate(ctx, &test{}))
+	require.NoError(t, db.InsertBatch(ctx, []test{{1, "tom"}, {2, "jerry"}}))
+
+	// the selector of the deterministic field matches the ciphertext
+	var buf bytes.Buffer
+	n, err := Export(ctx, db, &buf, CSV, &test{}, WithBulkQuery(WithSelector("email=jerry")))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+	assert.Equal(t, "id,email\n2,jerry\n", buf.String())
+}
+
+func TestImport(t *testing.T) {
+	runTests(t, func(db DB, ctx context.Context) {
+		type test struct {
+			ID   int `sql:"primary_key"`
+			Name string
+		}
+		require.NoError(t, db.AutoMigrate(ctx, &test{}))
+
+		cases := []struct {
+			format  Format
+			input   string
+			n       int64
+			wantErr bool
+		}{
+			{CSV, "", 0, false},
+			{CSV, "id,name,unknown\n1,tom,x\n2,jerry,y\n", 2, false},
+			{CSV, "name,id\nspike,3\nbad,x\n", 0, true},
+			// the first batch is imported
+			{CSV, "id,name\n4,a\n5,b\n6,c\n4,dup\n", 2, true},
+			{NDJSON, `{"id":7,"name":"x"}` + "\n" + `{"id":8}`, 2, false},
+			{NDJSON, `{"id":9,"name":1}`, 0, true},
+		}
+		for i, c := range cases {
+			n, err := Import(ctx, db, strings.NewReader(c.input), c.format, &test{}, WithBatchSize(2))
+			if c.wantErr {
+				assert.Error(t, err, fmt.Sprintf("case-%d", i))
+			} else {
+				assert.NoError(t, err, fmt.Sprintf("case-%d", i))
+			}
+			assert.Equal(t, c.n, n, fmt.Sprintf("case-%d", i))
+		}
+
+		var ids []int
+		require.NoError(t, db.Query(ctx, "SELECT id FROM test ORDER BY id").Rows(&ids))
+		assert.Equal(t, []int{1, 2, 4, 5, 7, 8}, ids)
+	})
+}
@@ -0,0 +1,139 @@
+package orm
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yubo/golib/util/cache"
+	"github.com/yubo/golib/util/telemetry"
+)
+
+var (
+	cacheHits = telemetry.NewCounter("orm", "cache_hits_total", []string{"table"},
+		"The number of the Get/List served by the query cache")
+	cacheMisses = telemetry.NewCounter("orm", "cache_misses_total", []string{"table"},
+		"The number of the Get/List which missed the query cache")
+)
+
+// queryCache caches the results of Get/List, see WithCache and WithTableCache.
+// The entries of a table are invalidated by increasing the generation of the table,
+// the stale entries are evicted by the lru. The methods are safe on the nil queryCache.
+type queryCache struct {
+	cache  *cache.LRUExpireCache
+	tables map[string]time.Duration
+
+	sync.RWMutex
+	generations map[string]uint64
+}
+
+type queryCacheKey struct {
+	table      string
+	generation uint64
+	query      string
+	args       string
+}
+
+// queryCacheEntry is the shallow copy of the result
+type queryCacheEntry struct {
+	value reflect.Value
+	total int
+	next  string
+}
+
+func newQueryCache(size int, tables map[string]time.Duration) *queryCache {
+	if size <= 0 {
+		return nil
+	}
+
+	return &queryCache{
+		cache:       cache.NewLRUExpireCache(size),
+		tables:      tables,
+		generations: map[string]uint64{},
+	}
+}
+
+// cacheTTL returns the ttl of the query, the query in a Tx or with the preload is not cached
+func (p *baseInterface) cacheTTL(ctx context.Context, o *queryOptions) time.Duration {
+	if p.DBOptions == nil || p.cache == nil || len(o.preload) > 0 || p.pendingFrom(ctx) != nil {
+		return 0
+	}
+
+	if o.cacheTTL != nil {
+		return *o.cacheTTL
+	}
+
+	return p.cache.tables[o.Table()]
+}
+
+func (p *queryCache) key(table, query string, args []interface{}) queryCacheKey {
+	p.RLock()
+	generation := p.generations[table]
+	p.RUnlock()
+
+	var b strings.Builder
+	for _, arg := range args {
+		fmt.Fprintf(&b, "%T:%v\x00", arg, arg)
+	}
+
+	return queryCacheKey{table: table, generation: generation, query: query, args: b.String()}
+}
+
+// get sets the cached result to dst, dst is the pointer of Get/List
+func (p *queryCache) get(key queryCacheKey, dst interface{}, o *queryOptions) bool {
+	v, ok := p.cache.Get(key)
+	if !ok {
+		cacheMisses.Inc(key.table)
+		return false
+	}
+	cacheHits.Inc(key.table)
+
+	e := v.(*queryCacheEntry)
+	reflect.ValueOf(dst).Elem().Set(cloneValue(e.value))
+	if o.total != nil {
+		*o.total = e.total
+	}
+	if o.next != nil {
+		*o.next = e.next
+	}
+
+	return true
+}
+
+func (p *queryCache) add(key queryCacheKey, src interface{}, o *queryOptions, ttl time.Duration) {
+	e := &queryCacheEntry{value: cloneValue(reflect.ValueOf(src).Elem())}
+	if o.total != nil {
+		e.total = *o.total
+	}
+	if o.next != nil {
+		e.next = *o.next
+	}
+
+	p.cache.Add(key, e, ttl)
+}
+
+func (p *queryCache) invalidate(table string) {
+	if p == nil {
+		return
+	}
+
+	p.Lock()
+	defer p.Unlock()
+	p.generations[table]++
+}
+
+// cloneValue returns a copy of v, the slice is copied to avoid the append on the cached array,
+// the pointers, maps and slices in the elements are shared
+func cloneValue(v reflect.Value) reflect.Value {
+	ret := reflect.New(v.Type()).Elem()
+	if v.Kind() == reflect.Slice && !v.IsNil() {
+		ret.Set(reflect.AppendSlice(reflect.MakeSlice(v.Type(), 0, v.Len()), v))
+		return ret
+	}
+
+	ret.Set(v)
+	return ret
+}
@@ -0,0 +1,108 @@
+package orm
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yubo/golib/util/telemetry"
+)
+
+type testCache struct {
+	ID    int `sql:"primary_key"`
+	Value string
+}
+
+func (testCache) Name() string { return "test" }
+
+func TestQueryCache(t *testing.T) {
+	if !testAvailable {
+		t.Skipf("SQL server not running on %s:%s", testDriver, testDsn)
+	}
+
+	db, err := Open(testDriver, testDsn, WithTableCache("test", time.Minute))
+	require.NoError(t, err)
+	defer db.Close()
+
+	var queries int
+	ctx := WithSqlOut(context.Background(), func(string) { queries++ })
+
+	db.Exec(ctx, "DROP TABLE IF EXISTS test")
+	defer db.Exec(ctx, "DROP TABLE IF EXISTS test")
+	require.NoError(t, db.AutoMigrate(ctx, &testCache{}))
+	require.NoError(t, db.InsertBatch(ctx, []testCache{{1, "tom"}, {2, "jerry"}}, WithTable("test")))
+
+	cases := []struct {
+		fn      func() error
+		queries int // the number of the executed sql
+	}{
+		{func() error { return db.Get(ctx, &testCache{}, WithSelector("id=1")) }, 1},
+		{func() error { return db.Get(ctx, &testCache{}, WithSelector("id=1")) }, 0},
+		{func() error { return db.Get(ctx, &testCache{}, WithSelector("id=2")) }, 1},
+		{func() error { return db.Get(ctx, &testCache{}, WithSelector("id=1"), WithCache(0)) }, 1},
+		{func() error { return db.List(ctx, &[]testCache{}, WithTable("test"), WithTotal(new(int))) }, 2},
+		{func() error { return db.List(ctx, &[]testCache{}, WithTable("test"), WithTotal(new(int))) }, 0},
+		// invalidated by the write
+		{func() error { return db.Update(ctx, &testCache{ID: 1, Value: "spike"}, WithSelector("id=1")) }, 1},
+		{func() error { return db.Get(ctx, &testCache{}, WithSelector("id=1")) }, 1},
+		{func() error { return db.Get(ctx, &testCache{}, WithSelector("id=2")) }, 1},
+		// the query in a Tx is not cached
+		{func() error {
+			return db.Transaction(ctx, func(ctx context.Context) error {
+				return db.Get(ctx, &testCache{}, WithSelector("id=1"))
+			})
+		}, 1},
+		// the other table without the default ttl
+		{func() error { return db.Get(ctx, &testCache{}, WithTable("test2"), WithSelector("id=1")) }, 1},
+	}
+	db.Exec(ctx, "CREATE TABLE test2 AS SELECT * FROM test")
+	defer db.Exec(ctx, "DROP TABLE IF EXISTS test2")
+
+	for i, c := range cases {
+		queries = 0
+		assert.NoError(t, c.fn(), fmt.Sprintf("case-%d", i))
+		// BEGIN and COMMIT are not counted by the sql out
+		assert.Equal(t, c.queries, queries, fmt.Sprintf("case-%d", i))
+	}
+
+	// the result
+	var got testCache
+	require.NoError(t, db.Get(ctx, &got, WithSelector("id=1")))
+	assert.Equal(t, testCache{1, "spike"}, got)
+
+	var list []testCache
+	var total int
+	require.NoError(t, db.List(ctx, &list, WithTable("test"), WithTotal(&total), WithOrderby("id")))
+	// the cached array is not modified by the append
+	_ = append(list[:1], testCache{3, "x"})
+	list, total = nil, 0
+	require.NoError(t, db.List(ctx, &list, WithTable("test"), WithTotal(&total), WithOrderby("id")))
+	assert.Equal(t, []testCache{{1, "spike"}, {2, "jerry"}}, list)
+	assert.Equal(t, 2, total)
+
+	// ttl
+	queries = 0
+	require.NoError(t, db.Get(ctx, &got, WithSelector("value=jerry"), WithCache(time.Millisecond)))
+	time.Sleep(5 * time.Millisecond)
+	require.NoError(t, db.Get(ctx, &got, WithSelector("value=jerry"), WithCache(time.Millisecond)))
+	assert.Equal(t, 2, queries)
+
+	// the write in a Tx invalidates the cache after commit
+	require.NoError(t, db.Get(ctx, &got, WithSelector("id=2")))
+	err = db.Transaction(ctx, func(ctx context.Context) error {
+		return db.Update(ctx, &testCache{ID: 2, Value: "tyke"}, WithSelector("id=2"))
+	})
+	require.NoError(t, err)
+	require.NoError(t, db.Get(ctx, &got, WithSelector("id=2")))
+	assert.Equal(t, "tyke", got.Value)
+
+	// metrics
+	w := httptest.NewRecorder()
+	telemetry.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Contains(t, w.Body.String(), `orm__cache_hits_total{table="test"}`)
+	assert.Contains(t, w.Body.String(), `orm__cache_misses_total{table="test"}`)
+}
@@ -0,0 +1,72 @@
+// orm-gen generates the go structs from the tables of an existing database
+//
+//	orm-gen -driver mysql -dsn 'root:1234@tcp(localhost:3306)/test' -tables 'user*' -o model/model.go
+//	orm-gen -driver sqlite3 -dsn 'file:test.db' -package model
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/yubo/golib/orm"
+	"github.com/yubo/golib/orm/gen"
+
+	_ "github.com/yubo/golib/orm/mysql"
+	_ "github.com/yubo/golib/orm/sqlite"
+)
+
+func main() {
+	var (
+		driver   = flag.String("driver", "mysql", "database driver, mysql or sqlite3")
+		dsn      = flag.String("dsn", "", "data source name")
+		pkg      = flag.String("package", gen.DefaultPackage, "package name of the generated file")
+		tables   = flag.String("tables", "", "comma separated table name patterns to generate, e.g. 'user*,order'")
+		excludes = flag.String("exclude", "", "comma separated table name patterns to skip")
+		output   = flag.String("o", "", "output file, default stdout")
+	)
+	flag.Parse()
+
+	if err := run(context.Background(), *driver, *dsn, *pkg, *tables, *excludes, *output); err != nil {
+		fmt.Fprintf(os.Stderr, "orm-gen: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, driver, dsn, pkg, tables, excludes, output string) error {
+	if dsn == "" {
+		return fmt.Errorf("-dsn is required")
+	}
+
+	db, err := orm.Open(driver, dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	b, err := gen.Generate(ctx, db,
+		gen.WithPackage(pkg),
+		gen.WithTables(splitPatterns(tables)...),
+		gen.WithExcludeTables(splitPatterns(excludes)...))
+	if err != nil {
+		return err
+	}
+
+	if output == "" {
+		_, err = os.Stdout.Write(b)
+		return err
+	}
+
+	return os.WriteFile(output, b, 0644)
+}
+
+func splitPatterns(s string) (patterns []string) {
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			patterns = append(patterns, v)
+		}
+	}
+	return
+}
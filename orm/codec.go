@@ -0,0 +1,87 @@
+package orm
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+var (
+	typeCodecs sync.Map // map[reflect.Type]*TypeCodec
+
+	jsonCodec = &TypeCodec{
+		DataType: JSON,
+		Encode:   jsonEncode,
+		Decode:   jsonDecode,
+	}
+)
+
+// TypeCodec is the column type and the codec of a go type
+type TypeCodec struct {
+	// DataType the column type, one of the DataType or the raw type of the driver, e.g. "inet"
+	DataType DataType
+
+	// Encode returns the column value of the field, v is not a pointer
+	Encode func(v interface{}) (interface{}, error)
+
+	// Decode sets the column value to the field, dst is a pointer to the field,
+	// src is the value scanned from the driver, e.g. []byte, string, int64, time.Time
+	Decode func(src interface{}, dst interface{}) error
+}
+
+// RegisterType register the codec of the type of sample, e.g. RegisterType(net.IP{}, codec)
+// it should be called before the type is used by the orm, e.g. in init()
+func RegisterType(sample interface{}, codec TypeCodec) {
+	rt := reflect.TypeOf(sample)
+	if rt.Kind() == reflect.Ptr {
+		rt = rt.Elem()
+	}
+
+	if codec.Encode == nil || codec.Decode == nil {
+		panic(fmt.Sprintf("orm: RegisterType %s requires the Encode and Decode", rt))
+	}
+
+	typeCodecs.Store(rt, &codec)
+}
+
+func typeCodecOf(rt reflect.Type) *TypeCodec {
+	if c, ok := typeCodecs.Load(rt); ok {
+		return c.(*TypeCodec)
+	}
+	return nil
+}
+
+// string is used instead of []byte, mysql json column rejects the binary charset
+func jsonEncode(v interface{}) (interface{}, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func jsonDecode(src interface{}, dst interface{}) error {
+	switch v := src.(type) {
+	case []byte:
+		return json.Unmarshal(v, dst)
+	case string:
+		return json.Unmarshal([]byte(v), dst)
+	}
+	return fmt.Errorf("unable to decode %T as json", src)
+}
+
+// enumCheck returns the check constraint of the enum field, e.g. CHECK (`status` IN ('a','b'))
+func enumCheck(d Dialect, f *StructField) string {
+	return fmt.Sprintf("CHECK (%s IN (%s))", d.Quote(f.Name), enumValues(f))
+}
+
+// enumValues returns the quoted values, e.g. 'a','b'
+func enumValues(f *StructField) string {
+	values := make([]string, len(f.EnumValues))
+	for i, v := range f.EnumValues {
+		values[i] = "'" + strings.ReplaceAll(v, "'", "''") + "'"
+	}
+	return strings.Join(values, ",")
+}
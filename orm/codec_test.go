@@ -0,0 +1,138 @@
+package orm
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTypeJSON(t *testing.T) {
+	runTests(t, func(db DB, ctx context.Context) {
+		type Point struct {
+			X int
+			Y int
+		}
+		type test struct {
+			ID     int               `sql:"primary_key"`
+			Labels map[string]string `sql:"type=json"`
+			Tags   []string          `sql:"type=json"`
+			Point  *Point            `sql:"type=json"`
+			Raw    string            `sql:"type=json"`
+			Any    interface{}       `sql:"type=json"`
+		}
+
+		f := GetField(&test{}, "labels", db)
+		require.NotNil(t, f)
+		assert.Equal(t, JSON, f.DataType)
+
+		require.NoError(t, db.AutoMigrate(ctx, &test{}))
+
+		cases := []test{
+			{ID: 1},
+			{
+				ID:     2,
+				Labels: map[string]string{"a": "b"},
+				Tags:   []string{"x", "y"},
+				Point:  &Point{X: 1, Y: 2},
+				Raw:    `{"a":1}`,
+				Any:    []interface{}{"a", float64(1)},
+			},
+		}
+		for i, c := range cases {
+			require.NoError(t, db.Insert(ctx, &c), fmt.Sprintf("case-%d", i))
+
+			var got test
+			require.NoError(t, db.Get(ctx, &got, WithSelectorf("id=%d", c.ID)), fmt.Sprintf("case-%d", i))
+			assert.Equal(t, c, got, fmt.Sprintf("case-%d", i))
+		}
+
+		// update
+		u := test{ID: 1, Tags: []string{"z"}}
+		require.NoError(t, db.Update(ctx, &u, WithSelector("id=1")))
+		var got test
+		require.NoError(t, db.Get(ctx, &got, WithSelector("id=1")))
+		assert.Equal(t, []string{"z"}, got.Tags)
+	})
+}
+
+func TestTypeEnum(t *testing.T) {
+	runTests(t, func(db DB, ctx context.Context) {
+		type test struct {
+			ID     int    `sql:"primary_key"`
+			Status string `sql:"type=enum,values=active|disabled,not_null"`
+		}
+
+		f := GetField(&test{}, "status", db)
+		require.NotNil(t, f)
+		assert.Equal(t, Enum, f.DataType)
+		assert.Equal(t, []string{"active", "disabled"}, f.EnumValues)
+
+		require.NoError(t, db.AutoMigrate(ctx, &test{}))
+		require.NoError(t, db.Insert(ctx, &test{ID: 1, Status: "active"}))
+		assert.Error(t, db.Insert(ctx, &test{ID: 2, Status: "unknown"}), "out of the enum values")
+
+		var got test
+		require.NoError(t, db.Get(ctx, &got, WithSelector("id=1")))
+		assert.Equal(t, "active", got.Status)
+	})
+
+	type test struct {
+		Status string `sql:"type=enum"`
+	}
+	_, err := parseStructField(reflect.TypeOf(test{}).Field(0))
+	assert.Error(t, err, "enum without values")
+}
+
+type testCodecPoint struct {
+	X, Y int
+}
+
+func TestRegisterType(t *testing.T) {
+	RegisterType(testCodecPoint{}, TypeCodec{
+		DataType: String,
+		Encode: func(v interface{}) (interface{}, error) {
+			p := v.(testCodecPoint)
+			return fmt.Sprintf("%d,%d", p.X, p.Y), nil
+		},
+		Decode: func(src interface{}, dst interface{}) error {
+			p := dst.(*testCodecPoint)
+			_, err := fmt.Sscanf(fmt.Sprintf("%s", src), "%d,%d", &p.X, &p.Y)
+			return err
+		},
+	})
+
+	runTests(t, func(db DB, ctx context.Context) {
+		type test struct {
+			ID     int `sql:"primary_key"`
+			Point  testCodecPoint
+			PointP *testCodecPoint `sql:"size=32"`
+		}
+
+		f := GetField(&test{}, "point_p", db)
+		require.NotNil(t, f)
+		assert.Equal(t, String, f.DataType)
+		assert.NotNil(t, f.Codec)
+
+		require.NoError(t, db.AutoMigrate(ctx, &test{}))
+
+		cases := []test{
+			{ID: 1, Point: testCodecPoint{1, 2}},
+			{ID: 2, Point: testCodecPoint{3, 4}, PointP: &testCodecPoint{5, 6}},
+		}
+		for i, c := range cases {
+			require.NoError(t, db.Insert(ctx, &c), fmt.Sprintf("case-%d", i))
+
+			var got test
+			require.NoError(t, db.Get(ctx, &got, WithSelectorf("id=%d", c.ID)), fmt.Sprintf("case-%d", i))
+			assert.Equal(t, c, got, fmt.Sprintf("case-%d", i))
+		}
+
+		var point string
+		require.NoError(t, db.Query(ctx, "SELECT point FROM test WHERE id=2").Row(&point))
+		assert.Equal(t, "3,4", point)
+	})
+}
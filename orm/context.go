@@ -11,6 +11,9 @@ const (
 	dbKey key = iota
 	interfaceKey
 	sqlOutKey
+	txDepthKey
+	primaryKey
+	shardKey
 )
 
 func WithDB(ctx context.Context, orm Interface) context.Context {
@@ -35,3 +38,34 @@ func SqlOutFrom(ctx context.Context) func(string) {
 	out, _ := ctx.Value(sqlOutKey).(func(string))
 	return out
 }
+
+// WithPrimary force the queries to be sent to the primary instead of the replicas,
+// e.g. read after write
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey, true)
+}
+
+func IsPrimary(ctx context.Context) bool {
+	primary, _ := ctx.Value(primaryKey).(bool)
+	return primary
+}
+
+// WithShardKey set the shard key used by ShardedDB
+func WithShardKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, shardKey, key)
+}
+
+func ShardKeyFrom(ctx context.Context) (string, bool) {
+	key, ok := ctx.Value(shardKey).(string)
+	return key, ok
+}
+
+// the depth of the savepoints, used to name the nested savepoint
+func withTxDepth(ctx context.Context, depth int) context.Context {
+	return context.WithValue(ctx, txDepthKey, depth)
+}
+
+func txDepthFrom(ctx context.Context) int {
+	depth, _ := ctx.Value(txDepthKey).(int)
+	return depth
+}
@@ -0,0 +1,241 @@
+package orm
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/yubo/golib/api/errors"
+)
+
+// e.g. "id", "`id` desc", "\"name\" ASC"
+var regOrderby = regexp.MustCompile("^[`\"]?(\\w+)[`\"]?(?:\\s+(?i:(asc|desc)))?$")
+
+type orderCol struct {
+	name string
+	desc bool
+}
+
+func (p orderCol) String() string {
+	if p.desc {
+		return "-" + p.name
+	}
+	return p.name
+}
+
+// listCursor is the keyset of the last row of the previous page
+type listCursor struct {
+	orders []orderCol
+	values []interface{}
+	fields []*StructField
+}
+
+// cursorToken is the json form of the continue token
+type cursorToken struct {
+	Orderby []string          `json:"o"`
+	Values  []json.RawMessage `json:"v"`
+}
+
+func parseOrderby(orderby []string) ([]orderCol, error) {
+	if len(orderby) == 0 {
+		return nil, fmt.Errorf("cursor pagination requires WithOrderby")
+	}
+
+	orders := make([]orderCol, len(orderby))
+	for i, v := range orderby {
+		match := regOrderby.FindStringSubmatch(strings.TrimSpace(v))
+		if match == nil {
+			return nil, fmt.Errorf("cursor pagination: unsupported order by %q", v)
+		}
+		orders[i] = orderCol{
+			name: match[1],
+			desc: strings.EqualFold(match[2], "desc"),
+		}
+	}
+	return orders, nil
+}
+
+// newListCursor parse the order by cols and decode the token if it's not empty
+func newListCursor(orderby []string, sample interface{}, token string, db Driver) (*listCursor, error) {
+	orders, err := parseOrderby(orderby)
+	if err != nil {
+		return nil, err
+	}
+
+	rt, ok := structTypeOf(sample)
+	if !ok {
+		return nil, fmt.Errorf("cursor pagination: unsupported type %T", sample)
+	}
+
+	tf := cachedTypeFields(rt, db)
+	fields := make([]*StructField, len(orders))
+	for i, order := range orders {
+		idx, ok := tf.nameIndex[order.name]
+		if !ok {
+			return nil, fmt.Errorf("cursor pagination: order by field %s not found in %s", order.name, rt)
+		}
+		fields[i] = tf.Fields[idx]
+	}
+
+	c := &listCursor{orders: orders, fields: fields}
+	if token == "" {
+		return c, nil
+	}
+
+	if err := c.decode(token); err != nil {
+		return nil, errors.NewBadRequest(fmt.Sprintf("invalid continue token: %s", err))
+	}
+
+	return c, nil
+}
+
+func (p *listCursor) decode(token string) error {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return err
+	}
+
+	var t cursorToken
+	if err := json.Unmarshal(b, &t); err != nil {
+		return err
+	}
+
+	if len(t.Orderby) != len(p.orders) || len(t.Values) != len(p.orders) {
+		return fmt.Errorf("the order by is changed")
+	}
+
+	p.values = make([]interface{}, len(p.orders))
+	for i, order := range p.orders {
+		if t.Orderby[i] != order.String() {
+			return fmt.Errorf("the order by is changed")
+		}
+
+		v := reflect.New(p.fields[i].Type)
+		if err := json.Unmarshal(t.Values[i], v.Interface()); err != nil {
+			return err
+		}
+		p.values[i] = v.Elem().Interface()
+	}
+
+	return nil
+}
+
+// encode returns the continue token of the row
+func (p *listCursor) encode(row reflect.Value) (string, error) {
+	row = reflect.Indirect(row)
+
+	t := cursorToken{
+		Orderby: make([]string, len(p.orders)),
+		Values:  make([]json.RawMessage, len(p.orders)),
+	}
+	for i, order := range p.orders {
+		fv, err := getSubv(row, p.fields[i].Index, false)
+		if err != nil {
+			return "", err
+		}
+
+		b, err := json.Marshal(fv.Interface())
+		if err != nil {
+			return "", err
+		}
+
+		t.Orderby[i] = order.String()
+		t.Values[i] = b
+	}
+
+	b, err := json.Marshal(t)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// orderby returns the quoted order by clause
+func (p *listCursor) orderby(d Dialect) []string {
+	ret := make([]string, len(p.orders))
+	for i, order := range p.orders {
+		ret[i] = d.Quote(order.name)
+		if order.desc {
+			ret[i] += " DESC"
+		}
+	}
+	return ret
+}
+
+// sql returns the predicate of the rows after the cursor
+//
+//	asc(a), asc(b)   --> (`a`, `b`) > (?, ?)
+//	desc(a), desc(b) --> (`a`, `b`) < (?, ?)
+//	asc(a), desc(b)  --> (`a` > ? OR (`a` = ? AND `b` < ?))
+func (p *listCursor) sql(d Dialect) (string, []interface{}) {
+	if len(p.values) == 0 {
+		return "", nil
+	}
+
+	op := func(o orderCol) string {
+		if o.desc {
+			return "<"
+		}
+		return ">"
+	}
+
+	mixed := false
+	for _, order := range p.orders[1:] {
+		if order.desc != p.orders[0].desc {
+			mixed = true
+			break
+		}
+	}
+
+	if len(p.orders) == 1 {
+		return d.Quote(p.orders[0].name) + " " + op(p.orders[0]) + " ?", p.values
+	}
+
+	if !mixed {
+		cols := make([]string, len(p.orders))
+		marks := make([]string, len(p.orders))
+		for i, order := range p.orders {
+			cols[i] = d.Quote(order.name)
+			marks[i] = "?"
+		}
+		return "(" + strings.Join(cols, ", ") + ") " + op(p.orders[0]) +
+			" (" + strings.Join(marks, ", ") + ")", p.values
+	}
+
+	var or []string
+	var args []interface{}
+	for i, order := range p.orders {
+		var and []string
+		for j := 0; j < i; j++ {
+			and = append(and, d.Quote(p.orders[j].name)+" = ?")
+			args = append(args, p.values[j])
+		}
+		and = append(and, d.Quote(order.name)+" "+op(order)+" ?")
+		args = append(args, p.values[i])
+
+		if len(and) == 1 {
+			or = append(or, and[0])
+		} else {
+			or = append(or, "("+strings.Join(and, " AND ")+")")
+		}
+	}
+
+	return "(" + strings.Join(or, " OR ") + ")", args
+}
+
+// nextCursor drop the extra row fetched by GenListSql,
+// and returns the continue token of the last row
+func (p *queryOptions) nextCursor(into interface{}) (string, error) {
+	rv := reflect.Indirect(reflect.ValueOf(into))
+	if p.limit <= 0 || p._cursor == nil || rv.Kind() != reflect.Slice || rv.Len() <= p.limit {
+		return "", nil
+	}
+
+	rv.Set(rv.Slice(0, p.limit))
+
+	return p._cursor.encode(rv.Index(p.limit - 1))
+}
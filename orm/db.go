@@ -8,6 +8,7 @@ import (
 	"reflect"
 	"strings"
 	"time"
+	"unicode"
 
 	"github.com/yubo/golib/api/errors"
 	"k8s.io/klog/v2"
@@ -52,13 +53,43 @@ func open(opts *DBOptions) (DB, error) {
 		}
 	}
 
+	setConnPool(db, opts)
+	opts.cache = newQueryCache(opts.cacheSize, opts.cacheTables)
+
+	var raw RawDB = db
+	var replicas *replicaSet
+	if len(opts.replicas) > 0 {
+		if replicas, err = openReplicas(db, opts); err != nil {
+			db.Close()
+			return nil, err
+		}
+		raw = replicas
+	}
+
+	driver := Driver(&nonDriver{})
+	ormdb := &ormDB{
+		DBOptions: opts,
+		db:        db,
+		replicas:  replicas,
+		Interface: NewBaseInterface(driver, newRawDBWrapper(raw, nil, opts.hooks), opts),
+	}
+
 	if opts.ctx != nil {
 		go func() {
 			<-opts.ctx.Done()
-			db.Close()
+			ormdb.Close()
 		}()
 	}
 
+	if f, ok := dbFactories[opts.driver]; ok {
+		driver = f(primaryExecer{ormdb}, opts)
+		ormdb.Interface = NewBaseInterface(driver, newRawDBWrapper(raw, driver.Dialect(), opts.hooks), opts)
+	}
+
+	return ormdb, nil
+}
+
+func setConnPool(db *sql.DB, opts *DBOptions) {
 	if opts.maxIdleCount != nil {
 		db.SetMaxIdleConns(*opts.maxIdleCount)
 	}
@@ -71,19 +102,6 @@ func open(opts *DBOptions) (DB, error) {
 	if opts.connMaxIdletime != nil {
 		db.SetConnMaxIdleTime(*opts.connMaxIdletime)
 	}
-
-	driver := Driver(&nonDriver{})
-	ormdb := &ormDB{
-		DBOptions: opts,
-		db:        db,
-		Interface: NewBaseInterface(driver, newRawDBWrapper(db), opts),
-	}
-
-	if f, ok := dbFactories[opts.driver]; ok {
-		ormdb.Interface = NewBaseInterface(f(ormdb, opts), newRawDBWrapper(db), opts)
-	}
-
-	return ormdb, nil
 }
 
 type Rows struct {
@@ -98,6 +116,12 @@ type Rows struct {
 	err     error
 }
 
+// ErrRows returns the Rows which returns the err,
+// used by the Interface implementations out of the package, e.g. orm/fake
+func ErrRows(err error) *Rows {
+	return &Rows{err: err}
+}
+
 // Row(*int, *int, ...)
 // Row(*struct{})
 // Row(**struct{})
@@ -254,6 +278,7 @@ func (p *Rows) genBinder(rt reflect.Type) (*binder, error) {
 		dest:     dest,
 		fieldMap: fieldMap,
 		rows:     p.rows,
+		keyring:  p.getKeyring(),
 	}, nil
 
 }
@@ -263,6 +288,7 @@ type binder struct {
 	dest     []interface{}
 	fieldMap map[string]int
 	rows     *sql.Rows
+	keyring  Keyring
 }
 
 func (p binder) scan(sample reflect.Value) error {
@@ -288,15 +314,24 @@ type transfer struct {
 	dstProxy interface{} // byte
 	dst      interface{} // raw
 	ptr      bool
+	codec    *TypeCodec
+
+	// the column is encrypted, decrypted with the keyring
+	encrypted bool
+	keyring   Keyring
 }
 
 // json -> dst
 func (p *transfer) unmarshal() error {
+	rv := reflect.Indirect(reflect.ValueOf(p.dst))
+
 	if p.dstProxy == nil {
+		if p.codec != nil || p.encrypted {
+			rv.Set(reflect.Zero(rv.Type()))
+		}
 		return nil
 	}
 
-	rv := reflect.Indirect(reflect.ValueOf(p.dst))
 	if p.ptr {
 		if rv.IsNil() {
 			rv.Set(reflect.New(rv.Type().Elem()))
@@ -304,6 +339,14 @@ func (p *transfer) unmarshal() error {
 		rv = rv.Elem()
 	}
 
+	if p.encrypted {
+		return p.decryptValue(rv)
+	}
+
+	if p.codec != nil {
+		return p.codec.Decode(p.dstProxy, rv.Addr().Interface())
+	}
+
 	// TODO: time.Time
 	if i, ok := p.dstProxy.(int64); ok {
 		t := time.Unix(i, 0)
@@ -330,7 +373,7 @@ func (p *binder) bind(rv reflect.Value) ([]*transfer, error) {
 			if err != nil {
 				return nil, err
 			}
-			if p.dest[i], err = scanInterface(fv, &tran); err != nil {
+			if p.dest[i], err = scanInterface(fv, f, p.keyring, &tran); err != nil {
 				return nil, err
 			}
 		}
@@ -382,7 +425,10 @@ func (p *rowsIterator) Row(dst ...interface{}) error {
 var _ Tx = new(ormTx)
 
 type ormTx struct {
-	tx *sql.Tx
+	tx      *sql.Tx
+	feed    *changeFeed
+	cache   *queryCache
+	pending *pendingChanges
 
 	Interface
 }
@@ -392,11 +438,18 @@ func (p *ormTx) Tx() *sql.Tx {
 }
 
 func (p *ormTx) Rollback() error {
+	p.pending.truncate(0)
 	return p.tx.Rollback()
 }
 
 func (p *ormTx) Commit() error {
-	return p.tx.Commit()
+	if err := p.tx.Commit(); err != nil {
+		p.pending.truncate(0)
+		return err
+	}
+
+	p.pending.flush(p.feed, p.cache)
+	return nil
 }
 
 // }}}
@@ -407,7 +460,8 @@ var _ DB = new(ormDB)
 
 type ormDB struct {
 	*DBOptions
-	db *sql.DB // DB
+	db       *sql.DB // DB
+	replicas *replicaSet
 
 	Interface
 }
@@ -417,6 +471,10 @@ func (p *ormDB) SqlDB() *sql.DB {
 }
 
 func (p *ormDB) Close() error {
+	p.feed.shutdown()
+	if p.replicas != nil {
+		p.replicas.Close()
+	}
 	return p.db.Close()
 }
 
@@ -430,15 +488,23 @@ func (p *ormDB) BeginTx(ctx context.Context, opts *sql.TxOptions) (Tx, error) {
 		return nil, err
 	}
 
+	pending := &pendingChanges{}
 	return &ormTx{
-		tx: tx,
+		tx:      tx,
+		feed:    p.feed,
+		cache:   p.cache,
+		pending: pending,
 		//Interface: p.WithRawDB(tx),
-		Interface: NewBaseInterface(p, tx, p.DBOptions),
+		Interface: &baseInterface{
+			DBOptions: p.DBOptions,
+			Driver:    p,
+			db:        newRawDBWrapper(tx, p.Dialect(), p.hooks),
+			pending:   pending,
+		},
 	}, nil
 }
 
 func (p *ormDB) ExecRows(bytes []byte) (err error) {
-	var cmds []string
 	var tx *sql.Tx
 
 	if tx, err = p.db.Begin(); err != nil {
@@ -453,45 +519,83 @@ func (p *ormDB) ExecRows(bytes []byte) (err error) {
 		}
 	}()
 
-	lines := strings.Split(string(bytes), "\n")
-	for cmd, in, i := "", false, 0; i < len(lines); i++ {
-		line := lines[i]
-		if len(line) == 0 || strings.HasPrefix(line, "-- ") {
-			continue
+	cmds := SplitStatements(bytes)
+	for i := 0; i < len(cmds); i++ {
+		_, err := tx.Exec(cmds[i])
+		if err != nil {
+			klog.V(3).Infof("%v", err)
+			return fmt.Errorf("sql %s\nerr %s", cmds[i], err)
 		}
+	}
+	return nil
+}
 
-		if in {
-			cmd += " " + strings.TrimSpace(line)
-			if cmd[len(cmd)-1] == ';' {
-				cmds = append(cmds, cmd)
-				in = false
-			}
-		} else {
-			n := strings.Index(line, " ")
-			if n <= 0 {
-				continue
+// SplitStatements split the sql file content into statements by the ";" which is not quoted,
+// the "--" and "/* */" comments which are not quoted are removed, and the spaces are merged,
+// the last statement may have no ";"
+func SplitStatements(bytes []byte) (cmds []string) {
+	var cmd strings.Builder
+	flush := func() {
+		if s := strings.TrimSpace(cmd.String()); s != "" && s != ";" {
+			cmds = append(cmds, s)
+		}
+		cmd.Reset()
+	}
+
+	rs := []rune(string(bytes))
+	var quote rune
+	var escaped, space bool
+	for i := 0; i < len(rs); i++ {
+		r := rs[i]
+
+		if quote != 0 {
+			cmd.WriteRune(r)
+			switch {
+			case escaped:
+				escaped = false
+			case r == '\\':
+				escaped = true
+			case r == quote:
+				quote = 0
 			}
+			continue
+		}
 
-			switch line[:n] {
-			case "SET", "CREATE", "INSERT", "DROP":
-				cmd = line
-				if line[len(line)-1] == ';' {
-					cmds = append(cmds, cmd)
-				} else {
-					in = true
-				}
+		switch {
+		case r == '-' && i+1 < len(rs) && rs[i+1] == '-':
+			// skip to the end of the line
+			for i < len(rs) && rs[i] != '\n' {
+				i++
 			}
+			space = true
+			continue
+		case r == '/' && i+1 < len(rs) && rs[i+1] == '*':
+			// skip to the "*/"
+			for i += 3; i < len(rs) && !(rs[i-1] == '*' && rs[i] == '/'); i++ {
+			}
+			space = true
+			continue
+		case unicode.IsSpace(r):
+			space = true
+			continue
 		}
-	}
 
-	for i := 0; i < len(cmds); i++ {
-		_, err := tx.Exec(cmds[i])
-		if err != nil {
-			klog.V(3).Infof("%v", err)
-			return fmt.Errorf("sql %s\nerr %s", cmds[i], err)
+		if space && cmd.Len() > 0 {
+			cmd.WriteByte(' ')
+		}
+		space = false
+		cmd.WriteRune(r)
+
+		switch r {
+		case '\'', '"', '`':
+			quote = r
+		case ';':
+			flush()
 		}
 	}
-	return nil
+	flush()
+
+	return cmds
 }
 
 // }}}
@@ -8,10 +8,13 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yubo/golib/api/errors"
 	"github.com/yubo/golib/util"
 	testingclock "github.com/yubo/golib/util/clock/testing"
 
 	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
 	_ "github.com/mattn/go-sqlite3"
 )
 
@@ -25,6 +28,7 @@ var (
 func init() {
 	RegisterMysql()
 	RegisterSqlite()
+	RegisterPostgres()
 
 	env := func(key, defaultValue string) string {
 		if value := os.Getenv(key); value != "" {
@@ -184,6 +188,284 @@ func TestInsert(t *testing.T) {
 	})
 }
 
+func TestInsertBatch(t *testing.T) {
+	runTests(t, func(db DB, ctx context.Context) {
+		type test struct {
+			Name  string `sql:"primary_key,size=64"`
+			Value int
+		}
+
+		err := db.AutoMigrate(ctx, &test{})
+		assert.NoError(t, err)
+
+		err = db.InsertBatch(ctx, []test{{"a", 1}, {"b", 2}, {"c", 3}}, WithMaxPlaceholders(4))
+		assert.NoError(t, err)
+
+		// upsert
+		err = db.InsertBatch(ctx, []*test{{"c", 30}, {"d", 4}}, WithUpsert())
+		assert.NoError(t, err)
+
+		err = db.Insert(ctx, &test{"a", 10}, WithUpsert())
+		assert.NoError(t, err)
+
+		var got []test
+		err = db.List(ctx, &got, WithOrderby("name"))
+		assert.NoError(t, err)
+		assert.Equal(t, []test{{"a", 10}, {"b", 2}, {"c", 30}, {"d", 4}}, got)
+
+		// the nil fields get the column default like Insert
+		type note struct {
+			Name string  `sql:"primary_key,size=64"`
+			Note *string `sql:"size=64,not_null,default='x'"`
+		}
+
+		db.Exec(ctx, "DROP TABLE IF EXISTS note")
+		defer db.Exec(ctx, "DROP TABLE IF EXISTS note")
+
+		err = db.AutoMigrate(ctx, &note{})
+		assert.NoError(t, err)
+
+		err = db.InsertBatch(ctx, []note{{"a", util.String("a")}, {"b", nil}, {"c", util.String("c")}})
+		assert.NoError(t, err)
+
+		var notes []note
+		err = db.List(ctx, &notes, WithOrderby("name"))
+		assert.NoError(t, err)
+		assert.Equal(t, []note{{"a", util.String("a")}, {"b", util.String("x")}, {"c", util.String("c")}}, notes)
+	})
+}
+
+func TestListCursor(t *testing.T) {
+	runTests(t, func(db DB, ctx context.Context) {
+		type test struct {
+			ID    int `sql:"primary_key"`
+			Kind  string
+			Value int
+		}
+
+		err := db.AutoMigrate(ctx, &test{})
+		assert.NoError(t, err)
+
+		err = db.InsertBatch(ctx, []test{
+			{1, "a", 3}, {2, "b", 1}, {3, "a", 1}, {4, "b", 2}, {5, "a", 2},
+		})
+		assert.NoError(t, err)
+
+		cases := []struct {
+			orderby []string
+			want    []int
+		}{
+			{[]string{"id"}, []int{1, 2, 3, 4, 5}},
+			{[]string{"id desc"}, []int{5, 4, 3, 2, 1}},
+			{[]string{"kind", "value"}, []int{3, 5, 1, 2, 4}},
+			{[]string{"kind desc", "value desc"}, []int{4, 2, 1, 5, 3}},
+			{[]string{"kind", "value desc"}, []int{1, 5, 3, 4, 2}},
+		}
+
+		for i, c := range cases {
+			var ids []int
+			var token string
+			for page := 0; ; page++ {
+				var got []test
+				var total int
+				err := db.List(ctx, &got,
+					WithOrderby(c.orderby...),
+					WithLimit(0, 2),
+					WithCursor(token),
+					WithContinue(&token),
+					WithTotal(&total),
+				)
+				require.NoError(t, err, "case-%d", i)
+				assert.Equal(t, 5, total, "case-%d", i)
+				for _, v := range got {
+					ids = append(ids, v.ID)
+				}
+				if token == "" {
+					break
+				}
+				require.Less(t, page, 3, "case-%d", i)
+			}
+			assert.Equal(t, c.want, ids, "case-%d", i)
+		}
+
+		var got []test
+		err = db.List(ctx, &got, WithOrderby("id"), WithLimit(0, 2), WithCursor("invalid"))
+		assert.Error(t, err)
+	})
+}
+
+func TestSoftDelete(t *testing.T) {
+	runTests(t, func(db DB, ctx context.Context) {
+		type test struct {
+			Name      string     `sql:"primary_key,size=64"`
+			DeletedAt *time.Time `sql:"soft_delete"`
+		}
+
+		err := db.AutoMigrate(ctx, &test{})
+		require.NoError(t, err)
+
+		err = db.InsertBatch(ctx, []test{{Name: "a"}, {Name: "b"}})
+		require.NoError(t, err)
+
+		err = db.Delete(ctx, &test{}, WithSelector("name=a"))
+		require.NoError(t, err)
+
+		// already deleted
+		err = db.Delete(ctx, &test{}, WithSelector("name=a"))
+		assert.True(t, errors.IsNotFound(err))
+
+		var got test
+		err = db.Get(ctx, &got, WithSelector("name=a"))
+		assert.True(t, errors.IsNotFound(err))
+
+		err = db.Get(ctx, &got, WithSelector("name=a"), WithUnscoped())
+		require.NoError(t, err)
+		assert.NotNil(t, got.DeletedAt)
+
+		var list []test
+		var total int
+		err = db.List(ctx, &list, WithTotal(&total))
+		require.NoError(t, err)
+		assert.Equal(t, []test{{Name: "b"}}, list)
+		assert.Equal(t, 1, total)
+
+		list = nil
+		err = db.List(ctx, &list, WithUnscoped(), WithTotal(&total))
+		require.NoError(t, err)
+		assert.Len(t, list, 2)
+		assert.Equal(t, 2, total)
+
+		// remove permanently
+		err = db.Delete(ctx, &test{}, WithSelector("name=a"), WithUnscoped())
+		require.NoError(t, err)
+
+		list = nil
+		err = db.List(ctx, &list, WithUnscoped())
+		require.NoError(t, err)
+		assert.Len(t, list, 1)
+	})
+}
+
+func TestOptimisticLock(t *testing.T) {
+	runTests(t, func(db DB, ctx context.Context) {
+		type test struct {
+			Name    string `sql:"where,primary_key,size=64"`
+			Value   int
+			Version int `sql:"version"`
+		}
+
+		err := db.AutoMigrate(ctx, &test{})
+		require.NoError(t, err)
+
+		err = db.Insert(ctx, &test{Name: "a", Value: 1})
+		require.NoError(t, err)
+
+		var a, b test
+		require.NoError(t, db.Get(ctx, &a, WithSelector("name=a")))
+		require.NoError(t, db.Get(ctx, &b, WithSelector("name=a")))
+
+		a.Value = 2
+		err = db.Update(ctx, &a)
+		require.NoError(t, err)
+		assert.Equal(t, 1, a.Version)
+
+		// b is stale
+		b.Value = 3
+		err = db.Update(ctx, &b)
+		assert.True(t, errors.IsConflict(err), "got %v", err)
+		assert.Equal(t, 0, b.Version)
+
+		var got test
+		require.NoError(t, db.Get(ctx, &got, WithSelector("name=a")))
+		assert.Equal(t, test{"a", 2, 1}, got)
+	})
+}
+
+type testUser struct {
+	ID      int `sql:"primary_key"`
+	Name    string
+	Orders  []*testOrder `sql:"has_many,foreign_key=user_id"`
+	Profile *testProfile `sql:"has_one,foreign_key=user_id"`
+}
+
+type testProfile struct {
+	ID     int `sql:"primary_key"`
+	UserID int
+	Email  string
+}
+
+type testOrder struct {
+	ID     int `sql:"primary_key"`
+	UserID int
+	Items  []testItem `sql:"has_many,foreign_key=order_id"`
+	User   *testUser  `sql:"belongs_to,foreign_key=user_id"`
+}
+
+type testItem struct {
+	ID      int `sql:"primary_key"`
+	OrderID int
+	Name    string
+}
+
+func TestPreload(t *testing.T) {
+	runTests(t, func(db DB, ctx context.Context) {
+		tables := []string{"test_user", "test_profile", "test_order", "test_item"}
+		dropTables := func() {
+			for _, table := range tables {
+				db.Exec(ctx, "DROP TABLE IF EXISTS "+table)
+			}
+		}
+		dropTables()
+		defer dropTables()
+
+		for _, sample := range []interface{}{&testUser{}, &testProfile{}, &testOrder{}, &testItem{}} {
+			require.NoError(t, db.AutoMigrate(ctx, sample))
+		}
+
+		require.NoError(t, db.InsertBatch(ctx, []testUser{{ID: 1, Name: "tom"}, {ID: 2, Name: "jerry"}, {ID: 3, Name: "spike"}}))
+		require.NoError(t, db.InsertBatch(ctx, []testProfile{{1, 1, "tom@example.com"}}))
+		require.NoError(t, db.InsertBatch(ctx, []testOrder{{ID: 1, UserID: 1}, {ID: 2, UserID: 1}, {ID: 3, UserID: 2}}))
+		require.NoError(t, db.InsertBatch(ctx, []testItem{{1, 1, "a"}, {2, 1, "b"}, {3, 3, "c"}}))
+
+		var users []testUser
+		var sqls []string
+		sqlCtx := WithSqlOut(ctx, func(sql string) { sqls = append(sqls, sql) })
+		err := db.List(sqlCtx, &users, WithOrderby("id"), WithPreload("Orders.Items", "Profile"))
+		require.NoError(t, err)
+		assert.Len(t, sqls, 4, "one query per relation")
+
+		require.Len(t, users, 3)
+		require.Len(t, users[0].Orders, 2)
+		assert.Equal(t, []testItem{{1, 1, "a"}, {2, 1, "b"}}, users[0].Orders[0].Items)
+		assert.Len(t, users[0].Orders[1].Items, 0)
+		assert.Equal(t, &testProfile{1, 1, "tom@example.com"}, users[0].Profile)
+		require.Len(t, users[1].Orders, 1)
+		assert.Equal(t, []testItem{{3, 3, "c"}}, users[1].Orders[0].Items)
+		assert.Nil(t, users[1].Profile)
+		assert.Len(t, users[2].Orders, 0)
+
+		// the keys are chunked by the max placeholders
+		var chunked []testUser
+		sqls = nil
+		err = db.List(sqlCtx, &chunked, WithOrderby("id"), WithPreload("Orders"), WithMaxPlaceholders(2))
+		require.NoError(t, err)
+		assert.Len(t, sqls, 3, "one list query and two preload queries")
+		require.Len(t, chunked, 3)
+		assert.Len(t, chunked[0].Orders, 2)
+		assert.Len(t, chunked[1].Orders, 1)
+		assert.Len(t, chunked[2].Orders, 0)
+
+		var order testOrder
+		err = db.Get(ctx, &order, WithSelector("id=3"), WithPreload("User"))
+		require.NoError(t, err)
+		require.NotNil(t, order.User)
+		assert.Equal(t, "jerry", order.User.Name)
+
+		err = db.Get(ctx, &order, WithSelector("id=3"), WithPreload("Unknown"))
+		assert.Error(t, err)
+	})
+}
+
 func TestQueryRows(t *testing.T) {
 	runTests(t, func(db DB, ctx context.Context) {
 		db.Exec(ctx, "CREATE TABLE test (value int)")
@@ -0,0 +1,182 @@
+package orm
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var (
+	_ Dialect = &mysqlDialect{}
+	_ Dialect = &sqliteDialect{}
+	_ Dialect = &postgresDialect{}
+
+	// DefaultDialect is used by the sql generators when no driver is given,
+	// it's also used by the mysql driver.
+	DefaultDialect Dialect = &mysqlDialect{}
+)
+
+// Dialect describes how the sql generators should quote identifiers,
+// bind args and paginate for a database.
+type Dialect interface {
+	// Quote quotes an identifier, e.g. table or column name
+	Quote(name string) string
+
+	// Rebind converts the '?' bind vars of the query into the driver's bind vars
+	Rebind(query string) string
+
+	// Limit returns the pagination clause, e.g. " LIMIT 0, 10"
+	Limit(offset, limit int) string
+
+	// Returning returns true if the insert id should be read by
+	// `INSERT ... RETURNING` instead of sql.Result.LastInsertId()
+	Returning() bool
+
+	// Upsert returns the clause appended to the insert statement,
+	// update the cols when the keys conflict
+	Upsert(keys, cols []string) (string, error)
+
+	// MaxPlaceholders the max number of bind vars in one statement
+	MaxPlaceholders() int
+}
+
+func dialectOf(db Driver) Dialect {
+	if db == nil {
+		return DefaultDialect
+	}
+	if d := db.Dialect(); d != nil {
+		return d
+	}
+	return DefaultDialect
+}
+
+// mysqlDialect is also compatible with sqlite
+type mysqlDialect struct{}
+
+func (p mysqlDialect) Quote(name string) string {
+	return "`" + name + "`"
+}
+
+func (p mysqlDialect) Rebind(query string) string {
+	return query
+}
+
+func (p mysqlDialect) Limit(offset, limit int) string {
+	return fmt.Sprintf(" LIMIT %d, %d", offset, limit)
+}
+
+func (p mysqlDialect) Returning() bool {
+	return false
+}
+
+// Upsert: ON DUPLICATE KEY UPDATE `a` = VALUES(`a`), ...
+// mysql use all the primary/unique keys, the keys are not required
+func (p mysqlDialect) Upsert(keys, cols []string) (string, error) {
+	if len(cols) == 0 {
+		if len(keys) == 0 {
+			return "", fmt.Errorf("upsert: both of the conflict keys and the update columns are empty")
+		}
+		// do nothing
+		cols = keys[:1]
+	}
+
+	set := make([]string, len(cols))
+	for i, col := range cols {
+		set[i] = fmt.Sprintf("%s = VALUES(%s)", p.Quote(col), p.Quote(col))
+	}
+
+	return " ON DUPLICATE KEY UPDATE " + strings.Join(set, ", "), nil
+}
+
+func (p mysqlDialect) MaxPlaceholders() int {
+	return 65535
+}
+
+type sqliteDialect struct {
+	mysqlDialect
+}
+
+func (p sqliteDialect) Upsert(keys, cols []string) (string, error) {
+	return upsertOnConflict(p, keys, cols)
+}
+
+// SQLITE_MAX_VARIABLE_NUMBER, which defaults to 32766 since 3.32.0
+func (p sqliteDialect) MaxPlaceholders() int {
+	return 32766
+}
+
+// upsertOnConflict: ON CONFLICT (`k`) DO UPDATE SET `a` = excluded.`a`, ...
+func upsertOnConflict(d Dialect, keys, cols []string) (string, error) {
+	if len(keys) == 0 {
+		return "", fmt.Errorf("upsert: the conflict keys are empty, primary_key or unique field is required")
+	}
+
+	k := make([]string, len(keys))
+	for i, key := range keys {
+		k[i] = d.Quote(key)
+	}
+
+	if len(cols) == 0 {
+		return " ON CONFLICT (" + strings.Join(k, ", ") + ") DO NOTHING", nil
+	}
+
+	set := make([]string, len(cols))
+	for i, col := range cols {
+		set[i] = fmt.Sprintf("%s = excluded.%s", d.Quote(col), d.Quote(col))
+	}
+
+	return " ON CONFLICT (" + strings.Join(k, ", ") + ") DO UPDATE SET " + strings.Join(set, ", "), nil
+}
+
+type postgresDialect struct{}
+
+func (p postgresDialect) Quote(name string) string {
+	return `"` + name + `"`
+}
+
+// Rebind: "a = ? and b = ?" -> "a = $1 and b = $2"
+// the '?' in the quoted string will be ignored
+func (p postgresDialect) Rebind(query string) string {
+	if strings.IndexByte(query, '?') == -1 {
+		return query
+	}
+
+	buf := make([]byte, 0, len(query)+8)
+	var quote byte
+	n := 0
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '?':
+			n++
+			buf = append(buf, '$')
+			buf = strconv.AppendInt(buf, int64(n), 10)
+			continue
+		}
+		buf = append(buf, c)
+	}
+
+	return string(buf)
+}
+
+func (p postgresDialect) Limit(offset, limit int) string {
+	return fmt.Sprintf(" LIMIT %d OFFSET %d", limit, offset)
+}
+
+func (p postgresDialect) Returning() bool {
+	return true
+}
+
+func (p postgresDialect) Upsert(keys, cols []string) (string, error) {
+	return upsertOnConflict(p, keys, cols)
+}
+
+func (p postgresDialect) MaxPlaceholders() int {
+	return 65535
+}
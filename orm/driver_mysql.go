@@ -28,6 +28,11 @@ type mysqlColumn struct {
 	ColumnName             string
 	IsNullable             sql.NullString
 	Datatype               string
+	ColumnType             string // e.g. int unsigned, varchar(32)
+	ColumnKey              string // PRI, UNI, MUL
+	ColumnDefault          sql.NullString
+	ColumnComment          string
+	Extra                  string
 	CharacterMaximumLength sql.NullInt64
 	NumericPrecision       sql.NullInt64
 	NumericScale           sql.NullInt64
@@ -36,7 +41,9 @@ type mysqlColumn struct {
 func (p *mysqlColumn) FiledOptions() StructField {
 	ret := StructField{
 		Name:           p.ColumnName,
-		DriverDataType: p.Datatype,
+		DriverDataType: p.ColumnType,
+		PrimaryKey:     p.ColumnKey == "PRI",
+		AutoIncrement:  strings.Contains(strings.ToLower(p.Extra), "auto_increment"),
 	}
 
 	if p.CharacterMaximumLength.Valid {
@@ -47,6 +54,19 @@ func (p *mysqlColumn) FiledOptions() StructField {
 		ret.NotNull = util.Bool(p.IsNullable.String != "YES")
 	}
 
+	if p.ColumnKey == "UNI" {
+		ret.Unique = util.Bool(true)
+	}
+
+	if p.ColumnDefault.Valid {
+		ret.HasDefaultValue = true
+		ret.DefaultValue = p.ColumnDefault.String
+	}
+
+	if p.ColumnComment != "" {
+		ret.Comment = util.String(p.ColumnComment)
+	}
+
 	return ret
 }
 
@@ -60,6 +80,10 @@ func (p *mysql) ParseField(f *StructField) {
 	f.DriverDataType = p.driverDataTypeOf(f)
 }
 
+func (p *mysql) Dialect() Dialect {
+	return DefaultDialect
+}
+
 func (p *mysql) driverDataTypeOf(f *StructField) string {
 	switch f.DataType {
 	case Bool:
@@ -74,6 +98,10 @@ func (p *mysql) driverDataTypeOf(f *StructField) string {
 		return p.getSchemaTimeType(f)
 	case Bytes:
 		return p.getSchemaBytesType(f)
+	case JSON:
+		return "json"
+	case Enum:
+		return "ENUM(" + enumValues(f) + ")"
 	}
 
 	return string(f.DataType)
@@ -207,7 +235,28 @@ func (p *mysql) AutoMigrate(ctx context.Context, sample interface{}, opts ...Que
 		return err
 	}
 
+	return p.autoMigrate(ctx, o)
+}
+
+func (p *mysql) PlanMigrate(ctx context.Context, sample interface{}, opts ...QueryOption) (SchemaChanges, error) {
+	if len(opts) == 0 {
+		opts = DefaultMysqlTableOptions
+	}
+	o, err := NewOptions(append(opts, WithSample(sample), withPlan())...)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := p.autoMigrate(ctx, o); err != nil {
+		return nil, err
+	}
+
+	return o.plan.changes, nil
+}
+
+func (p *mysql) autoMigrate(ctx context.Context, o *queryOptions) error {
 	if !p.HasTable(ctx, o.Table()) {
+		o.plan.add(ChangeCreateTable, o.Table(), "", "")
 		return p.CreateTable(ctx, o)
 	}
 
@@ -227,6 +276,7 @@ func (p *mysql) AutoMigrate(ctx context.Context, sample interface{}, opts ...Que
 
 		if foundField == nil {
 			// not found, add column
+			o.plan.add(ChangeAddColumn, o.Table(), expectField.Name, "%s", p.FullDataTypeOf(expectField))
 			if err := p.AddColumn(ctx, expectField.Name, o); err != nil {
 				return err
 			}
@@ -239,6 +289,7 @@ func (p *mysql) AutoMigrate(ctx context.Context, sample interface{}, opts ...Que
 	// index
 	for _, f := range expectFields.Fields {
 		if f.IndexKey && !p.HasIndex(ctx, f.Name, o) {
+			o.plan.add(ChangeAddIndex, o.Table(), f.Name, "")
 			if err := p.CreateIndex(ctx, f.Name, o); err != nil {
 				return err
 			}
@@ -316,12 +367,12 @@ func (p *mysql) CreateTable(ctx context.Context, o *queryOptions) (err error) {
 		SQL += " " + v
 	}
 
-	if _, err = p.Exec(ctx, SQL); err != nil {
+	if err = execDDL(ctx, p, o, SQL); err != nil {
 		return err
 	}
 
 	if autoIncrementNum > 0 {
-		if _, err = p.Exec(ctx, fmt.Sprintf("ALTER TABLE `%s` AUTO_INCREMENT = %d", o.Table(), autoIncrementNum)); err != nil {
+		if err = execDDL(ctx, p, o, fmt.Sprintf("ALTER TABLE `%s` AUTO_INCREMENT = %d", o.Table(), autoIncrementNum)); err != nil {
 			return err
 		}
 	}
@@ -350,9 +401,7 @@ func (p *mysql) AddColumn(ctx context.Context, field string, o *queryOptions) er
 		return fmt.Errorf("failed to look up field with name: %s", field)
 	}
 
-	_, err := p.Exec(ctx, "ALTER TABLE `"+o.Table()+"` ADD `"+f.Name+"` "+p.FullDataTypeOf(f))
-
-	return err
+	return execDDL(ctx, p, o, "ALTER TABLE `"+o.Table()+"` ADD `"+f.Name+"` "+p.FullDataTypeOf(f))
 }
 
 func (p *mysql) DropColumn(ctx context.Context, field string, o *queryOptions) error {
@@ -366,8 +415,7 @@ func (p *mysql) AlterColumn(ctx context.Context, field string, o *queryOptions)
 		return fmt.Errorf("failed to look up field with name: %s", field)
 	}
 
-	_, err := p.Exec(ctx, "ALTER TABLE `"+o.Table()+"` MODIFY COLUMN `"+f.Name+"` "+p.FullDataTypeOf(f))
-	return err
+	return execDDL(ctx, p, o, "ALTER TABLE `"+o.Table()+"` MODIFY COLUMN `"+f.Name+"` "+p.FullDataTypeOf(f))
 }
 
 func (p *mysql) HasColumn(ctx context.Context, field string, o *queryOptions) bool {
@@ -387,6 +435,7 @@ func (p *mysql) MigrateColumn(ctx context.Context, expect, actual *StructField,
 	// check size
 	if expect.Size != nil && actual.Size != nil && util.Int64Value(expect.Size) != util.Int64Value(actual.Size) {
 		klog.V(3).InfoS("migrate", "column", expect.Name, "expect", util.Int64Value(expect.Size), "actiual", util.Int64Value(actual.Size))
+		o.plan.add(ChangeAlterType, o.Table(), expect.Name, "size %d -> %d", util.Int64Value(actual.Size), util.Int64Value(expect.Size))
 		alterColumn = true
 	}
 
@@ -394,6 +443,9 @@ func (p *mysql) MigrateColumn(ctx context.Context, expect, actual *StructField,
 	if expect.NotNull != nil && util.BoolValue(expect.NotNull) != util.BoolValue(actual.NotNull) {
 		klog.V(3).InfoS("migrate.nullable", "column", expect.Name,
 			"expect", util.BoolValue(expect.NotNull), "actiual", util.BoolValue(actual.NotNull))
+		if !alterColumn {
+			o.plan.add(ChangeAlterNullable, o.Table(), expect.Name, "not null %v -> %v", util.BoolValue(actual.NotNull), util.BoolValue(expect.NotNull))
+		}
 		alterColumn = true
 	}
 
@@ -406,17 +458,27 @@ func (p *mysql) MigrateColumn(ctx context.Context, expect, actual *StructField,
 
 // ColumnTypes return columnTypes []gColumnType and execErr error
 func (p *mysql) ColumnTypes(ctx context.Context, o *queryOptions) ([]StructField, error) {
-	query := "SELECT column_name, is_nullable, data_type, character_maximum_length, numeric_precision, numeric_scale FROM information_schema.columns WHERE table_schema=? AND table_name=?"
+	query := "SELECT column_name, is_nullable, data_type, column_type, column_key, column_default, column_comment, extra, character_maximum_length, numeric_precision, numeric_scale FROM information_schema.columns WHERE table_schema=? AND table_name=? ORDER BY ordinal_position"
 
+	database := p.CurrentDatabase(ctx)
 	columns := []mysqlColumn{}
-	err := p.Query(ctx, query, p.CurrentDatabase(ctx), o.Table()).Rows(&columns)
+	err := p.Query(ctx, query, database, o.Table()).Rows(&columns)
 	if err != nil {
 		return nil, err
 	}
 
+	// the index created by orm is named after the column
+	var indexes []string
+	if err := p.Query(ctx, "SELECT DISTINCT index_name FROM information_schema.statistics WHERE table_schema=? AND table_name=?",
+		database, o.Table()).Rows(&indexes); err != nil {
+		return nil, err
+	}
+
 	columnTypes := []StructField{}
 	for _, c := range columns {
-		columnTypes = append(columnTypes, c.FiledOptions())
+		f := c.FiledOptions()
+		f.IndexKey = util.StringArrayContains(f.Name, indexes)
+		columnTypes = append(columnTypes, f)
 	}
 
 	return columnTypes, nil
@@ -435,8 +497,7 @@ func (p *mysql) CreateIndex(ctx context.Context, name string, o *queryOptions) e
 	}
 	createIndexSQL += fmt.Sprintf("INDEX `%s` ON %s(%s)", f.Name, o.Table(), f.Name)
 
-	_, err := p.Exec(ctx, createIndexSQL)
-	return err
+	return execDDL(ctx, p, o, createIndexSQL)
 
 }
 
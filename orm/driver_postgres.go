@@ -0,0 +1,451 @@
+package orm
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/yubo/golib/util"
+	"k8s.io/klog/v2"
+)
+
+var _ Driver = &postgres{}
+
+func RegisterPostgres() {
+	Register("postgres", func(db Execer, opts *DBOptions) Driver {
+		return &postgres{db, opts}
+	})
+}
+
+type postgresColumn struct {
+	ColumnName             string
+	IsNullable             sql.NullString
+	Datatype               string
+	CharacterMaximumLength sql.NullInt64
+	NumericPrecision       sql.NullInt64
+	NumericScale           sql.NullInt64
+}
+
+func (p *postgresColumn) FiledOptions() StructField {
+	ret := StructField{
+		Name:           p.ColumnName,
+		DriverDataType: p.Datatype,
+	}
+
+	if p.CharacterMaximumLength.Valid {
+		ret.Size = util.Int64(p.CharacterMaximumLength.Int64)
+	}
+
+	if p.IsNullable.Valid {
+		ret.NotNull = util.Bool(p.IsNullable.String != "YES")
+	}
+
+	return ret
+}
+
+// postgres m struct
+type postgres struct {
+	Execer
+	*DBOptions
+}
+
+func (p *postgres) ParseField(f *StructField) {
+	f.DriverDataType = p.driverDataTypeOf(f)
+}
+
+func (p *postgres) Dialect() Dialect {
+	return &postgresDialect{}
+}
+
+func (p *postgres) driverDataTypeOf(f *StructField) string {
+	switch f.DataType {
+	case Bool:
+		return "boolean"
+	case Int, Uint:
+		return p.getSchemaIntAndUnitType(f)
+	case Float:
+		return p.getSchemaFloatType(f)
+	case String:
+		return p.getSchemaStringType(f)
+	case Time:
+		return p.getSchemaTimeType(f)
+	case Bytes:
+		return "bytea"
+	case JSON:
+		return "jsonb"
+	case Enum:
+		return "text"
+	}
+
+	return string(f.DataType)
+}
+
+// postgres has no unsigned integer, use the larger one instead
+func (p *postgres) getSchemaIntAndUnitType(f *StructField) string {
+	size := util.Int64Value(f.Size)
+	if f.DataType == Uint && size < 64 {
+		size *= 2
+	}
+
+	if f.AutoIncrement {
+		switch {
+		case size <= 16:
+			return "smallserial"
+		case size <= 32:
+			return "serial"
+		}
+		return "bigserial"
+	}
+
+	switch {
+	case size <= 16:
+		return "smallint"
+	case size <= 32:
+		return "integer"
+	}
+	return "bigint"
+}
+
+func (p *postgres) getSchemaFloatType(f *StructField) string {
+	if util.Int64Value(f.Size) <= 32 {
+		return "real"
+	}
+
+	return "double precision"
+}
+
+func (p *postgres) getSchemaStringType(f *StructField) string {
+	size := util.Int64Value(f.Size)
+
+	if size == 0 && p.stringSize > 0 {
+		size = int64(p.stringSize)
+	}
+
+	// keep the same boundary as mysql
+	if size > 0 && size < 16384 {
+		f.Size = util.Int64(size)
+		return fmt.Sprintf("varchar(%d)", size)
+	}
+
+	f.Size = nil
+	return "text"
+}
+
+func (p *postgres) getSchemaTimeType(f *StructField) string {
+	if f.Precision != nil && *f.Precision > 0 {
+		return fmt.Sprintf("timestamptz(%d)", *f.Precision)
+	}
+
+	return "timestamptz"
+}
+
+// serial types are not allowed in `ALTER COLUMN ... TYPE`
+func (p *postgres) alterDataTypeOf(f *StructField) string {
+	switch f.DriverDataType {
+	case "smallserial":
+		return "smallint"
+	case "serial":
+		return "integer"
+	case "bigserial":
+		return "bigint"
+	}
+	return f.DriverDataType
+}
+
+func (p *postgres) FullDataTypeOf(field *StructField) string {
+	SQL := field.DriverDataType
+
+	if field.NotNull != nil && *field.NotNull {
+		SQL += " NOT NULL"
+	}
+
+	if field.Unique != nil && *field.Unique {
+		SQL += " UNIQUE"
+	}
+
+	if field.DefaultValue != "" {
+		SQL += " DEFAULT " + field.DefaultValue
+	}
+
+	if field.DataType == Enum {
+		SQL += " " + enumCheck(p.Dialect(), field)
+	}
+	return SQL
+}
+
+// AutoMigrate
+func (p *postgres) AutoMigrate(ctx context.Context, sample interface{}, opts ...QueryOption) error {
+	o, err := NewOptions(append(opts, WithSample(sample))...)
+	if err != nil {
+		return err
+	}
+
+	return p.autoMigrate(ctx, o)
+}
+
+func (p *postgres) PlanMigrate(ctx context.Context, sample interface{}, opts ...QueryOption) (SchemaChanges, error) {
+	o, err := NewOptions(append(opts, WithSample(sample), withPlan())...)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := p.autoMigrate(ctx, o); err != nil {
+		return nil, err
+	}
+
+	return o.plan.changes, nil
+}
+
+func (p *postgres) autoMigrate(ctx context.Context, o *queryOptions) error {
+	if !p.HasTable(ctx, o.Table()) {
+		o.plan.add(ChangeCreateTable, o.Table(), "", "")
+		return p.CreateTable(ctx, o)
+	}
+
+	actualFields, _ := p.ColumnTypes(ctx, o)
+	expectFields := GetFields(o.Sample(), p)
+
+	for _, expectField := range expectFields.Fields {
+		var foundField *StructField
+
+		for _, v := range actualFields {
+			if v.Name == expectField.Name {
+				foundField = &v
+				break
+			}
+		}
+
+		if foundField == nil {
+			// not found, add column
+			o.plan.add(ChangeAddColumn, o.Table(), expectField.Name, "%s", p.FullDataTypeOf(expectField))
+			if err := p.AddColumn(ctx, expectField.Name, o); err != nil {
+				return err
+			}
+		} else if err := p.MigrateColumn(ctx, expectField, foundField, o); err != nil {
+			// found, smart migrate
+			return err
+		}
+	}
+
+	// index
+	for _, f := range expectFields.Fields {
+		if f.IndexKey && !p.HasIndex(ctx, f.Name, o) {
+			o.plan.add(ChangeAddIndex, o.Table(), f.Name, "")
+			if err := p.CreateIndex(ctx, f.Name, o); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (p *postgres) GetTables(ctx context.Context) (tableList []string, err error) {
+	err = p.Query(ctx, "SELECT table_name FROM information_schema.tables WHERE table_schema = CURRENT_SCHEMA() AND table_type = ?", "BASE TABLE").Rows(&tableList)
+	return
+}
+
+func (p *postgres) CreateTable(ctx context.Context, o *queryOptions) (err error) {
+	var (
+		SQL                = `CREATE TABLE "` + o.Table() + `" (`
+		autoIncrementNum   int64
+		autoIncrementField string
+	)
+
+	fields := GetFields(o.Sample(), p)
+	for _, f := range fields.Fields {
+		SQL += fmt.Sprintf(`"%s" %s,`, f.Name, p.FullDataTypeOf(f))
+	}
+
+	{
+		primaryKeys := []string{}
+		for _, f := range fields.Fields {
+			if f.PrimaryKey {
+				primaryKeys = append(primaryKeys, `"`+f.Name+`"`)
+			}
+		}
+
+		if len(primaryKeys) > 0 {
+			SQL += fmt.Sprintf("PRIMARY KEY (%s),", strings.Join(primaryKeys, ","))
+		}
+	}
+
+	for _, f := range fields.Fields {
+		if f.AutoIncrement && f.AutoIncrementNum > 0 {
+			autoIncrementNum = f.AutoIncrementNum
+			autoIncrementField = f.Name
+		}
+
+		if !f.IndexKey {
+			continue
+		}
+
+		defer func(f *StructField) {
+			if err == nil {
+				err = p.CreateIndex(ctx, f.Name, o)
+			}
+		}(f)
+	}
+
+	SQL = strings.TrimSuffix(SQL, ",")
+
+	SQL += ")"
+
+	for _, v := range o.tableOptions {
+		SQL += " " + v
+	}
+
+	if err = execDDL(ctx, p, o, SQL); err != nil {
+		return err
+	}
+
+	if autoIncrementNum > 0 {
+		if err = execDDL(ctx, p, o, "SELECT setval(pg_get_serial_sequence(?, ?), ?, false)",
+			o.Table(), autoIncrementField, autoIncrementNum); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (p *postgres) DropTable(ctx context.Context, o *queryOptions) error {
+	_, err := p.Exec(ctx, `DROP TABLE IF EXISTS "`+o.Table()+`"`)
+	return err
+}
+
+func (p *postgres) HasTable(ctx context.Context, tableName string) bool {
+	var count int64
+	p.Query(ctx, "SELECT count(*) FROM information_schema.tables WHERE table_schema = CURRENT_SCHEMA() AND table_name = ? AND table_type = ?", tableName, "BASE TABLE").Row(&count)
+
+	return count > 0
+}
+
+func (p *postgres) AddColumn(ctx context.Context, field string, o *queryOptions) error {
+	// avoid using the same name field
+	f := GetField(o.Sample(), field, p)
+	if f == nil {
+		return fmt.Errorf("failed to look up field with name: %s", field)
+	}
+
+	return execDDL(ctx, p, o, `ALTER TABLE "`+o.Table()+`" ADD COLUMN "`+f.Name+`" `+p.FullDataTypeOf(f))
+}
+
+func (p *postgres) DropColumn(ctx context.Context, field string, o *queryOptions) error {
+	_, err := p.Exec(ctx, `ALTER TABLE "`+o.Table()+`" DROP COLUMN "`+field+`"`)
+	return err
+}
+
+func (p *postgres) AlterColumn(ctx context.Context, field string, o *queryOptions) error {
+	f := GetField(o.Sample(), field, p)
+	if f == nil {
+		return fmt.Errorf("failed to look up field with name: %s", field)
+	}
+
+	dataType := p.alterDataTypeOf(f)
+	SQL := fmt.Sprintf(`ALTER TABLE "%s" ALTER COLUMN "%s" TYPE %s USING "%s"::%s`,
+		o.Table(), f.Name, dataType, f.Name, dataType)
+
+	if util.BoolValue(f.NotNull) {
+		SQL += fmt.Sprintf(`, ALTER COLUMN "%s" SET NOT NULL`, f.Name)
+	} else {
+		SQL += fmt.Sprintf(`, ALTER COLUMN "%s" DROP NOT NULL`, f.Name)
+	}
+
+	return execDDL(ctx, p, o, SQL)
+}
+
+func (p *postgres) HasColumn(ctx context.Context, field string, o *queryOptions) bool {
+	var count int64
+	p.Query(ctx, "SELECT count(*) FROM information_schema.columns WHERE table_schema = CURRENT_SCHEMA() AND table_name = ? AND column_name = ?",
+		o.Table(), field,
+	).Row(&count)
+
+	return count > 0
+}
+
+// field: 1 - expect
+// columntype: 2 - actual
+func (p *postgres) MigrateColumn(ctx context.Context, expect, actual *StructField, o *queryOptions) error {
+	alterColumn := false
+
+	// check size
+	if expect.Size != nil && actual.Size != nil && util.Int64Value(expect.Size) != util.Int64Value(actual.Size) {
+		klog.V(3).InfoS("migrate", "column", expect.Name, "expect", util.Int64Value(expect.Size), "actiual", util.Int64Value(actual.Size))
+		o.plan.add(ChangeAlterType, o.Table(), expect.Name, "size %d -> %d", util.Int64Value(actual.Size), util.Int64Value(expect.Size))
+		alterColumn = true
+	}
+
+	// check nullable
+	if expect.NotNull != nil && util.BoolValue(expect.NotNull) != util.BoolValue(actual.NotNull) {
+		klog.V(3).InfoS("migrate.nullable", "column", expect.Name,
+			"expect", util.BoolValue(expect.NotNull), "actiual", util.BoolValue(actual.NotNull))
+		if !alterColumn {
+			o.plan.add(ChangeAlterNullable, o.Table(), expect.Name, "not null %v -> %v", util.BoolValue(actual.NotNull), util.BoolValue(expect.NotNull))
+		}
+		alterColumn = true
+	}
+
+	if alterColumn {
+		return p.AlterColumn(ctx, expect.Name, o)
+	}
+
+	return nil
+}
+
+// ColumnTypes return columnTypes []gColumnType and execErr error
+func (p *postgres) ColumnTypes(ctx context.Context, o *queryOptions) ([]StructField, error) {
+	query := "SELECT column_name, is_nullable, data_type, character_maximum_length, numeric_precision, numeric_scale FROM information_schema.columns WHERE table_schema = CURRENT_SCHEMA() AND table_name = ?"
+
+	columns := []postgresColumn{}
+	err := p.Query(ctx, query, o.Table()).Rows(&columns)
+	if err != nil {
+		return nil, err
+	}
+
+	columnTypes := []StructField{}
+	for _, c := range columns {
+		columnTypes = append(columnTypes, c.FiledOptions())
+	}
+
+	return columnTypes, nil
+}
+
+// the index name is unique in the schema, so prefix it with the table name
+func (p *postgres) indexName(name string, o *queryOptions) string {
+	return o.Table() + "_" + name
+}
+
+func (p *postgres) CreateIndex(ctx context.Context, name string, o *queryOptions) error {
+	f := GetField(o.Sample(), name, p)
+	if f == nil {
+		return fmt.Errorf("failed to create index with name %s", name)
+	}
+
+	createIndexSQL := "CREATE "
+	if f.Class != "" {
+		createIndexSQL += f.Class + " "
+	}
+	createIndexSQL += fmt.Sprintf(`INDEX "%s" ON "%s" ("%s")`, p.indexName(f.Name, o), o.Table(), f.Name)
+
+	return execDDL(ctx, p, o, createIndexSQL)
+}
+
+func (p *postgres) DropIndex(ctx context.Context, name string, o *queryOptions) error {
+	_, err := p.Exec(ctx, `DROP INDEX IF EXISTS "`+p.indexName(name, o)+`"`)
+	return err
+}
+
+func (p *postgres) HasIndex(ctx context.Context, name string, o *queryOptions) bool {
+	var count int64
+	p.Query(ctx, "SELECT count(*) FROM pg_indexes WHERE schemaname = CURRENT_SCHEMA() AND tablename = ? AND indexname = ?",
+		o.Table(), p.indexName(name, o)).Row(&count)
+
+	return count > 0
+}
+
+func (p *postgres) CurrentDatabase(ctx context.Context) (name string) {
+	p.Query(ctx, "SELECT CURRENT_DATABASE()").Row(&name)
+	return
+}
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/yubo/golib/util"
@@ -56,6 +57,10 @@ func (p *sqlite) ParseField(f *StructField) {
 	f.DriverDataType = p.driverDataTypeOf(f)
 }
 
+func (p *sqlite) Dialect() Dialect {
+	return &sqliteDialect{}
+}
+
 func (p *sqlite) driverDataTypeOf(f *StructField) string {
 	switch f.DataType {
 	case Bool:
@@ -75,6 +80,8 @@ func (p *sqlite) driverDataTypeOf(f *StructField) string {
 		return "datetime"
 	case Bytes:
 		return "blob"
+	case JSON, Enum:
+		return "text"
 	}
 
 	return string(f.DataType)
@@ -94,6 +101,10 @@ func (p *sqlite) FullDataTypeOf(field *StructField) string {
 	if field.DefaultValue != "" {
 		SQL += " DEFAULT " + field.DefaultValue
 	}
+
+	if field.DataType == Enum {
+		SQL += " " + enumCheck(p.Dialect(), field)
+	}
 	return SQL
 }
 
@@ -104,7 +115,25 @@ func (p *sqlite) AutoMigrate(ctx context.Context, sample interface{}, opts ...Qu
 		return err
 	}
 
+	return p.autoMigrate(ctx, o)
+}
+
+func (p *sqlite) PlanMigrate(ctx context.Context, sample interface{}, opts ...QueryOption) (SchemaChanges, error) {
+	o, err := NewOptions(append(opts, WithSample(sample), withPlan())...)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := p.autoMigrate(ctx, o); err != nil {
+		return nil, err
+	}
+
+	return o.plan.changes, nil
+}
+
+func (p *sqlite) autoMigrate(ctx context.Context, o *queryOptions) error {
 	if !p.HasTable(ctx, o.Table()) {
+		o.plan.add(ChangeCreateTable, o.Table(), "", "")
 		return p.CreateTable(ctx, o)
 	}
 
@@ -123,6 +152,7 @@ func (p *sqlite) AutoMigrate(ctx context.Context, sample interface{}, opts ...Qu
 
 		if foundField == nil {
 			// not found, add column
+			o.plan.add(ChangeAddColumn, o.Table(), expectField.Name, "%s", p.FullDataTypeOf(expectField))
 			if err := p.AddColumn(ctx, expectField.Name, o); err != nil {
 				return err
 			}
@@ -135,6 +165,7 @@ func (p *sqlite) AutoMigrate(ctx context.Context, sample interface{}, opts ...Qu
 	// index
 	for _, f := range expectFields.Fields {
 		if f.IndexKey && !p.HasIndex(ctx, f.Name, o) {
+			o.plan.add(ChangeAddIndex, o.Table(), f.Name, "")
 			if err := p.CreateIndex(ctx, f.Name, o); err != nil {
 				return err
 			}
@@ -199,7 +230,7 @@ func (p *sqlite) CreateTable(ctx context.Context, o *queryOptions) (err error) {
 
 	SQL += ")"
 
-	if _, err = p.Exec(ctx, SQL); err != nil {
+	if err = execDDL(ctx, p, o, SQL); err != nil {
 		return err
 	}
 
@@ -207,11 +238,11 @@ func (p *sqlite) CreateTable(ctx context.Context, o *queryOptions) (err error) {
 	if autoIncrementNum > 1 {
 		id := autoIncrementNum - 1
 
-		if _, err = p.Exec(ctx, "INSERT INTO `"+o.Table()+"` (`"+autoIncrementField+"`) VALUES (?)", id); err != nil {
+		if err = execDDL(ctx, p, o, "INSERT INTO `"+o.Table()+"` (`"+autoIncrementField+"`) VALUES (?)", id); err != nil {
 			return err
 		}
 
-		if _, err = p.Exec(ctx, "DELETE FROM `"+o.Table()+"` WHERE `"+autoIncrementField+"` = ?", id); err != nil {
+		if err = execDDL(ctx, p, o, "DELETE FROM `"+o.Table()+"` WHERE `"+autoIncrementField+"` = ?", id); err != nil {
 			return err
 		}
 	}
@@ -239,9 +270,7 @@ func (p *sqlite) AddColumn(ctx context.Context, field string, o *queryOptions) e
 		return fmt.Errorf("failed to look up field with name: %s", field)
 	}
 
-	_, err := p.Exec(ctx, "ALTER TABLE `"+o.Table()+"` ADD `"+f.Name+"` "+p.FullDataTypeOf(f))
-
-	return err
+	return execDDL(ctx, p, o, "ALTER TABLE `"+o.Table()+"` ADD `"+f.Name+"` "+p.FullDataTypeOf(f))
 }
 
 func (p *sqlite) DropColumn(ctx context.Context, field string, o *queryOptions) error {
@@ -299,11 +328,15 @@ func (p *sqlite) MigrateColumn(ctx context.Context, expect, actual *StructField,
 
 	// check size
 	if actual.Size != nil && util.Int64Value(expect.Size) != util.Int64Value(actual.Size) {
+		o.plan.add(ChangeAlterType, o.Table(), expect.Name, "size %d -> %d", util.Int64Value(actual.Size), util.Int64Value(expect.Size))
 		alterColumn = true
 	}
 
 	// check nullable
 	if expect.NotNull != nil && util.BoolValue(expect.NotNull) != util.BoolValue(actual.NotNull) {
+		if !alterColumn {
+			o.plan.add(ChangeAlterNullable, o.Table(), expect.Name, "not null %v -> %v", util.BoolValue(actual.NotNull), util.BoolValue(expect.NotNull))
+		}
 		alterColumn = true
 	}
 
@@ -314,46 +347,103 @@ func (p *sqlite) MigrateColumn(ctx context.Context, expect, actual *StructField,
 	return nil
 }
 
+type sqliteTableInfo struct {
+	Cid       int
+	Name      string
+	Type      string
+	Notnull   int
+	DfltValue sql.NullString
+	Pk        int
+}
+
+// e.g. varchar(32)
+var regSqliteTypeSize = regexp.MustCompile(`^[\w ]+\(\s*(\d+)\s*\)$`)
+
+type sqliteIndexList struct {
+	Seq    int
+	Name   string
+	Unique int
+	Origin string // c: create index, u: unique, pk: primary key
+}
+
 // ColumnTypes return columnTypes []gColumnType and execErr error
 func (p *sqlite) ColumnTypes(ctx context.Context, o *queryOptions) ([]StructField, error) {
-	rows, err := p.RawDB().QueryContext(ctx, "SELECT * FROM `"+o.Table()+"` LIMIT 1")
-	if err != nil {
+	table := o.Table()
+
+	columns := []sqliteTableInfo{}
+	if err := p.Query(ctx, "PRAGMA table_info(`"+table+"`)").Rows(&columns); err != nil {
 		return nil, err
 	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("no such table: %s", table)
+	}
 
-	defer func() {
-		rows.Close()
-	}()
-
-	var rawColumnTypes []*sql.ColumnType
-	rawColumnTypes, err = rows.ColumnTypes()
+	rawDDL, err := p.getRawDDL(ctx, table)
 	if err != nil {
 		return nil, err
 	}
+	autoIncrement := strings.Contains(strings.ToUpper(rawDDL), "AUTOINCREMENT")
 
-	columnTypes := []StructField{}
-	for _, c := range rawColumnTypes {
-		columnTypes = append(columnTypes, p.convertFieldOptions(c))
+	indexes := []sqliteIndexList{}
+	if err := p.Query(ctx, "PRAGMA index_list(`"+table+"`)").Rows(&indexes); err != nil {
+		return nil, err
 	}
 
-	return columnTypes, nil
-}
+	// the index created by orm is named after the column
+	indexKeys := map[string]bool{}
+	uniques := map[string]bool{}
+	for _, idx := range indexes {
+		if idx.Origin != "u" {
+			indexKeys[idx.Name] = true
+			continue
+		}
 
-func (p *sqlite) convertFieldOptions(c *sql.ColumnType) StructField {
-	ret := StructField{
-		Name:           c.Name(),
-		DriverDataType: c.DatabaseTypeName(),
+		var cols []struct {
+			Seqno int
+			Cid   int
+			Name  string
+		}
+		if err := p.Query(ctx, "PRAGMA index_info(`"+idx.Name+"`)").Rows(&cols); err != nil {
+			return nil, err
+		}
+		if len(cols) == 1 {
+			uniques[cols[0].Name] = true
+		}
 	}
 
-	if size, ok := c.Length(); ok {
-		ret.Size = util.Int64(size)
-	}
+	columnTypes := []StructField{}
+	for _, c := range columns {
+		f := StructField{
+			Name:           c.Name,
+			DriverDataType: c.Type,
+			NotNull:        util.Bool(c.Notnull != 0),
+			PrimaryKey:     c.Pk > 0,
+			IndexKey:       indexKeys[c.Name],
+		}
+
+		if m := regSqliteTypeSize.FindStringSubmatch(c.Type); m != nil {
+			size, _ := strconv.ParseInt(m[1], 10, 64)
+			f.Size = util.Int64(size)
+		}
+
+		// https://www.sqlite.org/autoinc.html
+		if f.PrimaryKey && autoIncrement {
+			f.AutoIncrement = true
+		}
+
+		if uniques[c.Name] {
+			f.Unique = util.Bool(true)
+		}
 
-	if nullable, ok := c.Nullable(); ok {
-		ret.NotNull = util.Bool(!nullable)
+		if c.DfltValue.Valid {
+			f.HasDefaultValue = true
+			f.DefaultValue = c.DfltValue.String
+		}
+
+		columnTypes = append(columnTypes, f)
 	}
 
-	return ret
+	return columnTypes, nil
 }
 
 func (p *sqlite) CreateIndex(ctx context.Context, name string, o *queryOptions) error {
@@ -368,8 +458,7 @@ func (p *sqlite) CreateIndex(ctx context.Context, name string, o *queryOptions)
 	}
 	createIndexSQL += fmt.Sprintf("INDEX `%s` ON %s(%s)", f.Name, o.Table(), f.Name)
 
-	_, err := p.Exec(ctx, createIndexSQL)
-	return err
+	return execDDL(ctx, p, o, createIndexSQL)
 
 }
 
@@ -431,7 +520,10 @@ func (p *sqlite) recreateTable(
 	}
 	columns := createDDL.getColumns()
 
-	if _, err := p.Exec(ctx, createSQL, sqlArgs...); err != nil {
+	// sqlite can not alter the column, the table will be rebuilt
+	o.plan.add(ChangeRecreateTable, table, "", "rebuild the table with the new ddl")
+
+	if err := execDDL(ctx, p, o, createSQL, sqlArgs...); err != nil {
 		return err
 	}
 
@@ -441,7 +533,7 @@ func (p *sqlite) recreateTable(
 		fmt.Sprintf("ALTER TABLE `%v` RENAME TO `%v`", newTableName, table),
 	}
 	for _, query := range queries {
-		if _, err := p.Exec(ctx, query); err != nil {
+		if err := execDDL(ctx, p, o, query); err != nil {
 			return err
 		}
 	}
@@ -0,0 +1,312 @@
+package orm
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/yubo/golib/selection"
+)
+
+// Keyring provides the keys of the `sql:"encrypt"` fields,
+// the value is encrypted with the current key and prefixed with the key id,
+// so the values encrypted with the old keys can still be decrypted after the key rotation.
+type Keyring interface {
+	// Current returns the id of the key to encrypt
+	Current() string
+	// Key returns the AES key of the id, 16, 24 or 32 bytes
+	Key(id string) ([]byte, error)
+	// IDs returns all the key ids, the deterministic selector matches the values of all the keys
+	IDs() []string
+}
+
+// the size of the key id is limited, the encrypted column is sized by ciphertextSize
+const maxKeyIDSize = 64
+
+// NewKeyring returns a static Keyring, the current is the id of the key to encrypt
+func NewKeyring(current string, keys map[string][]byte) (Keyring, error) {
+	if _, ok := keys[current]; !ok {
+		return nil, fmt.Errorf("the current key %q is not found", current)
+	}
+
+	ids := make([]string, 0, len(keys))
+	for id, key := range keys {
+		if id == "" || len(id) > maxKeyIDSize || strings.Contains(id, ":") {
+			return nil, fmt.Errorf("invalid key id %q", id)
+		}
+		if _, err := aes.NewCipher(key); err != nil {
+			return nil, fmt.Errorf("key %s: %s", id, err)
+		}
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	return &keyring{current: current, keys: keys, ids: ids}, nil
+}
+
+type keyring struct {
+	current string
+	keys    map[string][]byte
+	ids     []string
+}
+
+func (p *keyring) Current() string { return p.current }
+func (p *keyring) IDs() []string   { return p.ids }
+
+func (p *keyring) Key(id string) ([]byte, error) {
+	key, ok := p.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("key %q is not found", id)
+	}
+	return key, nil
+}
+
+// encrypt returns <key id>:base64(nonce + ciphertext) with AES-GCM,
+// the nonce of the deterministic mode is derived from the plaintext,
+// so the same plaintext always has the same ciphertext with the same key
+func encrypt(kr Keyring, id string, plaintext []byte, deterministic bool) (string, error) {
+	key, err := kr.Key(id)
+	if err != nil {
+		return "", err
+	}
+
+	aead, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if deterministic {
+		// derive a sub key, the aes key is not used as the hmac key directly
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte("orm deterministic nonce"))
+		mac = hmac.New(sha256.New, mac.Sum(nil))
+		mac.Write(plaintext)
+		copy(nonce, mac.Sum(nil))
+	} else if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+
+	b := aead.Seal(nonce, nonce, plaintext, nil)
+	return id + ":" + base64.StdEncoding.EncodeToString(b), nil
+}
+
+// ciphertextSize returns the column size of the ciphertext of the plaintext with n chars,
+// up to 4 bytes per utf8 char, with a 12 bytes nonce and a 16 bytes tag
+func ciphertextSize(n int64) int64 {
+	return maxKeyIDSize + 1 + int64(base64.StdEncoding.EncodedLen(int(4*n+12+16)))
+}
+
+func decrypt(kr Keyring, ciphertext string) ([]byte, error) {
+	id, data, ok := strings.Cut(ciphertext, ":")
+	if !ok {
+		return nil, fmt.Errorf("invalid ciphertext, the key id is not found")
+	}
+
+	key, err := kr.Key(id)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ciphertext: %s", err)
+	}
+
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(b) < aead.NonceSize() {
+		return nil, fmt.Errorf("invalid ciphertext, too short")
+	}
+
+	return aead.Open(nil, b[:aead.NonceSize()], b[aead.NonceSize():], nil)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encryptValue encrypts the encoded value of the field, it should be a string or []byte
+func (p *StructField) encryptValue(kr Keyring, v interface{}) (interface{}, error) {
+	plaintext, err := p.plaintextOf(kr, v)
+	if err != nil {
+		return nil, err
+	}
+
+	return encrypt(kr, kr.Current(), plaintext, p.Deterministic)
+}
+
+// ciphertextsOf returns the ciphertexts of the encoded value with all of the keys, like encryptSelector
+func (p *StructField) ciphertextsOf(kr Keyring, v interface{}) ([]interface{}, error) {
+	plaintext, err := p.plaintextOf(kr, v)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []interface{}{}
+	for _, id := range kr.IDs() {
+		s, err := encrypt(kr, id, plaintext, p.Deterministic)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, s)
+	}
+
+	return ret, nil
+}
+
+func (p *StructField) plaintextOf(kr Keyring, v interface{}) ([]byte, error) {
+	if kr == nil {
+		return nil, fmt.Errorf("encrypt field %s: the keyring is not set, see WithKeyring", p.Name)
+	}
+
+	switch s := v.(type) {
+	case string:
+		return []byte(s), nil
+	case []byte:
+		return s, nil
+	default:
+		return nil, fmt.Errorf("encrypt field %s: the value should be a string or []byte, got %T", p.Name, v)
+	}
+}
+
+// decryptValue decrypts the column value and sets it to the field
+func (p *transfer) decryptValue(rv reflect.Value) error {
+	if p.keyring == nil {
+		return fmt.Errorf("decrypt: the keyring is not set, see WithKeyring")
+	}
+
+	var ciphertext string
+	switch s := p.dstProxy.(type) {
+	case string:
+		ciphertext = s
+	case []byte:
+		ciphertext = string(s)
+	default:
+		return fmt.Errorf("decrypt: unexpected value %T", p.dstProxy)
+	}
+
+	plaintext, err := decrypt(p.keyring, ciphertext)
+	if err != nil {
+		return err
+	}
+
+	if p.codec != nil {
+		return p.codec.Decode(plaintext, rv.Addr().Interface())
+	}
+
+	switch {
+	case rv.Kind() == reflect.String:
+		rv.SetString(string(plaintext))
+	case rv.Kind() == reflect.Slice && rv.Type().Elem().Kind() == reflect.Uint8:
+		rv.SetBytes(plaintext)
+	default:
+		return fmt.Errorf("decrypt: unable to set %s", rv.Type())
+	}
+	return nil
+}
+
+// encryptSelector replaces the values of the deterministic fields in the selector with the ciphertexts,
+// only the equality operators are supported, e.g. email=tom@example.com, email in (a,b)
+func encryptSelector(selector Selector, fields StructFields, kr Keyring) (Selector, error) {
+	if selector == nil {
+		return nil, nil
+	}
+
+	encrypted := map[string]*StructField{}
+	for _, f := range fields.Fields {
+		if f.Encrypt {
+			encrypted[f.Name] = f
+		}
+	}
+	if len(encrypted) == 0 {
+		return selector, nil
+	}
+
+	reqs, _ := selector.Requirements()
+	out := make(internalSelector, 0, len(reqs))
+	for _, req := range reqs {
+		if req.operator == selection.Or {
+			for _, group := range req.Groups() {
+				for _, r := range group {
+					if _, ok := encrypted[r.key]; ok {
+						return nil, fmt.Errorf("the encrypted field %s is not supported in the 'or' selector", r.key)
+					}
+				}
+			}
+			out = append(out, req)
+			continue
+		}
+
+		f, ok := encrypted[req.key]
+		if !ok {
+			out = append(out, req)
+			continue
+		}
+
+		var op selection.Operator
+		switch req.operator {
+		case selection.Exists, selection.DoesNotExist:
+			out = append(out, req)
+			continue
+		case selection.In, selection.Equals, selection.DoubleEquals:
+			op = selection.In
+		case selection.NotIn, selection.NotEquals:
+			op = selection.NotIn
+		default:
+			return nil, fmt.Errorf("the operator %s is not supported on the encrypted field %s", req.operator, f.Name)
+		}
+
+		if !f.Deterministic {
+			return nil, fmt.Errorf("the encrypted field %s can not be used in the selector, use encrypt=deterministic", f.Name)
+		}
+		if kr == nil {
+			return nil, fmt.Errorf("encrypt field %s: the keyring is not set, see WithKeyring", f.Name)
+		}
+
+		// the values may be encrypted by any of the keys
+		values := []string{}
+		for _, v := range req.strValues {
+			for _, id := range kr.IDs() {
+				s, err := encrypt(kr, id, []byte(v), true)
+				if err != nil {
+					return nil, err
+				}
+				values = append(values, s)
+			}
+		}
+
+		out = append(out, Requirement{key: req.key, operator: op, strValues: values})
+	}
+
+	return out, nil
+}
+
+func (p *baseInterface) encryptSelector(o *queryOptions) (err error) {
+	if o._selector == nil {
+		return nil
+	}
+
+	rt, ok := structTypeOf(o.sample)
+	if !ok {
+		return nil
+	}
+
+	o._selector, err = encryptSelector(o._selector, cachedTypeFields(rt, p.Driver), p.getKeyring())
+	return err
+}
@@ -0,0 +1,163 @@
+package orm
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestKeyring(t *testing.T, current string) Keyring {
+	kr, err := NewKeyring(current, map[string][]byte{
+		"k1": []byte("0123456789abcdef"),
+		"k2": []byte("0123456789abcdef0123456789abcdef"),
+	})
+	require.NoError(t, err)
+	return kr
+}
+
+func TestEncrypt(t *testing.T) {
+	kr := newTestKeyring(t, "k1")
+
+	cases := []struct {
+		id            string
+		plaintext     string
+		deterministic bool
+	}{
+		{"k1", "", false},
+		{"k1", "hello", false},
+		{"k2", "hello", true},
+	}
+	for i, c := range cases {
+		s1, err := encrypt(kr, c.id, []byte(c.plaintext), c.deterministic)
+		require.NoError(t, err, fmt.Sprintf("case-%d", i))
+		assert.True(t, strings.HasPrefix(s1, c.id+":"), fmt.Sprintf("case-%d", i))
+
+		s2, err := encrypt(kr, c.id, []byte(c.plaintext), c.deterministic)
+		require.NoError(t, err, fmt.Sprintf("case-%d", i))
+		assert.Equal(t, c.deterministic, s1 == s2, fmt.Sprintf("case-%d", i))
+
+		b, err := decrypt(kr, s1)
+		require.NoError(t, err, fmt.Sprintf("case-%d", i))
+		assert.Equal(t, c.plaintext, string(b), fmt.Sprintf("case-%d", i))
+	}
+
+	_, err := decrypt(kr, "k3:AAAA")
+	assert.Error(t, err, "unknown key")
+
+	_, err = NewKeyring("k3", map[string][]byte{"k1": []byte("0123456789abcdef")})
+	assert.Error(t, err, "current key is not found")
+
+	_, err = NewKeyring("k1", map[string][]byte{"k1": []byte("short")})
+	assert.Error(t, err, "invalid key size")
+
+	_, err = NewKeyring("k1", map[string][]byte{"k1": []byte("0123456789abcdef"), strings.Repeat("k", 65): []byte("0123456789abcdef")})
+	assert.Error(t, err, "the key id is too long")
+}
+
+func TestCiphertextSize(t *testing.T) {
+	id := strings.Repeat("k", maxKeyIDSize)
+	kr, err := NewKeyring(id, map[string][]byte{id: []byte("0123456789abcdef")})
+	require.NoError(t, err)
+
+	for i, n := range []int64{0, 1, 16, 255} {
+		// 4 bytes per char
+		s, err := encrypt(kr, id, []byte(strings.Repeat("😀", int(n))), false)
+		require.NoError(t, err, fmt.Sprintf("case-%d", i))
+		assert.Equal(t, ciphertextSize(n), int64(len(s)), fmt.Sprintf("case-%d", i))
+	}
+}
+
+func TestEncryptField(t *testing.T) {
+	if !testAvailable {
+		t.Skipf("SQL server not running on %s:%s", testDriver, testDsn)
+	}
+
+	type test struct {
+		ID     int               `sql:"primary_key"`
+		Secret string            `sql:"encrypt"`
+		Email  *string           `sql:"encrypt=deterministic"`
+		Extra  map[string]string `sql:"type=json,encrypt"`
+	}
+
+	ctx := context.Background()
+	open := func(current string) DB {
+		db, err := Open(testDriver, testDsn, WithKeyring(newTestKeyring(t, current)))
+		require.NoError(t, err)
+		return db
+	}
+
+	db := open("k1")
+	defer db.Close()
+	defer db.Exec(ctx, "DROP TABLE IF EXISTS test")
+
+	f := GetField(&test{}, "extra", db)
+	require.NotNil(t, f)
+	assert.Equal(t, String, f.DataType)
+
+	require.NoError(t, db.AutoMigrate(ctx, &test{}))
+
+	tom := "tom"
+	want := test{ID: 1, Secret: "s1", Email: &tom, Extra: map[string]string{"a": "b"}}
+	require.NoError(t, db.Insert(ctx, &want))
+
+	// the ciphertext is stored
+	var secret, email string
+	require.NoError(t, db.Query(ctx, "SELECT secret, email FROM test WHERE id=1").Row(&secret, &email))
+	assert.True(t, strings.HasPrefix(secret, "k1:"), secret)
+	assert.True(t, strings.HasPrefix(email, "k1:"), email)
+
+	var got test
+	require.NoError(t, db.Get(ctx, &got, WithSelector("id=1")))
+	assert.Equal(t, want, got)
+
+	// rotate the key, the old values are still readable and selectable
+	db2 := open("k2")
+	defer db2.Close()
+
+	jerry := "jerry"
+	require.NoError(t, db2.Insert(ctx, &test{ID: 2, Secret: "s2", Email: &jerry}))
+
+	var list []test
+	require.NoError(t, db2.List(ctx, &list, WithSelector("email in (tom,jerry)"), WithOrderby("id")))
+	require.Len(t, list, 2)
+	assert.Equal(t, want, list[0])
+	assert.Equal(t, "s2", list[1].Secret)
+	assert.Nil(t, list[1].Extra)
+
+	require.NoError(t, db2.Get(ctx, &got, WithSelector("email=jerry")))
+	assert.Equal(t, 2, got.ID)
+
+	require.NoError(t, db2.Update(ctx, &test{ID: 2, Secret: "s3", Email: &jerry}, WithSelector("email=jerry")))
+	require.NoError(t, db2.Get(ctx, &got, WithSelector("id=2")))
+	assert.Equal(t, "s3", got.Secret)
+
+	// the where field matches the row written with the old key
+	type testWhere struct {
+		Email  *string `sql:"where,encrypt=deterministic"`
+		Secret string  `sql:"encrypt"`
+	}
+	require.NoError(t, db2.Update(ctx, &testWhere{Email: &tom, Secret: "s4"}, WithTable("test")))
+	require.NoError(t, db2.Get(ctx, &got, WithSelector("id=1")))
+	assert.Equal(t, "s4", got.Secret)
+
+	err := db2.Get(ctx, &got, WithSelector("secret=s3"))
+	assert.Error(t, err, "the random encrypted field can not be selected")
+
+	err = db2.Get(ctx, &got, WithSelector("email=~to"))
+	assert.Error(t, err, "only the equality operators are supported")
+
+	require.NoError(t, db2.Delete(ctx, &test{}, WithSelector("email!=tom")))
+	var total int
+	require.NoError(t, db2.List(ctx, &list, WithTotal(&total)))
+	assert.Equal(t, 1, total)
+
+	// without the keyring
+	db3, err := Open(testDriver, testDsn)
+	require.NoError(t, err)
+	defer db3.Close()
+	assert.Error(t, db3.Get(ctx, &got, WithSelector("id=1")))
+}
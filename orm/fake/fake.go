@@ -0,0 +1,648 @@
+// Package fake implements orm.Interface in memory, used by the unit tests
+// of the code depends on orm.Interface, the raw sql is not supported.
+package fake
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/yubo/golib/api/errors"
+	"github.com/yubo/golib/orm"
+)
+
+var _ orm.Interface = &DB{}
+
+type Verb string
+
+const (
+	VerbInsert Verb = "insert"
+	VerbGet    Verb = "get"
+	VerbList   Verb = "list"
+	VerbUpdate Verb = "update"
+	VerbDelete Verb = "delete"
+	VerbExec   Verb = "exec"
+	VerbQuery  Verb = "query"
+)
+
+// Op is the operation executed by the DB
+type Op struct {
+	Verb     Verb
+	Table    string
+	Selector string
+}
+
+func (p Op) String() string {
+	if p.Selector == "" {
+		return fmt.Sprintf("%s %s", p.Verb, p.Table)
+	}
+	return fmt.Sprintf("%s %s %s", p.Verb, p.Table, p.Selector)
+}
+
+// DB stores the rows of the tables in memory, keyed by the primary_key fields
+type DB struct {
+	orm.Driver
+
+	mu     sync.Mutex
+	tables map[string]*table
+	ops    []Op
+	errs   map[string]error
+}
+
+type row map[string]interface{}
+
+type table struct {
+	rows          []row
+	autoIncrement int64
+}
+
+func New() *DB {
+	return &DB{
+		Driver: orm.NewNonDriver(),
+		tables: map[string]*table{},
+		errs:   map[string]error{},
+	}
+}
+
+// Ops returns the operations executed, e.g. "insert user", "get user name=tom"
+func (p *DB) Ops() []Op {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]Op{}, p.ops...)
+}
+
+// Reset clears the recorded operations
+func (p *DB) Reset() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.ops = nil
+}
+
+// InjectError makes the operations of the table and the verb return the err,
+// the empty table matches all of the tables, the nil err removes the injected error
+func (p *DB) InjectError(table string, verb Verb, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	key := table + "/" + string(verb)
+	if err == nil {
+		delete(p.errs, key)
+		return
+	}
+	p.errs[key] = err
+}
+
+// record records the operation, and returns the injected error
+func (p *DB) record(verb Verb, tableName string, selector orm.Selector) error {
+	op := Op{Verb: verb, Table: tableName}
+	if selector != nil {
+		op.Selector = selector.String()
+	}
+	p.ops = append(p.ops, op)
+
+	if err, ok := p.errs[tableName+"/"+string(verb)]; ok {
+		return err
+	}
+	return p.errs["/"+string(verb)]
+}
+
+func (p *DB) table(name string) *table {
+	t, ok := p.tables[name]
+	if !ok {
+		t = &table{}
+		p.tables[name] = t
+	}
+	return t
+}
+
+func (p *DB) AutoMigrate(ctx context.Context, sample interface{}, opts ...orm.QueryOption) error {
+	o, err := orm.NewOptions(append(opts, orm.WithSample(sample))...)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.table(o.Table())
+	return nil
+}
+
+func (p *DB) HasTable(ctx context.Context, tableName string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	_, ok := p.tables[tableName]
+	return ok
+}
+
+func (p *DB) GetTables(ctx context.Context) ([]string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	ret := make([]string, 0, len(p.tables))
+	for name := range p.tables {
+		ret = append(ret, name)
+	}
+	sort.Strings(ret)
+	return ret, nil
+}
+
+func (p *DB) Insert(ctx context.Context, sample interface{}, opts ...orm.QueryOption) error {
+	_, err := p.InsertLastId(ctx, sample, opts...)
+	return err
+}
+
+func (p *DB) InsertLastId(ctx context.Context, sample interface{}, opts ...orm.QueryOption) (int64, error) {
+	o, err := orm.NewOptions(append(opts, orm.WithSample(sample))...)
+	if err != nil {
+		return 0, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := p.record(VerbInsert, o.Table(), nil); err != nil {
+		return 0, err
+	}
+
+	return p.insert(o.Table(), reflect.ValueOf(sample), o)
+}
+
+func (p *DB) InsertBatch(ctx context.Context, samples interface{}, opts ...orm.QueryOption) error {
+	rv := reflect.Indirect(reflect.ValueOf(samples))
+	if rv.Kind() != reflect.Slice {
+		return fmt.Errorf("fake: InsertBatch needs a slice, got %T", samples)
+	}
+
+	o, err := orm.NewOptions(append(opts, orm.WithSample(reflect.New(elemType(rv.Type())).Interface()))...)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := p.record(VerbInsert, o.Table(), nil); err != nil {
+		return err
+	}
+
+	for i := 0; i < rv.Len(); i++ {
+		if _, err := p.insert(o.Table(), rv.Index(i), o); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// insert inserts the row, or updates the cols of the row with the same conflict keys
+// like ON DUPLICATE KEY UPDATE/ON CONFLICT DO UPDATE if WithUpsert is set
+func (p *DB) insert(tableName string, rv reflect.Value, o interface {
+	Upsert() bool
+	UpsertCols(db orm.Driver, insertCols []string) (keys, cols []string)
+}) (int64, error) {
+	rv = reflect.Indirect(rv)
+	t := p.table(tableName)
+	now := orm.Clock().Now()
+
+	r := row{}
+	var insertCols []string
+	var lastId int64
+	for _, f := range orm.GetFields(rv.Interface(), p.Driver).Fields {
+		switch {
+		case f.AutoCreatetime > 0:
+			r[f.Name] = columnValue(reflect.ValueOf(orm.NewCurTime(f.AutoCreatetime, now)))
+			insertCols = append(insertCols, f.Name)
+		case f.AutoUpdatetime > 0:
+			r[f.Name] = columnValue(reflect.ValueOf(orm.NewCurTime(f.AutoUpdatetime, now)))
+			insertCols = append(insertCols, f.Name)
+		default:
+			fv := fieldOf(rv, f)
+			r[f.Name] = columnValue(fv)
+			// the nil fields are not inserted, see orm.Insert
+			if fv.IsValid() && !orm.IsNil(fv) && !(f.SoftDelete > 0 && reflect.Indirect(fv).IsZero()) {
+				insertCols = append(insertCols, f.Name)
+			}
+		}
+
+		if !f.AutoIncrement {
+			continue
+		}
+
+		if id, ok := toInt64(r[f.Name]); ok && id != 0 {
+			if id > t.autoIncrement {
+				t.autoIncrement = id
+			}
+			lastId = id
+			continue
+		}
+
+		if t.autoIncrement < f.AutoIncrementNum-1 {
+			t.autoIncrement = f.AutoIncrementNum - 1
+		}
+		t.autoIncrement++
+		lastId = t.autoIncrement
+		r[f.Name] = lastId
+	}
+
+	if o.Upsert() {
+		keys, cols := o.UpsertCols(p.Driver, insertCols)
+		for _, old := range t.rows {
+			if len(keys) == 0 || !equalCols(old, r, keys) {
+				continue
+			}
+			for _, col := range cols {
+				old[col] = r[col]
+			}
+			return lastId, nil
+		}
+	}
+
+	key := primaryKey(rv, r, p.Driver)
+	for _, old := range t.rows {
+		if key != "" && primaryKey(rv, old, p.Driver) == key {
+			return 0, errors.NewAlreadyExists(fmt.Sprintf("%s %s", tableName, key))
+		}
+	}
+
+	t.rows = append(t.rows, r)
+	return lastId, nil
+}
+
+func (p *DB) Get(ctx context.Context, into interface{}, opts ...orm.QueryOption) error {
+	o, err := orm.NewOptions(append(opts, orm.WithSample(into))...)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := p.record(VerbGet, o.Table(), o.Selector()); err != nil {
+		return err
+	}
+
+	if err := unsupported(o); err != nil {
+		return err
+	}
+
+	rows, err := p.find(o.Table(), into, o)
+	if err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		return o.Error(errors.NewNotFound("object"))
+	}
+
+	return scanRow(reflect.Indirect(reflect.ValueOf(into)), rows[0], o.Cols(), p.Driver)
+}
+
+func (p *DB) List(ctx context.Context, into interface{}, opts ...orm.QueryOption) error {
+	rv := reflect.Indirect(reflect.ValueOf(into))
+	if rv.Kind() != reflect.Slice || !rv.CanSet() {
+		return fmt.Errorf("fake: List needs a pointer to a slice, got %T", into)
+	}
+	sample := reflect.New(elemType(rv.Type())).Interface()
+
+	o, err := orm.NewOptions(append(opts, orm.WithSample(sample))...)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := p.record(VerbList, o.Table(), o.Selector()); err != nil {
+		return err
+	}
+
+	if err := unsupported(o); err != nil {
+		return err
+	}
+
+	rows, err := p.find(o.Table(), sample, o)
+	if err != nil {
+		return err
+	}
+
+	if err := sortRows(rows, o.Orderby()); err != nil {
+		return err
+	}
+
+	o.SetTotal(len(rows))
+
+	if offset, limit := o.Limit(); limit > 0 {
+		if offset > len(rows) {
+			offset = len(rows)
+		}
+		rows = rows[offset:]
+		if limit < len(rows) {
+			rows = rows[:limit]
+		}
+	}
+
+	et := rv.Type().Elem()
+	for _, r := range rows {
+		v := reflect.New(elemType(rv.Type()))
+		if err := scanRow(v.Elem(), r, o.Cols(), p.Driver); err != nil {
+			return err
+		}
+		if et.Kind() != reflect.Ptr {
+			v = v.Elem()
+		}
+		rv.Set(reflect.Append(rv, v))
+	}
+
+	return nil
+}
+
+func (p *DB) Update(ctx context.Context, sample interface{}, opts ...orm.QueryOption) error {
+	o, err := orm.NewOptions(append(opts, orm.WithSample(sample))...)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := p.record(VerbUpdate, o.Table(), o.Selector()); err != nil {
+		return err
+	}
+
+	rv := reflect.Indirect(reflect.ValueOf(sample))
+	now := orm.Clock().Now()
+
+	set, where, lock := row{}, row{}, row{}
+	var version *orm.StructField
+	for _, f := range orm.GetFields(sample, p.Driver).Fields {
+		if f.AutoCreatetime > 0 {
+			continue
+		}
+		if f.AutoUpdatetime > 0 {
+			set[f.Name] = columnValue(reflect.ValueOf(orm.NewCurTime(f.AutoUpdatetime, now)))
+			continue
+		}
+
+		fv := fieldOf(rv, f)
+		if !fv.IsValid() || orm.IsNil(fv) || (f.SoftDelete > 0 && reflect.Indirect(fv).IsZero()) {
+			continue
+		}
+
+		v := columnValue(fv)
+		switch {
+		case f.Version:
+			n, _ := toInt64(v)
+			set[f.Name], lock[f.Name] = n+1, n
+			version = f
+		case f.Where:
+			where[f.Name] = v
+		default:
+			set[f.Name] = v
+		}
+	}
+
+	if len(set) == 0 {
+		return fmt.Errorf("UPDATE %s `SET` is empty", o.Table())
+	}
+	if o.Selector() == nil && len(where) == 0 {
+		return fmt.Errorf("UPDATE %s `WHERE` is empty", o.Table())
+	}
+
+	rows, err := p.find(o.Table(), sample, o)
+	if err != nil {
+		return err
+	}
+
+	n := 0
+	for _, r := range rows {
+		if (o.Selector() == nil && !equalRow(r, where)) || !equalRow(r, lock) {
+			continue
+		}
+		for k, v := range set {
+			r[k] = v
+		}
+		n++
+	}
+
+	if n == 0 {
+		if version != nil {
+			return errors.NewConflict(o.Table(), fmt.Errorf("the object has been modified, version %v is not found", lock[version.Name]))
+		}
+		return o.Error(errors.NewNotFound("object"))
+	}
+
+	if version != nil {
+		if fv := reflect.Indirect(fieldOf(rv, version)); fv.CanSet() {
+			fv.Set(reflect.ValueOf(set[version.Name]).Convert(fv.Type()))
+		}
+	}
+
+	return nil
+}
+
+func (p *DB) Delete(ctx context.Context, sample interface{}, opts ...orm.QueryOption) error {
+	o, err := orm.NewOptions(append(opts, orm.WithSample(sample))...)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := p.record(VerbDelete, o.Table(), o.Selector()); err != nil {
+		return err
+	}
+
+	if o.Selector() == nil {
+		return fmt.Errorf("selector is nil")
+	}
+
+	rows, err := p.find(o.Table(), sample, o)
+	if err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		return o.Error(errors.NewNotFound("object"))
+	}
+
+	if f := softDeleteField(sample, p.Driver); f != nil && !o.Unscoped() {
+		v := columnValue(reflect.ValueOf(orm.NewCurTime(f.SoftDelete, orm.Clock().Now())))
+		for _, r := range rows {
+			r[f.Name] = v
+		}
+		return nil
+	}
+
+	t := p.table(o.Table())
+	kept := t.rows[:0]
+	for _, r := range t.rows {
+		if !containsRow(rows, r) {
+			kept = append(kept, r)
+		}
+	}
+	t.rows = kept
+
+	return nil
+}
+
+// find returns the rows of the table matched by the selector,
+// the soft deleted rows are skipped unless WithUnscoped
+func (p *DB) find(tableName string, sample interface{}, o interface {
+	Selector() orm.Selector
+	Unscoped() bool
+}) ([]row, error) {
+	t, ok := p.tables[tableName]
+	if !ok {
+		return nil, nil
+	}
+
+	softDelete := softDeleteField(sample, p.Driver)
+
+	var ret []row
+	for _, r := range t.rows {
+		if softDelete != nil && !o.Unscoped() && !isZero(r[softDelete.Name]) {
+			continue
+		}
+
+		ok, err := matches(o.Selector(), r)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			ret = append(ret, r)
+		}
+	}
+	return ret, nil
+}
+
+func (p *DB) Exec(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := p.record(VerbExec, "", nil); err != nil {
+		return nil, err
+	}
+	return nil, errRawSql
+}
+
+func (p *DB) ExecLastId(ctx context.Context, query string, args ...interface{}) (int64, error) {
+	_, err := p.Exec(ctx, query, args...)
+	return 0, err
+}
+
+func (p *DB) ExecNum(ctx context.Context, query string, args ...interface{}) (int64, error) {
+	_, err := p.Exec(ctx, query, args...)
+	return 0, err
+}
+
+func (p *DB) ExecNumErr(ctx context.Context, query string, args ...interface{}) error {
+	_, err := p.Exec(ctx, query, args...)
+	return err
+}
+
+func (p *DB) Query(ctx context.Context, query string, args ...interface{}) *orm.Rows {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := p.record(VerbQuery, "", nil); err != nil {
+		return orm.ErrRows(err)
+	}
+	return orm.ErrRows(errRawSql)
+}
+
+func (p *DB) WithRawDB(raw orm.RawDB) orm.Interface {
+	return p
+}
+
+func (p *DB) RawDB() orm.RawDB {
+	return nil
+}
+
+var errRawSql = fmt.Errorf("fake: the raw sql is not supported")
+
+// unsupported returns the error of the query options which are not implemented by the fake
+func unsupported(o interface {
+	Cursor() bool
+	Preload() []string
+	Cache() bool
+}) error {
+	switch {
+	case o.Cursor():
+		return fmt.Errorf("fake: WithCursor and WithContinue are not supported")
+	case len(o.Preload()) > 0:
+		return fmt.Errorf("fake: WithPreload is not supported")
+	case o.Cache():
+		return fmt.Errorf("fake: WithCache is not supported")
+	}
+	return nil
+}
+
+func elemType(rt reflect.Type) reflect.Type {
+	rt = rt.Elem()
+	if rt.Kind() == reflect.Ptr {
+		rt = rt.Elem()
+	}
+	return rt
+}
+
+// fieldOf returns the field value, invalid if the embedded pointer is nil
+func fieldOf(rv reflect.Value, f *orm.StructField) reflect.Value {
+	fv, err := rv.FieldByIndexErr(f.Index)
+	if err != nil {
+		return reflect.Value{}
+	}
+	return fv
+}
+
+func softDeleteField(sample interface{}, driver orm.Driver) *orm.StructField {
+	for _, f := range orm.GetFields(sample, driver).Fields {
+		if f.SoftDelete > 0 {
+			return f
+		}
+	}
+	return nil
+}
+
+// primaryKey returns the key of the primary_key fields, empty if there is no primary_key
+func primaryKey(rv reflect.Value, r row, driver orm.Driver) string {
+	var keys []string
+	for _, f := range orm.GetFields(rv.Interface(), driver).Fields {
+		if f.PrimaryKey {
+			keys = append(keys, fmt.Sprint(r[f.Name]))
+		}
+	}
+	return strings.Join(keys, "/")
+}
+
+func equalCols(a, b row, cols []string) bool {
+	for _, col := range cols {
+		if compare(a[col], b[col]) != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func equalRow(r, expect row) bool {
+	for k, v := range expect {
+		if compare(r[k], v) != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func containsRow(rows []row, r row) bool {
+	for _, v := range rows {
+		if reflect.ValueOf(v).Pointer() == reflect.ValueOf(r).Pointer() {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,209 @@
+package fake
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yubo/golib/api/errors"
+	"github.com/yubo/golib/orm"
+	"github.com/yubo/golib/util/clock"
+	testingclock "github.com/yubo/golib/util/clock/testing"
+)
+
+type user struct {
+	ID        int    `sql:"primary_key,auto_increment=100"`
+	Name      string `sql:"where"`
+	Age       int
+	City      *string
+	Tags      []string
+	Version   int        `sql:"version"`
+	CreatedAt time.Time  `sql:"auto_createtime"`
+	UpdatedAt int64      `sql:"auto_updatetime"`
+	DeletedAt *time.Time `sql:"soft_delete"`
+}
+
+func TestFake(t *testing.T) {
+	createdAt := time.Unix(1000, 0)
+	c := &testingclock.FakeClock{}
+	c.SetTime(createdAt)
+	orm.SetClock(c)
+	defer orm.SetClock(clock.RealClock{})
+
+	ctx := context.Background()
+	db := New()
+
+	city := "wuhan"
+	id, err := db.InsertLastId(ctx, &user{Name: "tom", Age: 14, City: &city, Tags: []string{"a"}})
+	require.NoError(t, err)
+	assert.Equal(t, int64(100), id)
+
+	require.NoError(t, db.InsertBatch(ctx, []user{{Name: "jerry", Age: 12}, {Name: "spike", Age: 30}}))
+
+	err = db.Insert(ctx, &user{ID: 100, Name: "tom"})
+	assert.True(t, errors.IsAlreadyExists(err), "primary key conflict")
+
+	var got user
+	require.NoError(t, db.Get(ctx, &got, orm.WithSelector("name=tom")))
+	assert.Equal(t, user{
+		ID:        100,
+		Name:      "tom",
+		Age:       14,
+		City:      &city,
+		Tags:      []string{"a"},
+		CreatedAt: createdAt,
+		UpdatedAt: createdAt.Unix(),
+	}, got)
+
+	err = db.Get(ctx, &got, orm.WithSelector("name=unknown"))
+	assert.True(t, errors.IsNotFound(err))
+
+	cases := []struct {
+		selector string
+		orderby  []string
+		offset   int
+		limit    int
+		want     []string
+		total    int
+	}{
+		{"", []string{"age"}, 0, 0, []string{"jerry", "tom", "spike"}, 3},
+		{"age>12", []string{"age desc"}, 0, 0, []string{"spike", "tom"}, 2},
+		{"age between (12,14)", []string{"name"}, 0, 0, []string{"jerry", "tom"}, 2},
+		{"name in (tom,spike)", []string{"id desc"}, 0, 1, []string{"spike"}, 2},
+		{"(age<13 or name=~sp)", []string{"id"}, 1, 5, []string{"spike"}, 2},
+		{"city", nil, 0, 0, []string{"tom"}, 1},
+		{"!city", []string{"id"}, 0, 0, []string{"jerry", "spike"}, 2},
+		{"name~er", nil, 0, 0, []string{"jerry"}, 1},
+	}
+	for i, c := range cases {
+		var list []*user
+		var total int
+		err := db.List(ctx, &list,
+			orm.WithSelector(c.selector),
+			orm.WithOrderby(c.orderby...),
+			orm.WithLimit(c.offset, c.limit),
+			orm.WithTotal(&total))
+		require.NoError(t, err, fmt.Sprintf("case-%d", i))
+
+		names := []string{}
+		for _, v := range list {
+			names = append(names, v.Name)
+		}
+		assert.Equal(t, c.want, names, fmt.Sprintf("case-%d", i))
+		assert.Equal(t, c.total, total, fmt.Sprintf("case-%d", i))
+	}
+
+	// update by the where field, with optimistic locking
+	c.SetTime(time.Unix(2000, 0))
+	u := &user{Name: "tom", Age: 15}
+	require.NoError(t, db.Update(ctx, u))
+	assert.Equal(t, 1, u.Version)
+	require.NoError(t, db.Get(ctx, &got, orm.WithSelector("name=tom")))
+	assert.Equal(t, 15, got.Age)
+	assert.Equal(t, int64(2000), got.UpdatedAt)
+	assert.Equal(t, createdAt, got.CreatedAt)
+
+	err = db.Update(ctx, &user{Name: "tom", Age: 16})
+	assert.True(t, errors.IsConflict(err), "version 0 is outdated")
+
+	// soft delete
+	require.NoError(t, db.Delete(ctx, &user{}, orm.WithSelector("name=jerry")))
+	err = db.Get(ctx, &got, orm.WithSelector("name=jerry"))
+	assert.True(t, errors.IsNotFound(err))
+	require.NoError(t, db.Get(ctx, &got, orm.WithSelector("name=jerry"), orm.WithUnscoped()))
+	assert.NotNil(t, got.DeletedAt)
+
+	// raw sql
+	_, err = db.Exec(ctx, "DELETE FROM user")
+	assert.Error(t, err)
+
+	tables, err := db.GetTables(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"user"}, tables)
+}
+
+func TestFakeOps(t *testing.T) {
+	type test struct {
+		Name string `sql:"primary_key"`
+	}
+
+	ctx := context.Background()
+	db := New()
+
+	require.NoError(t, db.Insert(ctx, &test{Name: "tom"}))
+	require.NoError(t, db.Get(ctx, &test{}, orm.WithSelector("name=tom")))
+	require.NoError(t, db.Delete(ctx, &test{}, orm.WithSelector("name=tom")))
+
+	ops := []string{}
+	for _, op := range db.Ops() {
+		ops = append(ops, op.String())
+	}
+	assert.Equal(t, []string{"insert test", "get test name=tom", "delete test name=tom"}, ops)
+
+	db.Reset()
+	assert.Len(t, db.Ops(), 0)
+
+	injected := fmt.Errorf("injected")
+	db.InjectError("test", VerbInsert, injected)
+	assert.Equal(t, injected, db.Insert(ctx, &test{Name: "jerry"}))
+	require.NoError(t, db.Insert(ctx, &test{Name: "jerry"}, orm.WithTable("other")))
+
+	db.InjectError("", VerbList, injected)
+	assert.Equal(t, injected, db.List(ctx, &[]test{}, orm.WithTable("other")))
+
+	db.InjectError("test", VerbInsert, nil)
+	require.NoError(t, db.Insert(ctx, &test{Name: "jerry"}))
+}
+
+func TestFakeUpsert(t *testing.T) {
+	type item struct {
+		ID        int `sql:"primary_key"`
+		Name      string
+		Count     int
+		CreatedAt int64 `sql:"auto_createtime"`
+		UpdatedAt int64 `sql:"auto_updatetime"`
+	}
+
+	c := &testingclock.FakeClock{}
+	c.SetTime(time.Unix(1000, 0))
+	orm.SetClock(c)
+	defer orm.SetClock(clock.RealClock{})
+
+	ctx := context.Background()
+	db := New()
+
+	require.NoError(t, db.Insert(ctx, &item{ID: 1, Name: "a", Count: 1}))
+
+	// the created_at and the conflict keys are kept
+	c.SetTime(time.Unix(2000, 0))
+	require.NoError(t, db.Insert(ctx, &item{ID: 1, Name: "b", Count: 2}, orm.WithUpsert()))
+
+	var got item
+	require.NoError(t, db.Get(ctx, &got, orm.WithSelector("id=1")))
+	assert.Equal(t, item{ID: 1, Name: "b", Count: 2, CreatedAt: 1000, UpdatedAt: 2000}, got)
+
+	// only the cols of WithUpsert are updated
+	c.SetTime(time.Unix(3000, 0))
+	require.NoError(t, db.InsertBatch(ctx, []item{{ID: 1, Name: "c", Count: 3}, {ID: 2, Name: "d"}}, orm.WithUpsert("count")))
+
+	var list []item
+	require.NoError(t, db.List(ctx, &list, orm.WithOrderby("id")))
+	assert.Equal(t, []item{
+		{ID: 1, Name: "b", Count: 3, CreatedAt: 1000, UpdatedAt: 2000},
+		{ID: 2, Name: "d", CreatedAt: 3000, UpdatedAt: 3000},
+	}, list)
+
+	// the options not supported by the fake
+	for i, opt := range []orm.QueryOption{
+		orm.WithCursor("x"),
+		orm.WithContinue(new(string)),
+		orm.WithPreload("Items"),
+		orm.WithCache(time.Second),
+	} {
+		assert.Error(t, db.List(ctx, &list, opt), fmt.Sprintf("case-%d", i))
+		assert.Error(t, db.Get(ctx, &got, orm.WithSelector("id=1"), opt), fmt.Sprintf("case-%d", i))
+	}
+}
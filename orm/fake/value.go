@@ -0,0 +1,408 @@
+package fake
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yubo/golib/orm"
+	"github.com/yubo/golib/selection"
+)
+
+// jsonValue the struct, map and slice are stored as json, like orm does
+type jsonValue []byte
+
+// columnValue converts the field value to the stored value,
+// int64, uint64, float64, bool, string, []byte, time.Time, jsonValue or nil
+func columnValue(fv reflect.Value) interface{} {
+	if !fv.IsValid() || orm.IsNil(fv) {
+		return nil
+	}
+	fv = reflect.Indirect(fv)
+
+	if t, ok := fv.Interface().(time.Time); ok {
+		return t
+	}
+
+	switch fv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return fv.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return fv.Uint()
+	case reflect.Float32, reflect.Float64:
+		return fv.Float()
+	case reflect.Bool:
+		return fv.Bool()
+	case reflect.String:
+		return fv.String()
+	case reflect.Slice:
+		if fv.Type().Elem().Kind() == reflect.Uint8 {
+			return append([]byte{}, fv.Bytes()...)
+		}
+	}
+
+	b, err := json.Marshal(fv.Interface())
+	if err != nil {
+		return nil
+	}
+	return jsonValue(b)
+}
+
+// setValue sets the stored value to the field
+func setValue(fv reflect.Value, v interface{}) error {
+	if v == nil {
+		fv.Set(reflect.Zero(fv.Type()))
+		return nil
+	}
+
+	if fv.Kind() == reflect.Ptr {
+		if fv.IsNil() {
+			fv.Set(reflect.New(fv.Type().Elem()))
+		}
+		fv = fv.Elem()
+	}
+
+	if b, ok := v.(jsonValue); ok {
+		return json.Unmarshal(b, fv.Addr().Interface())
+	}
+
+	rv := reflect.ValueOf(v)
+	switch {
+	case rv.Type().AssignableTo(fv.Type()):
+		fv.Set(rv)
+	case fv.Kind() == reflect.String:
+		fv.SetString(fmt.Sprint(v))
+	case rv.Kind() != reflect.String && rv.Type().ConvertibleTo(fv.Type()):
+		fv.Set(rv.Convert(fv.Type()))
+	default:
+		return fmt.Errorf("fake: unable to set %T to %s", v, fv.Type())
+	}
+	return nil
+}
+
+// scanRow sets the columns of the row to the struct, only the cols are set if it's not empty
+func scanRow(rv reflect.Value, r row, cols []string, driver orm.Driver) error {
+	if rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			rv.Set(reflect.New(rv.Type().Elem()))
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct || !rv.CanSet() {
+		return fmt.Errorf("scan target can not be set")
+	}
+
+	for _, f := range orm.GetFields(rv.Interface(), driver).Fields {
+		if len(cols) > 0 && !contains(cols, f.Name) {
+			continue
+		}
+
+		v, ok := r[f.Name]
+		if !ok {
+			continue
+		}
+
+		fv, err := fieldByIndex(rv, f.Index)
+		if err != nil {
+			return err
+		}
+		if err := setValue(fv, v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// fieldByIndex returns the field, the nil embedded pointer is allocated
+func fieldByIndex(rv reflect.Value, index []int) (reflect.Value, error) {
+	for i, x := range index {
+		if i > 0 && rv.Kind() == reflect.Ptr {
+			if rv.IsNil() {
+				rv.Set(reflect.New(rv.Type().Elem()))
+			}
+			rv = rv.Elem()
+		}
+		rv = rv.Field(x)
+	}
+	return rv, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func toInt64(v interface{}) (int64, bool) {
+	switch n := v.(type) {
+	case int64:
+		return n, true
+	case uint64:
+		return int64(n), true
+	case float64:
+		return int64(n), true
+	}
+	return 0, false
+}
+
+func isZero(v interface{}) bool {
+	return v == nil || reflect.ValueOf(v).IsZero()
+}
+
+// compare compares the stored values, nil is the smallest
+func compare(a, b interface{}) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+
+	if s, ok := b.(string); ok {
+		if _, ok := a.(string); !ok {
+			return compareString(a, s)
+		}
+	}
+
+	switch x := a.(type) {
+	case int64:
+		if y, ok := toFloat64(b); ok {
+			return compareFloat(float64(x), y)
+		}
+	case uint64:
+		if y, ok := toFloat64(b); ok {
+			return compareFloat(float64(x), y)
+		}
+	case float64:
+		if y, ok := toFloat64(b); ok {
+			return compareFloat(x, y)
+		}
+	case time.Time:
+		if y, ok := b.(time.Time); ok {
+			return x.Compare(y)
+		}
+	case bool:
+		if y, ok := b.(bool); ok {
+			return compareFloat(boolFloat(x), boolFloat(y))
+		}
+	}
+
+	return strings.Compare(toString(a), toString(b))
+}
+
+// compareString compares the stored value with the value of the selector
+func compareString(a interface{}, s string) int {
+	switch x := a.(type) {
+	case int64, uint64, float64:
+		if y, err := strconv.ParseFloat(s, 64); err == nil {
+			f, _ := toFloat64(x)
+			return compareFloat(f, y)
+		}
+	case bool:
+		if y, err := strconv.ParseBool(s); err == nil {
+			return compareFloat(boolFloat(x), boolFloat(y))
+		}
+	case time.Time:
+		if y, ok := parseTime(s); ok {
+			return x.Compare(y)
+		}
+	}
+
+	return strings.Compare(toString(a), s)
+}
+
+func parseTime(s string) (time.Time, bool) {
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(n, 0), true
+	}
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02 15:04:05", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func toFloat64(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int64:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+func toString(v interface{}) string {
+	switch s := v.(type) {
+	case string:
+		return s
+	case []byte:
+		return string(s)
+	case jsonValue:
+		return string(s)
+	}
+	return fmt.Sprint(v)
+}
+
+func compareFloat(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func boolFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// sortRows sorts the rows by the order by cols, e.g. "name", "age desc"
+func sortRows(rows []row, orderby []string) error {
+	type order struct {
+		name string
+		desc bool
+	}
+
+	orders := make([]order, 0, len(orderby))
+	for _, v := range orderby {
+		fields := strings.Fields(v)
+		if len(fields) == 0 || len(fields) > 2 {
+			return fmt.Errorf("fake: unsupported order by %q", v)
+		}
+
+		o := order{name: strings.Trim(fields[0], "`\"")}
+		if len(fields) == 2 {
+			switch strings.ToLower(fields[1]) {
+			case "asc":
+			case "desc":
+				o.desc = true
+			default:
+				return fmt.Errorf("fake: unsupported order by %q", v)
+			}
+		}
+		orders = append(orders, o)
+	}
+
+	sort.SliceStable(rows, func(i, j int) bool {
+		for _, o := range orders {
+			c := compare(rows[i][o.name], rows[j][o.name])
+			if c == 0 {
+				continue
+			}
+			if o.desc {
+				return c > 0
+			}
+			return c < 0
+		}
+		return false
+	})
+
+	return nil
+}
+
+// matches evaluates the selector on the row, like the sql generated by the selector
+func matches(selector orm.Selector, r row) (bool, error) {
+	if selector == nil {
+		return true, nil
+	}
+
+	reqs, _ := selector.Requirements()
+	return matchRequirements(reqs, r)
+}
+
+func matchRequirements(reqs orm.Requirements, r row) (bool, error) {
+	for i := range reqs {
+		ok, err := matchRequirement(&reqs[i], r)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func matchRequirement(req *orm.Requirement, r row) (bool, error) {
+	if req.Operator() == selection.Or {
+		for _, group := range req.Groups() {
+			ok, err := matchRequirements(group, r)
+			if err != nil || ok {
+				return ok, err
+			}
+		}
+		return false, nil
+	}
+
+	v, ok := r[req.Key()]
+	if !ok {
+		return false, fmt.Errorf("fake: no such column: %s", req.Key())
+	}
+
+	values := req.ValuesUnsorted()
+	cmp := func(s string) int { return compareString(v, s) }
+
+	switch req.Operator() {
+	case selection.Exists:
+		return v != nil, nil
+	case selection.DoesNotExist:
+		return v == nil, nil
+	}
+
+	// the comparison with NULL is false
+	if v == nil {
+		return false, nil
+	}
+
+	switch req.Operator() {
+	case selection.In, selection.Equals, selection.DoubleEquals:
+		for _, s := range values {
+			if cmp(s) == 0 {
+				return true, nil
+			}
+		}
+		return false, nil
+	case selection.NotIn, selection.NotEquals:
+		for _, s := range values {
+			if cmp(s) == 0 {
+				return false, nil
+			}
+		}
+		return true, nil
+	case selection.GreaterThan:
+		return cmp(values[0]) > 0, nil
+	case selection.LessThan:
+		return cmp(values[0]) < 0, nil
+	case selection.GreaterThanOrEquals:
+		return cmp(values[0]) >= 0, nil
+	case selection.LessThanOrEquals:
+		return cmp(values[0]) <= 0, nil
+	case selection.Between:
+		return cmp(values[0]) >= 0 && cmp(values[1]) <= 0, nil
+	case selection.Contains:
+		return strings.Contains(toString(v), values[0]), nil
+	case selection.NotContains:
+		return !strings.Contains(toString(v), values[0]), nil
+	case selection.HasPrefix:
+		return strings.HasPrefix(toString(v), values[0]), nil
+	case selection.HasSuffix:
+		return strings.HasSuffix(toString(v), values[0]), nil
+	}
+
+	return false, fmt.Errorf("fake: unsupported operator %s", req.Operator())
+}
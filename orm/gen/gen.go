@@ -0,0 +1,371 @@
+// Package gen generates the go structs from the tables of an existing database,
+// the reverse of AutoMigrate, AutoMigrate on the generated structs is a no-op.
+//
+//	b, err := gen.Generate(ctx, db, gen.WithPackage("model"), gen.WithTables("user*"))
+package gen
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"go/format"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/yubo/golib/orm"
+	"github.com/yubo/golib/util"
+)
+
+const DefaultPackage = "model"
+
+// https://github.com/golang/lint/blob/master/lint.go#L770
+var commonInitialisms = map[string]bool{
+	"API": true, "ASCII": true, "CPU": true, "CSS": true, "DNS": true, "EOF": true, "GUID": true,
+	"HTML": true, "HTTP": true, "HTTPS": true, "ID": true, "IP": true, "JSON": true, "LHS": true,
+	"QPS": true, "RAM": true, "RHS": true, "RPC": true, "SLA": true, "SMTP": true, "SSH": true,
+	"TLS": true, "TTL": true, "UID": true, "UI": true, "UUID": true, "URI": true, "URL": true,
+	"UTF8": true, "VM": true, "XML": true, "XSRF": true, "XSS": true,
+}
+
+type Option func(*generator)
+
+// WithPackage set the package name of the generated file, default "model"
+func WithPackage(name string) Option {
+	return func(p *generator) {
+		p.pkg = name
+	}
+}
+
+// WithTables only the tables matching one of the patterns are generated, see path.Match
+func WithTables(patterns ...string) Option {
+	return func(p *generator) {
+		p.includes = append(p.includes, patterns...)
+	}
+}
+
+// WithExcludeTables the tables matching one of the patterns are skipped, see path.Match
+func WithExcludeTables(patterns ...string) Option {
+	return func(p *generator) {
+		p.excludes = append(p.excludes, patterns...)
+	}
+}
+
+type generator struct {
+	pkg      string
+	includes []string
+	excludes []string
+}
+
+// Generate returns the gofmt-ed source of the structs of the tables
+func Generate(ctx context.Context, db orm.Interface, opts ...Option) ([]byte, error) {
+	p := &generator{pkg: DefaultPackage}
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	tables, err := db.GetTables(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(tables)
+
+	structs := []*structDef{}
+	for _, table := range tables {
+		ok, err := p.match(table)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+
+		o, err := orm.NewOptions(orm.WithTable(table))
+		if err != nil {
+			return nil, err
+		}
+		columns, err := db.ColumnTypes(ctx, o)
+		if err != nil {
+			return nil, fmt.Errorf("table %s: %s", table, err)
+		}
+
+		structs = append(structs, newStructDef(table, columns))
+	}
+
+	return render(p.pkg, structs)
+}
+
+func (p *generator) match(table string) (bool, error) {
+	// e.g. sqlite_sequence
+	if strings.HasPrefix(table, "sqlite_") {
+		return false, nil
+	}
+
+	for _, pattern := range p.excludes {
+		if ok, err := path.Match(pattern, table); err != nil || ok {
+			return false, err
+		}
+	}
+
+	if len(p.includes) == 0 {
+		return true, nil
+	}
+
+	for _, pattern := range p.includes {
+		if ok, err := path.Match(pattern, table); err != nil || ok {
+			return ok, err
+		}
+	}
+
+	return false, nil
+}
+
+type structDef struct {
+	Name    string
+	Table   string
+	Namer   bool // generate the Name() method if the table can't be derived from the struct name
+	Comment string
+	Fields  []*fieldDef
+}
+
+type fieldDef struct {
+	Name    string
+	Type    string
+	Tag     string
+	Comment string
+}
+
+func newStructDef(table string, columns []orm.StructField) *structDef {
+	s := &structDef{
+		Name:  goName(table),
+		Table: table,
+	}
+
+	names := map[string]int{}
+	for i := range columns {
+		f := newFieldDef(&columns[i])
+		if n := names[f.Name]; n > 0 {
+			f.Name += strconv.Itoa(n)
+		}
+		names[f.Name]++
+		s.Fields = append(s.Fields, f)
+	}
+
+	// the table is util.SnakeCasedName(sample.Name()) if the sample is a orm.Namer
+	if util.SnakeCasedName(s.Name) != table {
+		s.Namer = util.SnakeCasedName(table) == table
+		for _, f := range s.Fields {
+			if f.Name == "Name" {
+				s.Namer = false
+			}
+		}
+		if !s.Namer {
+			s.Comment = fmt.Sprintf("use orm.WithTable(%q) with %s", table, s.Name)
+		}
+	}
+
+	return s
+}
+
+func newFieldDef(c *orm.StructField) *fieldDef {
+	f := &fieldDef{Name: goName(c.Name)}
+
+	typ, known := goType(c.DriverDataType)
+	if !known {
+		f.Comment = "unknown type " + c.DriverDataType
+	}
+	notNull := util.BoolValue(c.NotNull)
+	if !notNull && !c.PrimaryKey && typ != "[]byte" {
+		typ = "*" + typ
+	}
+	f.Type = typ
+
+	tags := []string{}
+	if util.SnakeCasedName(f.Name) != c.Name {
+		tags = append(tags, "name="+c.Name)
+	}
+	if c.PrimaryKey {
+		tags = append(tags, "primary_key")
+	}
+	if c.AutoIncrement {
+		tags = append(tags, "auto_increment")
+	}
+	if c.Size != nil && *c.Size > 0 {
+		tags = append(tags, fmt.Sprintf("size=%d", *c.Size))
+	}
+	if notNull {
+		tags = append(tags, "not_null")
+	}
+	if util.BoolValue(c.Unique) {
+		tags = append(tags, "unique")
+	} else if c.IndexKey {
+		tags = append(tags, "index")
+	}
+	// the tag is split by ","
+	if def := quoteDefault(c.DefaultValue); c.HasDefaultValue && !c.AutoIncrement && !strings.Contains(def, ",") {
+		tags = append(tags, "default="+def)
+	}
+	if comment := util.StringValue(c.Comment); comment != "" {
+		comment = strings.Join(strings.Fields(comment), " ")
+		if !strings.Contains(comment, ",") {
+			tags = append(tags, "comment="+comment)
+		}
+		f.Comment = strings.TrimSpace(f.Comment + " " + comment)
+	}
+
+	tag := fmt.Sprintf(`json:"%s"`, c.Name)
+	if len(tags) > 0 {
+		tag = fmt.Sprintf(`sql:%s %s`, strconv.Quote(strings.Join(tags, ",")), tag)
+	}
+	if strings.Contains(tag, "`") {
+		f.Tag = strconv.Quote(tag)
+	} else {
+		f.Tag = "`" + tag + "`"
+	}
+
+	return f
+}
+
+var regDefaultFunc = regexp.MustCompile(`(?i)^(null|true|false|current_(timestamp|date|time)|localtime(stamp)?)$|^\w+\(.*\)$|^\(.*\)$`)
+
+// quoteDefault quotes the string default value, mysql returns it unquoted,
+// e.g. x -> 'x', the quoted values, numbers and functions are kept
+func quoteDefault(v string) string {
+	if len(v) >= 2 && strings.HasPrefix(v, "'") && strings.HasSuffix(v, "'") {
+		return v
+	}
+	if _, err := strconv.ParseFloat(v, 64); err == nil {
+		return v
+	}
+	if regDefaultFunc.MatchString(v) {
+		return v
+	}
+	return "'" + strings.ReplaceAll(v, "'", "''") + "'"
+}
+
+var regDataType = regexp.MustCompile(`^([a-z ]+?)\s*(?:\((\d+)(?:\s*,\s*\d+)?\))?((?:\s+\w+)*)$`)
+
+// goType returns the go type of the column type of mysql or sqlite,
+// e.g. "int unsigned" -> "uint32", "varchar(32)" -> "string"
+func goType(dataType string) (typ string, known bool) {
+	dataType = strings.ToLower(strings.TrimSpace(dataType))
+	// e.g. enum('a','b')
+	if strings.HasPrefix(dataType, "enum(") || strings.HasPrefix(dataType, "set(") {
+		return "string", true
+	}
+
+	m := regDataType.FindStringSubmatch(dataType)
+	if m == nil {
+		return "string", false
+	}
+	base, size := strings.TrimSpace(m[1]), m[2]
+
+	unsigned := strings.Contains(m[3], "unsigned")
+	integer := func(bits string) string {
+		if unsigned {
+			return "uint" + bits
+		}
+		return "int" + bits
+	}
+
+	switch base {
+	case "bool", "boolean":
+		return "bool", true
+	case "numeric":
+		// the orm creates the bool column as numeric on sqlite
+		return "bool", true
+	case "tinyint":
+		if size == "1" {
+			return "bool", true
+		}
+		return integer("8"), true
+	case "smallint":
+		return integer("16"), true
+	case "mediumint", "int":
+		return integer("32"), true
+	case "integer", "bigint":
+		return integer("64"), true
+	case "float":
+		return "float32", true
+	case "double", "double precision", "real", "decimal":
+		return "float64", true
+	case "char", "varchar", "character", "nchar", "nvarchar", "clob",
+		"text", "tinytext", "mediumtext", "longtext", "enum", "set", "json":
+		return "string", true
+	case "binary", "varbinary", "blob", "tinyblob", "mediumblob", "longblob":
+		return "[]byte", true
+	case "date", "datetime", "timestamp":
+		return "time.Time", true
+	}
+
+	return "string", false
+}
+
+// goName returns the exported go name of the table or the column, e.g. "user_id" -> "UserID"
+func goName(name string) string {
+	parts := strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	var b strings.Builder
+	for _, part := range parts {
+		if upper := strings.ToUpper(part); commonInitialisms[upper] {
+			b.WriteString(upper)
+			continue
+		}
+		rs := []rune(part)
+		rs[0] = unicode.ToUpper(rs[0])
+		b.WriteString(string(rs))
+	}
+
+	s := b.String()
+	if s == "" || !unicode.IsLetter([]rune(s)[0]) {
+		s = "X" + s
+	}
+	return s
+}
+
+func render(pkg string, structs []*structDef) ([]byte, error) {
+	buf := &bytes.Buffer{}
+
+	fmt.Fprintf(buf, "// Code generated by orm-gen. DO NOT EDIT.\n\npackage %s\n\n", pkg)
+	if needTime(structs) {
+		buf.WriteString("import \"time\"\n\n")
+	}
+
+	for _, s := range structs {
+		fmt.Fprintf(buf, "// %s is generated from the table %s\n", s.Name, s.Table)
+		if s.Comment != "" {
+			fmt.Fprintf(buf, "// %s\n", s.Comment)
+		}
+		fmt.Fprintf(buf, "type %s struct {\n", s.Name)
+		for _, f := range s.Fields {
+			fmt.Fprintf(buf, "%s %s %s", f.Name, f.Type, f.Tag)
+			if f.Comment != "" {
+				fmt.Fprintf(buf, " // %s", f.Comment)
+			}
+			buf.WriteString("\n")
+		}
+		buf.WriteString("}\n\n")
+
+		if s.Namer {
+			fmt.Fprintf(buf, "func (%s) Name() string { return %q }\n\n", s.Name, s.Table)
+		}
+	}
+
+	return format.Source(buf.Bytes())
+}
+
+func needTime(structs []*structDef) bool {
+	for _, s := range structs {
+		for _, f := range s.Fields {
+			if strings.HasSuffix(f.Type, "time.Time") {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,134 @@
+package gen
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yubo/golib/orm"
+	"github.com/yubo/golib/util"
+
+	_ "github.com/yubo/golib/orm/sqlite"
+)
+
+func TestGoType(t *testing.T) {
+	cases := []struct {
+		dataType string
+		want     string
+		known    bool
+	}{
+		{"int", "int32", true},
+		{"int(10) unsigned", "uint32", true},
+		{"bigint unsigned", "uint64", true},
+		{"tinyint(1)", "bool", true},
+		{"tinyint(4)", "int8", true},
+		{"INTEGER", "int64", true},
+		{"varchar(32)", "string", true},
+		{"decimal(10,2)", "float64", true},
+		{"double precision", "float64", true},
+		{"enum('a','b')", "string", true},
+		{"longblob", "[]byte", true},
+		{"datetime(3)", "time.Time", true},
+		{"geometry", "string", false},
+	}
+	for i, c := range cases {
+		got, known := goType(c.dataType)
+		assert.Equal(t, c.want, got, fmt.Sprintf("case-%d", i))
+		assert.Equal(t, c.known, known, fmt.Sprintf("case-%d", i))
+	}
+}
+
+func TestGoName(t *testing.T) {
+	cases := []struct {
+		name string
+		want string
+	}{
+		{"user", "User"},
+		{"user_id", "UserID"},
+		{"api_key", "APIKey"},
+		{"user-info", "UserInfo"},
+		{"2fa", "X2fa"},
+	}
+	for i, c := range cases {
+		assert.Equal(t, c.want, goName(c.name), fmt.Sprintf("case-%d", i))
+	}
+}
+
+func TestNewFieldDef(t *testing.T) {
+	// the columns of mysql, the string default value is unquoted
+	cases := []struct {
+		field orm.StructField
+		want  fieldDef
+	}{
+		{orm.StructField{Name: "name", DriverDataType: "varchar(32)", Size: util.Int64(32), NotNull: util.Bool(true), HasDefaultValue: true, DefaultValue: "x"},
+			fieldDef{Name: "Name", Type: "string", Tag: "`sql:\"size=32,not_null,default='x'\" json:\"name\"`"}},
+		{orm.StructField{Name: "note", DriverDataType: "varchar(32)", Size: util.Int64(32), HasDefaultValue: true, DefaultValue: "it's"},
+			fieldDef{Name: "Note", Type: "*string", Tag: "`sql:\"size=32,default='it''s'\" json:\"note\"`"}},
+		{orm.StructField{Name: "empty", DriverDataType: "varchar(32)", Size: util.Int64(32), HasDefaultValue: true, DefaultValue: ""},
+			fieldDef{Name: "Empty", Type: "*string", Tag: "`sql:\"size=32,default=''\" json:\"empty\"`"}},
+		{orm.StructField{Name: "age", DriverDataType: "int", NotNull: util.Bool(true), HasDefaultValue: true, DefaultValue: "-1"},
+			fieldDef{Name: "Age", Type: "int32", Tag: "`sql:\"not_null,default=-1\" json:\"age\"`"}},
+		{orm.StructField{Name: "created_at", DriverDataType: "datetime", NotNull: util.Bool(true), HasDefaultValue: true, DefaultValue: "CURRENT_TIMESTAMP"},
+			fieldDef{Name: "CreatedAt", Type: "time.Time", Tag: "`sql:\"not_null,default=CURRENT_TIMESTAMP\" json:\"created_at\"`"}},
+		{orm.StructField{Name: "updated_at", DriverDataType: "datetime(3)", HasDefaultValue: true, DefaultValue: "now(3)"},
+			fieldDef{Name: "UpdatedAt", Type: "*time.Time", Tag: "`sql:\"default=now(3)\" json:\"updated_at\"`"}},
+		{orm.StructField{Name: "tags", DriverDataType: "varchar(32)", HasDefaultValue: true, DefaultValue: "a,b"},
+			fieldDef{Name: "Tags", Type: "*string", Tag: "`json:\"tags\"`"}},
+	}
+	for i, c := range cases {
+		assert.Equal(t, c.want, *newFieldDef(&c.field), fmt.Sprintf("case-%d", i))
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	db, err := orm.Open("sqlite3", "file:gen_test.db?cache=shared&mode=memory")
+	require.NoError(t, err)
+	defer db.Close()
+
+	ctx := context.Background()
+	require.NoError(t, db.ExecRows([]byte("CREATE TABLE `user_profile` (`id` integer PRIMARY KEY AUTOINCREMENT, `user_id` integer NOT NULL, `nick_name` varchar(32) NOT NULL DEFAULT 'x', `email` text UNIQUE, `score` real, `avatar` blob, `created_at` datetime);\n"+
+		"CREATE INDEX `user_id` ON user_profile(user_id);\n"+
+		"CREATE TABLE `user-tag` (`tag` text);\n"+
+		"CREATE TABLE `other` (`name` text);\n")))
+
+	b, err := Generate(ctx, db, WithPackage("model"), WithTables("user*"), WithExcludeTables("*tag"))
+	require.NoError(t, err)
+	assert.Equal(t, `// Code generated by orm-gen. DO NOT EDIT.
+
+package model
+
+import "time"
+
+// UserProfile is generated from the table user_profile
+type UserProfile struct {
+	ID        int64      `+"`"+`sql:"primary_key,auto_increment" json:"id"`+"`"+`
+	UserID    int64      `+"`"+`sql:"not_null,index" json:"user_id"`+"`"+`
+	NickName  string     `+"`"+`sql:"size=32,not_null,default='x'" json:"nick_name"`+"`"+`
+	Email     *string    `+"`"+`sql:"unique" json:"email"`+"`"+`
+	Score     *float64   `+"`"+`json:"score"`+"`"+`
+	Avatar    []byte     `+"`"+`json:"avatar"`+"`"+`
+	CreatedAt *time.Time `+"`"+`json:"created_at"`+"`"+`
+}
+`, string(b))
+
+	b, err = Generate(ctx, db, WithTables("user-tag"))
+	require.NoError(t, err)
+	assert.Contains(t, string(b), `func (UserTag) Name() string { return "user-tag" }`)
+
+	// AutoMigrate on the generated struct is a no-op
+	type UserProfile struct {
+		ID        int64      `sql:"primary_key,auto_increment" json:"id"`
+		UserID    int64      `sql:"not_null,index" json:"user_id"`
+		NickName  string     `sql:"size=32,not_null,default='x'" json:"nick_name"`
+		Email     *string    `sql:"unique" json:"email"`
+		Score     *float64   `json:"score"`
+		Avatar    []byte     `json:"avatar"`
+		CreatedAt *time.Time `json:"created_at"`
+	}
+	changes, err := db.PlanMigrate(ctx, &UserProfile{})
+	require.NoError(t, err)
+	assert.Empty(t, changes, changes.String())
+}
@@ -0,0 +1,197 @@
+package orm
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/yubo/golib/util/telemetry"
+	"github.com/yubo/golib/util/trace"
+	"k8s.io/klog/v2"
+)
+
+var (
+	_ Hook = &slowQueryHook{}
+	_ Hook = &metricsHook{}
+	_ Hook = &traceHook{}
+)
+
+// Hook observes the statements executed by the orm, set by WithHooks
+type Hook interface {
+	// BeforeQuery is called before the statement is executed,
+	// the returned context is passed to the driver and AfterQuery
+	BeforeQuery(ctx context.Context, e *QueryEvent) context.Context
+
+	// AfterQuery is called after the statement is executed,
+	// Duration, Rows and Err of the event are set
+	AfterQuery(ctx context.Context, e *QueryEvent)
+}
+
+// QueryEvent describes a statement executed by the orm
+type QueryEvent struct {
+	// Query the statement with '?' bind vars, before rebinding by the dialect
+	Query string
+	// Args the args of the query, the slice args are expanded
+	Args []interface{}
+	// Verb the lower case verb of the statement, e.g. select, insert
+	Verb string
+	// Table the table of the statement, it may be empty
+	Table string
+
+	Start    time.Time
+	Duration time.Duration
+	// Rows the rows affected of Exec, -1 for Query
+	Rows int64
+	Err  error
+}
+
+func newQueryEvent(query string, args []interface{}) *QueryEvent {
+	verb, table := parseStatement(query)
+	return &QueryEvent{
+		Query: query,
+		Args:  args,
+		Verb:  verb,
+		Table: table,
+		Rows:  -1,
+	}
+}
+
+// Sql returns the statement with the interpolated args
+func (p *QueryEvent) Sql() string {
+	sql, err := interpolateParams(p.Query, p.Args)
+	if err != nil {
+		return p.Query
+	}
+	return sql
+}
+
+// parseStatement returns the verb and the table of the statement
+//
+//	SELECT * FROM `user` WHERE ... --> select, user
+//	INSERT INTO "user" ...         --> insert, user
+//	UPDATE user SET ...            --> update, user
+func parseStatement(query string) (verb, table string) {
+	words := strings.Fields(query)
+	if len(words) == 0 {
+		return "", ""
+	}
+
+	verb = strings.ToLower(words[0])
+
+	var after string
+	switch verb {
+	case "select", "delete":
+		after = "from"
+	case "insert", "replace":
+		after = "into"
+	case "update":
+		after = "update"
+	case "create", "drop", "alter", "truncate":
+		after = "table"
+	default:
+		return verb, ""
+	}
+
+	for i, w := range words[:len(words)-1] {
+		if strings.EqualFold(w, after) {
+			table = words[i+1]
+			if strings.EqualFold(table, "if") && i+3 < len(words) {
+				// IF [NOT] EXISTS
+				table = words[i+3]
+				if strings.EqualFold(table, "exists") && i+4 < len(words) {
+					table = words[i+4]
+				}
+			}
+			break
+		}
+	}
+
+	if i := strings.IndexAny(table, "(,;"); i >= 0 {
+		table = table[:i]
+	}
+
+	return verb, strings.Trim(table, "`\"")
+}
+
+// NewSlowQueryHook logs the statements which take longer than the threshold
+func NewSlowQueryHook(threshold time.Duration) Hook {
+	return &slowQueryHook{threshold: threshold}
+}
+
+type slowQueryHook struct {
+	threshold time.Duration
+}
+
+func (p *slowQueryHook) BeforeQuery(ctx context.Context, e *QueryEvent) context.Context {
+	return ctx
+}
+
+func (p *slowQueryHook) AfterQuery(ctx context.Context, e *QueryEvent) {
+	if e.Duration < p.threshold {
+		return
+	}
+
+	klog.InfoS("slow query", "sql", e.Sql(), "duration", e.Duration, "rows", e.Rows, "err", e.Err)
+}
+
+// NewMetricsHook reports the query duration histogram and the query/error counters,
+// labelled by table and verb, it should be called once for each subsystem
+func NewMetricsHook(subsystem string) Hook {
+	tags := []string{"table", "verb"}
+	return &metricsHook{
+		duration: telemetry.NewHistogram(subsystem, "query_duration_seconds", tags,
+			"The duration of the sql statements", nil),
+		queries: telemetry.NewCounter(subsystem, "queries_total", tags,
+			"The number of the sql statements"),
+		errors: telemetry.NewCounter(subsystem, "query_errors_total", tags,
+			"The number of the failed sql statements"),
+	}
+}
+
+type metricsHook struct {
+	duration telemetry.Histogram
+	queries  telemetry.Counter
+	errors   telemetry.Counter
+}
+
+func (p *metricsHook) BeforeQuery(ctx context.Context, e *QueryEvent) context.Context {
+	return ctx
+}
+
+func (p *metricsHook) AfterQuery(ctx context.Context, e *QueryEvent) {
+	p.duration.Observe(e.Duration.Seconds(), e.Table, e.Verb)
+	p.queries.Inc(e.Table, e.Verb)
+	if e.Err != nil {
+		p.errors.Inc(e.Table, e.Verb)
+	}
+}
+
+// NewTraceHook adds a step for each statement to the trace of the context,
+// see trace.ContextWithTrace
+func NewTraceHook() Hook {
+	return &traceHook{}
+}
+
+type traceHook struct{}
+
+func (p *traceHook) BeforeQuery(ctx context.Context, e *QueryEvent) context.Context {
+	return ctx
+}
+
+func (p *traceHook) AfterQuery(ctx context.Context, e *QueryEvent) {
+	t := trace.FromContext(ctx)
+	if t == nil {
+		return
+	}
+
+	fields := []trace.Field{
+		{Key: "table", Value: e.Table},
+		{Key: "duration", Value: e.Duration},
+		{Key: "rows", Value: e.Rows},
+	}
+	if e.Err != nil {
+		fields = append(fields, trace.Field{Key: "err", Value: e.Err})
+	}
+
+	t.Step("sql "+e.Verb, fields...)
+}
@@ -0,0 +1,92 @@
+package orm
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseStatement(t *testing.T) {
+	cases := []struct {
+		query string
+		verb  string
+		table string
+	}{
+		{"SELECT * FROM `user` WHERE `id` = ?", "select", "user"},
+		{"select count(*) from user", "select", "user"},
+		{"INSERT INTO \"user\" (\"name\") VALUES ($1)", "insert", "user"},
+		{"UPDATE user SET `age` = ?", "update", "user"},
+		{"DELETE FROM `user` WHERE `id` = ?", "delete", "user"},
+		{"CREATE TABLE test (value int)", "create", "test"},
+		{"DROP TABLE IF EXISTS test", "drop", "test"},
+		{"CREATE TABLE IF NOT EXISTS `test`(`value` int)", "create", "test"},
+		{"BEGIN", "begin", ""},
+		{"", "", ""},
+	}
+
+	for i, c := range cases {
+		verb, table := parseStatement(c.query)
+		assert.Equal(t, c.verb, verb, fmt.Sprintf("case-%d", i))
+		assert.Equal(t, c.table, table, fmt.Sprintf("case-%d", i))
+	}
+}
+
+type recordHook struct {
+	events []QueryEvent
+}
+
+func (p *recordHook) BeforeQuery(ctx context.Context, e *QueryEvent) context.Context {
+	return ctx
+}
+
+func (p *recordHook) AfterQuery(ctx context.Context, e *QueryEvent) {
+	p.events = append(p.events, *e)
+}
+
+func TestHooks(t *testing.T) {
+	if !testAvailable {
+		t.Skipf("SQL server not running on %s:%s", testDriver, testDsn)
+	}
+
+	hook := &recordHook{}
+	db, err := Open(testDriver, testDsn, WithHooks(hook))
+	require.NoError(t, err)
+	defer db.Close()
+
+	ctx := context.Background()
+	db.Exec(ctx, "DROP TABLE IF EXISTS test")
+	defer db.Exec(ctx, "DROP TABLE IF EXISTS test")
+
+	_, err = db.Exec(ctx, "CREATE TABLE test (value int)")
+	require.NoError(t, err)
+	_, err = db.Exec(ctx, "INSERT INTO test VALUES (?), (?)", 1, 2)
+	require.NoError(t, err)
+
+	var n int
+	require.NoError(t, db.Query(ctx, "SELECT count(*) FROM test WHERE value IN (?)", []int{1, 2}).Row(&n))
+	assert.Equal(t, 2, n)
+
+	_, err = db.Exec(ctx, "INSERT INTO unknown VALUES (?)", 1)
+	assert.Error(t, err)
+
+	events := hook.events[1:]
+	require.Len(t, events, 4)
+
+	assert.Equal(t, "create", events[0].Verb)
+
+	assert.Equal(t, "insert", events[1].Verb)
+	assert.Equal(t, "test", events[1].Table)
+	assert.Equal(t, int64(2), events[1].Rows)
+	assert.Equal(t, "INSERT INTO test VALUES (1), (2)", events[1].Sql())
+
+	assert.Equal(t, "select", events[2].Verb)
+	assert.Equal(t, int64(-1), events[2].Rows)
+	assert.Equal(t, []interface{}{1, 2}, events[2].Args)
+	assert.False(t, events[2].Start.IsZero())
+
+	assert.Equal(t, "unknown", events[3].Table)
+	assert.Error(t, events[3].Err)
+}
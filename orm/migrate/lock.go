@@ -0,0 +1,127 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/yubo/golib/orm"
+	"github.com/yubo/golib/util/wait"
+	"k8s.io/klog/v2"
+)
+
+const lockID = 1
+
+var (
+	lockRetryInterval = time.Second
+	// the lock is released with a new context, the ctx of Migrate may be done
+	unlockTimeout = 10 * time.Second
+)
+
+// schemaMigrationLock holds at most one row, the process which inserted it owns the lock
+type schemaMigrationLock struct {
+	ID       int    `sql:"primary_key"`
+	Owner    string `sql:"size=255"`
+	LockedAt int64
+}
+
+func (p *Migrator) lockTable() string {
+	return p.table + "_lock"
+}
+
+func lockOwner() string {
+	hostname, _ := os.Hostname()
+	return fmt.Sprintf("%s-%d-%d", hostname, os.Getpid(), time.Now().UnixNano())
+}
+
+// withLock make sure only one process migrates at a time
+func (p *Migrator) withLock(ctx context.Context, fn func() error) error {
+	if err := p.prepare(ctx); err != nil {
+		return err
+	}
+
+	owner := lockOwner()
+	if err := wait.PollImmediateUntil(lockRetryInterval, func() (bool, error) {
+		return p.tryLock(ctx, owner), nil
+	}, ctx.Done()); err != nil {
+		return fmt.Errorf("acquire migration lock %s err: %s", p.lockTable(), err)
+	}
+
+	// refresh the lock while fn is running, so it is not taken over as a stale lock
+	stopCh := make(chan struct{})
+	doneCh := make(chan struct{})
+	go func() {
+		defer close(doneCh)
+
+		ticker := time.NewTicker(p.lockTimeout / 3)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stopCh:
+				return
+			case <-ticker.C:
+				p.refreshLock(ctx, owner)
+			}
+		}
+	}()
+
+	defer func() {
+		close(stopCh)
+		<-doneCh
+		p.unlock(owner)
+	}()
+
+	return fn()
+}
+
+func (p *Migrator) tryLock(ctx context.Context, owner string) bool {
+	now := time.Now()
+	err := p.db.Insert(ctx, &schemaMigrationLock{
+		ID:       lockID,
+		Owner:    owner,
+		LockedAt: now.Unix(),
+	}, orm.WithTable(p.lockTable()))
+	if err == nil {
+		return true
+	}
+
+	// take over the stale lock
+	quote := p.db.Dialect().Quote
+	n, err := p.db.ExecNum(ctx, "UPDATE "+quote(p.lockTable())+" SET "+quote("owner")+" = ?, "+quote("locked_at")+" = ? WHERE "+
+		quote("id")+" = ? AND "+quote("locked_at")+" < ?",
+		owner, now.Unix(), lockID, now.Add(-p.lockTimeout).Unix())
+	if err == nil && n > 0 {
+		klog.InfoS("migration lock is stale, take over it", "table", p.lockTable(), "owner", owner)
+		return true
+	}
+
+	klog.V(3).InfoS("waiting for the migration lock", "table", p.lockTable())
+	return false
+}
+
+func (p *Migrator) refreshLock(ctx context.Context, owner string) {
+	quote := p.db.Dialect().Quote
+	n, err := p.db.ExecNum(ctx, "UPDATE "+quote(p.lockTable())+" SET "+quote("locked_at")+" = ? WHERE "+
+		quote("id")+" = ? AND "+quote("owner")+" = ?",
+		time.Now().Unix(), lockID, owner)
+	if err != nil {
+		klog.ErrorS(err, "refresh migration lock", "table", p.lockTable())
+		return
+	}
+	if n == 0 {
+		klog.ErrorS(nil, "migration lock was taken over by the other process", "table", p.lockTable(), "owner", owner)
+	}
+}
+
+func (p *Migrator) unlock(owner string) {
+	ctx, cancel := context.WithTimeout(orm.WithPrimary(context.Background()), unlockTimeout)
+	defer cancel()
+
+	quote := p.db.Dialect().Quote
+	if _, err := p.db.Exec(ctx, "DELETE FROM "+quote(p.lockTable())+" WHERE "+quote("id")+" = ? AND "+quote("owner")+" = ?",
+		lockID, owner); err != nil {
+		klog.ErrorS(err, "release migration lock", "table", p.lockTable())
+	}
+}
@@ -0,0 +1,327 @@
+// Package migrate provides versioned schema migrations on top of orm.DB
+//
+//	m := migrate.New(db)
+//	m.Register(&migrate.Migration{Version: 1, Name: "create_user", Up: ..., Down: ...})
+//	m.Migrate(ctx, migrate.Latest)
+//	m.Rollback(ctx, 1)
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/yubo/golib/orm"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// Latest is used as the target of Migrate to apply all the pending migrations
+	Latest int64 = -1
+
+	DefaultTableName   = "schema_migrations"
+	DefaultLockTimeout = 5 * time.Minute
+)
+
+// Migration is a numbered step with up and down directions,
+// either the func or the sql is used, the func takes precedence.
+type Migration struct {
+	Version int64
+	Name    string
+
+	Up   func(ctx context.Context, db orm.Interface) error
+	Down func(ctx context.Context, db orm.Interface) error
+
+	UpSql   []byte
+	DownSql []byte
+}
+
+func (p *Migration) up(ctx context.Context, db orm.Interface) error {
+	if p.Up != nil {
+		return p.Up(ctx, db)
+	}
+	return execSql(ctx, db, p.UpSql)
+}
+
+func (p *Migration) down(ctx context.Context, db orm.Interface) error {
+	if p.Down != nil {
+		return p.Down(ctx, db)
+	}
+	if len(p.DownSql) == 0 {
+		return fmt.Errorf("migration %d %s has no down direction", p.Version, p.Name)
+	}
+	return execSql(ctx, db, p.DownSql)
+}
+
+func execSql(ctx context.Context, db orm.Interface, b []byte) error {
+	cmds := orm.SplitStatements(b)
+	if len(cmds) == 0 {
+		return fmt.Errorf("no sql statements")
+	}
+
+	for _, cmd := range cmds {
+		if _, err := db.Exec(ctx, cmd); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Status is the state of a migration
+type Status struct {
+	Version   int64
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+	// Missing is true if the migration was applied but is not registered
+	Missing bool
+}
+
+// schemaMigration is the record of the applied migration
+type schemaMigration struct {
+	Version   int64     `sql:"primary_key"`
+	Name      string    `sql:"size=255"`
+	AppliedAt time.Time `sql:"auto_createtime"`
+}
+
+type Option func(*Migrator)
+
+// WithTableName set the table which records the applied migrations
+func WithTableName(name string) Option {
+	return func(p *Migrator) {
+		p.table = name
+	}
+}
+
+// WithLockTimeout a lock older than the timeout is considered to be stale
+func WithLockTimeout(timeout time.Duration) Option {
+	return func(p *Migrator) {
+		p.lockTimeout = timeout
+	}
+}
+
+type Migrator struct {
+	db          orm.DB
+	table       string
+	lockTimeout time.Duration
+	migrations  []*Migration
+}
+
+func New(db orm.DB, opts ...Option) *Migrator {
+	p := &Migrator{
+		db:          db,
+		table:       DefaultTableName,
+		lockTimeout: DefaultLockTimeout,
+	}
+
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	return p
+}
+
+// Register add migrations, the version must be positive and unique
+func (p *Migrator) Register(migrations ...*Migration) error {
+	for _, m := range migrations {
+		if m.Version <= 0 {
+			return fmt.Errorf("invalid migration version %d", m.Version)
+		}
+		if m.Up == nil && len(m.UpSql) == 0 {
+			return fmt.Errorf("migration %d %s has no up direction", m.Version, m.Name)
+		}
+		for _, v := range p.migrations {
+			if v.Version == m.Version {
+				return fmt.Errorf("migration %d duplicate", m.Version)
+			}
+		}
+		p.migrations = append(p.migrations, m)
+	}
+
+	sort.Slice(p.migrations, func(i, j int) bool {
+		return p.migrations[i].Version < p.migrations[j].Version
+	})
+
+	return nil
+}
+
+// Migrate apply or revert the migrations until the schema is at the target version
+func (p *Migrator) Migrate(ctx context.Context, target int64) error {
+	// the replicas may lag behind, read the applied versions from the primary
+	ctx = orm.WithPrimary(ctx)
+
+	return p.withLock(ctx, func() error {
+		applied, err := p.applied(ctx)
+		if err != nil {
+			return err
+		}
+
+		// up
+		for _, m := range p.migrations {
+			if target != Latest && m.Version > target {
+				break
+			}
+			if _, ok := applied[m.Version]; ok {
+				continue
+			}
+			if err := p.apply(ctx, m, true); err != nil {
+				return err
+			}
+		}
+
+		if target == Latest {
+			return nil
+		}
+
+		// down
+		for i := len(p.migrations) - 1; i >= 0; i-- {
+			m := p.migrations[i]
+			if m.Version <= target {
+				break
+			}
+			if _, ok := applied[m.Version]; !ok {
+				continue
+			}
+			if err := p.apply(ctx, m, false); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// Rollback revert the last n applied migrations
+func (p *Migrator) Rollback(ctx context.Context, n int) error {
+	// the replicas may lag behind, read the applied versions from the primary
+	ctx = orm.WithPrimary(ctx)
+
+	return p.withLock(ctx, func() error {
+		applied, err := p.applied(ctx)
+		if err != nil {
+			return err
+		}
+
+		for i := len(p.migrations) - 1; i >= 0 && n > 0; i-- {
+			m := p.migrations[i]
+			if _, ok := applied[m.Version]; !ok {
+				continue
+			}
+			if err := p.apply(ctx, m, false); err != nil {
+				return err
+			}
+			n--
+		}
+
+		return nil
+	})
+}
+
+// Status return the state of all the registered and applied migrations, ordered by version
+func (p *Migrator) Status(ctx context.Context) ([]Status, error) {
+	// the replicas may lag behind, read the applied versions from the primary
+	ctx = orm.WithPrimary(ctx)
+
+	if err := p.prepare(ctx); err != nil {
+		return nil, err
+	}
+
+	applied, err := p.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []Status{}
+	for _, m := range p.migrations {
+		s := Status{Version: m.Version, Name: m.Name}
+		if v, ok := applied[m.Version]; ok {
+			s.Applied = true
+			s.AppliedAt = v.AppliedAt
+			delete(applied, m.Version)
+		}
+		ret = append(ret, s)
+	}
+
+	for _, v := range applied {
+		ret = append(ret, Status{
+			Version:   v.Version,
+			Name:      v.Name,
+			Applied:   true,
+			AppliedAt: v.AppliedAt,
+			Missing:   true,
+		})
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Version < ret[j].Version
+	})
+
+	return ret, nil
+}
+
+// Version return the latest applied version, 0 if nothing applied
+func (p *Migrator) Version(ctx context.Context) (version int64, err error) {
+	// the replicas may lag behind, read the applied versions from the primary
+	ctx = orm.WithPrimary(ctx)
+
+	if err := p.prepare(ctx); err != nil {
+		return 0, err
+	}
+
+	err = p.db.Query(ctx, "SELECT COALESCE(MAX(version), 0) FROM "+p.db.Dialect().Quote(p.table)).Row(&version)
+	return
+}
+
+func (p *Migrator) prepare(ctx context.Context) error {
+	if err := p.db.AutoMigrate(ctx, &schemaMigration{}, orm.WithTable(p.table)); err != nil {
+		return err
+	}
+
+	return p.db.AutoMigrate(ctx, &schemaMigrationLock{}, orm.WithTable(p.lockTable()))
+}
+
+func (p *Migrator) applied(ctx context.Context) (map[int64]schemaMigration, error) {
+	var list []schemaMigration
+	if err := p.db.List(ctx, &list, orm.WithTable(p.table)); err != nil {
+		return nil, err
+	}
+
+	ret := make(map[int64]schemaMigration, len(list))
+	for _, v := range list {
+		ret[v.Version] = v
+	}
+	return ret, nil
+}
+
+// apply run the migration and update the record in one transaction
+func (p *Migrator) apply(ctx context.Context, m *Migration, up bool) (err error) {
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	txCtx := orm.WithDB(ctx, tx)
+
+	if up {
+		klog.V(1).InfoS("migrate up", "version", m.Version, "name", m.Name)
+		if err = m.up(txCtx, tx); err != nil {
+			return fmt.Errorf("migrate up %d %s err: %s", m.Version, m.Name, err)
+		}
+		return tx.Insert(txCtx, &schemaMigration{Version: m.Version, Name: m.Name}, orm.WithTable(p.table))
+	}
+
+	klog.V(1).InfoS("migrate down", "version", m.Version, "name", m.Name)
+	if err = m.down(txCtx, tx); err != nil {
+		return fmt.Errorf("migrate down %d %s err: %s", m.Version, m.Name, err)
+	}
+	return tx.Delete(txCtx, &schemaMigration{}, orm.WithTable(p.table), orm.WithSelectorf("version=%d", m.Version))
+}
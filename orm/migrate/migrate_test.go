@@ -0,0 +1,213 @@
+package migrate
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yubo/golib/orm"
+
+	_ "github.com/yubo/golib/orm/sqlite"
+)
+
+func newTestDB(t *testing.T) orm.DB {
+	db, err := orm.Open("sqlite3", "file:migrate_test.db?cache=shared&mode=memory")
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func hasTable(db orm.DB, table string) bool {
+	return db.HasTable(context.Background(), table)
+}
+
+func TestMigrate(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+
+	fsys := fstest.MapFS{
+		"sql/0001_create_user.up.sql":   {Data: []byte("CREATE TABLE user (id integer, name text);\n")},
+		"sql/0001_create_user.down.sql": {Data: []byte("DROP TABLE user;\n")},
+		"sql/0002_add_age.up.sql":       {Data: []byte("ALTER TABLE user\n  ADD age integer;\n")},
+		"sql/0002_add_age.down.sql":     {Data: []byte("ALTER TABLE user DROP COLUMN age;\n")},
+		"sql/README.md":                 {Data: []byte("ignored")},
+	}
+	migrations, err := LoadFS(fsys, "sql")
+	require.NoError(t, err)
+	require.Len(t, migrations, 2)
+
+	m := New(db)
+	require.NoError(t, m.Register(migrations...))
+	require.NoError(t, m.Register(&Migration{
+		Version: 3,
+		Name:    "create_group",
+		Up: func(ctx context.Context, db orm.Interface) error {
+			_, err := db.Exec(ctx, "CREATE TABLE `group` (id integer)")
+			return err
+		},
+		Down: func(ctx context.Context, db orm.Interface) error {
+			_, err := db.Exec(ctx, "DROP TABLE `group`")
+			return err
+		},
+	}))
+	assert.Error(t, m.Register(&Migration{Version: 3, UpSql: []byte("SELECT 1;")}), "duplicate version")
+
+	// up to 2
+	require.NoError(t, m.Migrate(ctx, 2))
+	assert.True(t, hasTable(db, "user"))
+	assert.False(t, hasTable(db, "group"))
+	version, err := m.Version(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), version)
+
+	// latest
+	require.NoError(t, m.Migrate(ctx, Latest))
+	assert.True(t, hasTable(db, "group"))
+
+	status, err := m.Status(ctx)
+	require.NoError(t, err)
+	require.Len(t, status, 3)
+	for _, s := range status {
+		assert.True(t, s.Applied, "version %d", s.Version)
+		assert.False(t, s.Missing, "version %d", s.Version)
+	}
+
+	// rollback the last one
+	require.NoError(t, m.Rollback(ctx, 1))
+	assert.False(t, hasTable(db, "group"))
+	version, err = m.Version(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), version)
+
+	// down to 0
+	require.NoError(t, m.Migrate(ctx, 0))
+	assert.False(t, hasTable(db, "user"))
+
+	status, err = m.Status(ctx)
+	require.NoError(t, err)
+	for _, s := range status {
+		assert.False(t, s.Applied, "version %d", s.Version)
+	}
+}
+
+func TestMigrateFailed(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+
+	m := New(db, WithTableName("failed_migrations"))
+	require.NoError(t, m.Register(&Migration{
+		Version: 1,
+		Name:    "invalid",
+		UpSql:   []byte("CREATE TABLE invalid (;\n"),
+	}))
+
+	assert.Error(t, m.Migrate(ctx, Latest))
+
+	status, err := m.Status(ctx)
+	require.NoError(t, err)
+	require.Len(t, status, 1)
+	assert.False(t, status[0].Applied)
+
+	// the lock should be released
+	var n int
+	require.NoError(t, db.Query(ctx, "SELECT COUNT(*) FROM failed_migrations_lock").Row(&n))
+	assert.Equal(t, 0, n)
+}
+
+func TestMigrateEmpty(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+
+	m := New(db, WithTableName("empty_migrations"))
+	require.NoError(t, m.Register(&Migration{
+		Version: 1,
+		Name:    "empty",
+		UpSql:   []byte("-- nothing to do\n"),
+	}))
+
+	assert.ErrorContains(t, m.Migrate(ctx, Latest), "no sql statements")
+
+	status, err := m.Status(ctx)
+	require.NoError(t, err)
+	require.Len(t, status, 1)
+	assert.False(t, status[0].Applied)
+}
+
+func TestMigrateLockRefresh(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+
+	m := New(db, WithTableName("long_migrations"), WithLockTimeout(300*time.Millisecond))
+	other := New(db, WithTableName("long_migrations"), WithLockTimeout(300*time.Millisecond))
+
+	var locked bool
+	require.NoError(t, m.Register(&Migration{
+		Version: 1,
+		Name:    "long",
+		Up: func(ctx context.Context, _ orm.Interface) error {
+			// longer than the lock timeout
+			time.Sleep(1500 * time.Millisecond)
+			locked = other.tryLock(ctx, "other")
+			return nil
+		},
+	}))
+
+	require.NoError(t, m.Migrate(ctx, Latest))
+	assert.False(t, locked, "the lock should not be taken over while migrating")
+}
+
+func TestMigrateReplica(t *testing.T) {
+	ctx := context.Background()
+
+	// the replica is a different database which lags behind
+	replica := "file:migrate_replica.db?cache=shared&mode=memory"
+	rdb, err := orm.Open("sqlite3", replica)
+	require.NoError(t, err)
+	defer rdb.Close()
+	_, err = New(rdb).Version(ctx)
+	require.NoError(t, err)
+
+	db, err := orm.Open("sqlite3", "file:migrate_primary.db?cache=shared&mode=memory", orm.WithReplicas(replica))
+	require.NoError(t, err)
+	defer db.Close()
+
+	m := New(db)
+	require.NoError(t, m.Register(&Migration{Version: 1, Name: "create_user", UpSql: []byte("CREATE TABLE user (id integer);")}))
+
+	// the applied versions are read from the primary
+	require.NoError(t, m.Migrate(ctx, Latest))
+	require.NoError(t, m.Migrate(ctx, Latest))
+
+	version, err := m.Version(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), version)
+
+	status, err := m.Status(ctx)
+	require.NoError(t, err)
+	require.Len(t, status, 1)
+	assert.True(t, status[0].Applied)
+}
+
+func TestMigrateUnlockCanceled(t *testing.T) {
+	db := newTestDB(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	m := New(db, WithTableName("canceled_migrations"))
+	require.NoError(t, m.Register(&Migration{
+		Version: 1,
+		Name:    "canceled",
+		Up: func(context.Context, orm.Interface) error {
+			cancel()
+			return nil
+		},
+	}))
+
+	assert.Error(t, m.Migrate(ctx, Latest))
+
+	// the lock is released even if the ctx is canceled
+	assert.True(t, New(db, WithTableName("canceled_migrations")).tryLock(context.Background(), "other"))
+}
@@ -0,0 +1,74 @@
+package migrate
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// e.g. 0001_create_user.up.sql, 0001_create_user.down.sql
+var sqlFileReg = regexp.MustCompile(`^(\d+)_(.*)\.(up|down)\.sql$`)
+
+// LoadDir load the sql migrations from the directory, see LoadFS
+func LoadDir(dir string) ([]*Migration, error) {
+	return LoadFS(os.DirFS(dir), ".")
+}
+
+// LoadFS load the sql migrations from the dir of fsys,
+// the file name should be <version>_<name>.up.sql or <version>_<name>.down.sql
+func LoadFS(fsys fs.FS, dir string) ([]*Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := map[int64]*Migration{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		match := sqlFileReg.FindStringSubmatch(entry.Name())
+		if match == nil {
+			continue
+		}
+
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration file %s: %s", entry.Name(), err)
+		}
+
+		m, ok := migrations[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			migrations[version] = m
+		} else if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has different names %s and %s", version, m.Name, match[2])
+		}
+
+		b, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		if match[3] == "up" {
+			m.UpSql = b
+		} else {
+			m.DownSql = b
+		}
+	}
+
+	ret := make([]*Migration, 0, len(migrations))
+	for _, m := range migrations {
+		ret = append(ret, m)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Version < ret[j].Version
+	})
+
+	return ret, nil
+}
@@ -3,13 +3,16 @@ package orm
 import (
 	"bytes"
 	"context"
+	"database/sql"
 	"fmt"
 	"reflect"
 	"strings"
 	"time"
 
+	"github.com/yubo/golib/api"
 	"github.com/yubo/golib/api/errors"
 	"github.com/yubo/golib/util"
+	"github.com/yubo/golib/util/wait"
 )
 
 type DBOptions struct {
@@ -25,18 +28,43 @@ type DBOptions struct {
 	connMaxLifetime *time.Duration
 	connMaxIdletime *time.Duration
 	stringSize      int
+	hooks           []Hook
+	keyring         Keyring
 	err             error
+
+	feed             *changeFeed
+	watchAfterCommit bool
+
+	replicas             []string
+	replicaPolicy        ReplicaPolicy
+	replicaCheckInterval time.Duration
+
+	cache       *queryCache
+	cacheSize   int
+	cacheTables map[string]time.Duration
 }
 
 func NewDefaultDBOptions() *DBOptions {
 	return &DBOptions{
-		maxRows:    1000,
-		stringSize: 255,
+		maxRows:              1000,
+		stringSize:           255,
+		replicaPolicy:        ReplicaRoundRobin,
+		replicaCheckInterval: 10 * time.Second,
+		feed:                 newChangeFeed(),
+		cacheSize:            1024,
 	}
 }
 
 type DBOption func(*DBOptions)
 
+// getKeyring returns the keyring of the encrypt fields, it's safe on the nil DBOptions
+func (p *DBOptions) getKeyring() Keyring {
+	if p == nil {
+		return nil
+	}
+	return p.keyring
+}
+
 func (p *DBOptions) Validate() error {
 	return p.err
 }
@@ -101,6 +129,118 @@ func WithConnMaxIdletime(d time.Duration) DBOption {
 	}
 }
 
+// WithReplicas set the dsn of the read replicas,
+// Query, Get and List are sent to a healthy replica, the others are sent to the primary
+func WithReplicas(dsn ...string) DBOption {
+	return func(o *DBOptions) {
+		o.replicas = append(o.replicas, dsn...)
+	}
+}
+
+// WithReplicaPolicy set how to choose the replica, default is ReplicaRoundRobin
+func WithReplicaPolicy(policy ReplicaPolicy) DBOption {
+	return func(o *DBOptions) {
+		o.replicaPolicy = policy
+	}
+}
+
+// WithReplicaCheckInterval set the interval of the replica health check, default is 10s
+func WithReplicaCheckInterval(d time.Duration) DBOption {
+	return func(o *DBOptions) {
+		o.replicaCheckInterval = d
+	}
+}
+
+// WithKeyring set the keyring of the `sql:"encrypt"` fields
+func WithKeyring(keyring Keyring) DBOption {
+	return func(o *DBOptions) {
+		o.keyring = keyring
+	}
+}
+
+// WithWatchAfterCommit delays the events of the writes in a Tx until the Tx is committed,
+// the events are dropped if the Tx is rolled back, see DB.Watch
+func WithWatchAfterCommit() DBOption {
+	return func(o *DBOptions) {
+		o.watchAfterCommit = true
+	}
+}
+
+// WithCacheSize set the max entries of the query cache, default is 1024, 0 disables it, see WithCache
+func WithCacheSize(n int) DBOption {
+	return func(o *DBOptions) {
+		o.cacheSize = n
+	}
+}
+
+// WithTableCache set the default ttl of the query cache of Get/List on the table,
+// it can be overridden by WithCache
+func WithTableCache(table string, ttl time.Duration) DBOption {
+	return func(o *DBOptions) {
+		if o.cacheTables == nil {
+			o.cacheTables = map[string]time.Duration{}
+		}
+		o.cacheTables[table] = ttl
+	}
+}
+
+// WithHooks append the hooks which observe the statements,
+// e.g. NewSlowQueryHook, NewMetricsHook, NewTraceHook
+func WithHooks(hooks ...Hook) DBOption {
+	return func(o *DBOptions) {
+		o.hooks = append(o.hooks, hooks...)
+	}
+}
+
+type txOptions struct {
+	sqlOptions *sql.TxOptions
+	backoff    wait.Backoff
+	retryable  func(error) bool
+}
+
+type TxOption func(*txOptions)
+
+func newTxOptions(opts ...TxOption) *txOptions {
+	o := &txOptions{
+		backoff: wait.Backoff{
+			Duration: api.Duration{Duration: 10 * time.Millisecond},
+			Factor:   2,
+			Jitter:   0.1,
+			Steps:    3,
+		},
+		retryable: IsRetryableTxError,
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(o)
+		}
+	}
+	return o
+}
+
+// WithTxOptions set the isolation level and read-only of the transaction
+func WithTxOptions(opts *sql.TxOptions) TxOption {
+	return func(o *txOptions) {
+		o.sqlOptions = opts
+	}
+}
+
+// WithTxRetry set the retry policy of the transaction,
+// backoff.Steps is the max attempts, default is 3, 1 means no retry
+func WithTxRetry(backoff wait.Backoff) TxOption {
+	return func(o *txOptions) {
+		o.backoff = backoff
+	}
+}
+
+// WithTxRetryable set the func which reports whether the error should be retried,
+// default is IsRetryableTxError
+func WithTxRetryable(retryable func(error) bool) TxOption {
+	return func(o *txOptions) {
+		o.retryable = retryable
+	}
+}
+
 func NewOptions(opts ...QueryOption) (*queryOptions, error) {
 	o := &queryOptions{}
 	for _, opt := range opts {
@@ -135,11 +275,24 @@ type queryOptions struct {
 	orderby        []string
 	offset         int
 	limit          int
+	cursor         string
+	next           *string // output the continue token
+	unscoped       bool
+	preload        []string
 	ignoreNotFound bool
 	sqlout         *string // dump sql into
+	plan           *migratePlan
+
+	upsert          bool
+	upsertCols      []string
+	conflictKeys    []string
+	maxPlaceholders int
+
+	cacheTTL *time.Duration
 
 	err       error
 	_selector Selector
+	_cursor   *listCursor
 }
 
 func (o *queryOptions) Error(err error) error {
@@ -154,6 +307,91 @@ func (o *queryOptions) Sample() interface{} {
 	return o.sample
 }
 
+// Selector returns the selector of WithSelector, nil if it's not set
+func (o *queryOptions) Selector() Selector {
+	return o._selector
+}
+
+func (o *queryOptions) Cols() []string {
+	return o.cols
+}
+
+func (o *queryOptions) Orderby() []string {
+	return o.orderby
+}
+
+// Limit returns the offset and limit of WithLimit
+func (o *queryOptions) Limit() (offset, limit int) {
+	return o.offset, o.limit
+}
+
+// SetTotal set the total of WithTotal
+func (o *queryOptions) SetTotal(total int) {
+	if o.total != nil {
+		*o.total = total
+	}
+}
+
+// Unscoped returns true if WithUnscoped is set
+func (o *queryOptions) Unscoped() bool {
+	return o.unscoped
+}
+
+// Upsert returns true if WithUpsert is set
+func (o *queryOptions) Upsert() bool {
+	return o.upsert
+}
+
+// UpsertCols returns the conflict keys and the cols updated by WithUpsert,
+// the insertCols are the columns of the inserted row
+func (o *queryOptions) UpsertCols(db Driver, insertCols []string) (keys, cols []string) {
+	rt := reflect.TypeOf(o.sample)
+	for rt.Kind() == reflect.Ptr || rt.Kind() == reflect.Slice || rt.Kind() == reflect.Array {
+		rt = rt.Elem()
+	}
+	fields := cachedTypeFields(rt, db)
+
+	keys = o.conflictKeys
+	if len(keys) == 0 {
+		keys = conflictKeysOf(fields)
+	}
+
+	if len(o.upsertCols) > 0 {
+		return keys, o.upsertCols
+	}
+
+	isKey := map[string]bool{}
+	for _, k := range keys {
+		isKey[k] = true
+	}
+	for _, col := range insertCols {
+		if isKey[col] {
+			continue
+		}
+		if n, ok := fields.nameIndex[col]; ok && fields.Fields[n].AutoCreatetime > 0 {
+			continue
+		}
+		cols = append(cols, col)
+	}
+
+	return keys, cols
+}
+
+// Cursor returns true if WithCursor or WithContinue is set
+func (o *queryOptions) Cursor() bool {
+	return o.cursor != "" || o.next != nil
+}
+
+// Preload returns the relations of WithPreload
+func (o *queryOptions) Preload() []string {
+	return o.preload
+}
+
+// Cache returns true if WithCache is set
+func (o *queryOptions) Cache() bool {
+	return o.cacheTTL != nil
+}
+
 type QueryOption func(*queryOptions)
 
 func WithTable(table string) QueryOption {
@@ -189,14 +427,23 @@ func WithSqlOutput(output *string) QueryOption {
 
 // WithSelector: use selector generate sql
 // examples:
-//   "user_name != tom, id < 10" --> "`user_name` != ? and `id` < ?"
-//   "user_name in (tom, jerry)" --> "user_name in (?, ?)"
-//   "user_name notin (tom, jerry)" --> "user_name not in (?, ?)"
-//   "name ~= a" --> "`name` like '%?'"
-//   "name ~ a" --> "`name` like '%?%'"
-//   "name =~ a" --> "`name` like '?%'"
+//
+//	"user_name != tom, id < 10" --> "`user_name` != ? and `id` < ?"
+//	"user_name in (tom, jerry)" --> "user_name in (?, ?)"
+//	"user_name notin (tom, jerry)" --> "user_name not in (?, ?)"
+//	"name ~= a" --> "`name` like '%?'"
+//	"name ~ a" --> "`name` like '%?%'"
+//	"name =~ a" --> "`name` like '?%'"
+//	"age between (10, 20)" --> "`age` between ? and ?"
+//	"(status in (a, b) or owner = me), created >= 2023-01-01" --> "(`status` in (?, ?) or `owner` = ?) and `created` >= ?"
+//
 // operator:
-//   =, ==, in, !=, notin, >, <, ~=, =~, ~
+//
+//	=, ==, in, !=, notin, >, <, >=, <=, between, ~=, =~, ~
+//
+// group:
+//
+//	(<selector> or <selector> ...), ',' binds tighter than 'or'
 func WithSelector(selector ...string) QueryOption {
 	return func(o *queryOptions) {
 		for _, v := range selector {
@@ -236,6 +483,49 @@ func WithLimit(offset, limit int) QueryOption {
 	}
 }
 
+// WithCursor list the rows after the continue token of the previous page,
+// the offset of WithLimit is ignored, the WithOrderby cols should be
+// not null and unique together, e.g. "name desc", "id"
+func WithCursor(token string) QueryOption {
+	return func(o *queryOptions) {
+		o.cursor = token
+	}
+}
+
+// WithContinue output the continue token of the next page,
+// it will be empty if there are no more rows
+func WithContinue(next *string) QueryOption {
+	return func(o *queryOptions) {
+		o.next = next
+	}
+}
+
+// WithUnscoped include the soft deleted rows for Get/List/Update,
+// and Delete will remove the rows permanently
+func WithUnscoped() QueryOption {
+	return func(o *queryOptions) {
+		o.unscoped = true
+	}
+}
+
+// WithCache cache the result of Get/List for ttl, keyed by the sql and the args,
+// the entries of the table are invalidated by Insert/Update/Delete,
+// ttl <= 0 disables the cache of the query, e.g. to skip the default of WithTableCache
+func WithCache(ttl time.Duration) QueryOption {
+	return func(o *queryOptions) {
+		o.cacheTTL = &ttl
+	}
+}
+
+// WithPreload load the relations after Get/List, one query per relation,
+// the relation is the field name with the has_one/has_many/belongs_to tag,
+// the nested relation is separated by '.', e.g. "Orders", "Orders.Items"
+func WithPreload(relations ...string) QueryOption {
+	return func(o *queryOptions) {
+		o.preload = append(o.preload, relations...)
+	}
+}
+
 func WithCols(cols ...string) QueryOption {
 	return func(o *queryOptions) {
 		o.cols = cols
@@ -248,6 +538,35 @@ func WithOrderby(orderby ...string) QueryOption {
 	}
 }
 
+// WithUpsert update the cols if the row exists when insert,
+// all of the inserted columns except the conflict keys and auto_createtime will be updated if cols is empty.
+//
+//	mysql: ON DUPLICATE KEY UPDATE ...
+//	sqlite, postgres: ON CONFLICT (...) DO UPDATE SET ...
+func WithUpsert(cols ...string) QueryOption {
+	return func(o *queryOptions) {
+		o.upsert = true
+		o.upsertCols = cols
+	}
+}
+
+// WithConflictKeys set the conflict target of upsert,
+// default is the primary_key fields, or the first unique field
+func WithConflictKeys(keys ...string) QueryOption {
+	return func(o *queryOptions) {
+		o.conflictKeys = keys
+	}
+}
+
+// WithMaxPlaceholders limit the bind vars of one insert statement of InsertBatch,
+// and the keys of one `IN (...)` query of WithPreload,
+// default is the dialect's MaxPlaceholders()
+func WithMaxPlaceholders(n int) QueryOption {
+	return func(o *queryOptions) {
+		o.maxPlaceholders = n
+	}
+}
+
 func WithSample(sample interface{}) QueryOption {
 	return func(o *queryOptions) {
 		o.sample = sample
@@ -280,23 +599,82 @@ func (p *queryOptions) Table() string {
 	return p.table
 }
 
-func (p *queryOptions) GenListSql() (query, countQuery string, args []interface{}, err error) {
-	return GenListSql(p.Table(), p.cols, p._selector, p.orderby, p.offset, p.limit)
+func (p *queryOptions) GenListSql(db Driver) (query, countQuery string, args, countArgs []interface{}, err error) {
+	if p.cursor == "" && p.next == nil {
+		return genListSql(dialectOf(db), p.Table(), p.cols, p.scope(db), p.orderby, p.offset, p.limit, nil)
+	}
+
+	if p._cursor, err = newListCursor(p.orderby, p.sample, p.cursor, db); err != nil {
+		return
+	}
+
+	// fetch one more row to find out if there is a next page
+	limit := p.limit
+	if p.next != nil && limit > 0 {
+		limit++
+	}
+
+	return genListSql(dialectOf(db), p.Table(), p.cols, p.scope(db), p.orderby, p.offset, limit, p._cursor)
 }
 
-func (p *queryOptions) GenGetSql() (string, []interface{}, error) {
-	return GenGetSql(p.Table(), p.cols, p._selector)
+func (p *queryOptions) GenGetSql(db Driver) (string, []interface{}, error) {
+	if p._selector == nil {
+		return genGetSql(dialectOf(db), p.Table(), p.cols, nil)
+	}
+	return genGetSql(dialectOf(db), p.Table(), p.cols, p.scope(db))
 }
 
 func (p *queryOptions) GenUpdateSql(db Driver) (string, []interface{}, error) {
-	return GenUpdateSql(p.Table(), p.sample, db, p._selector)
+	return genUpdateSql(p.Table(), p.sample, db, p._selector, p.unscoped)
 }
 
 // TODO: generate selector from sample.fields, like GenUpdateSql
-func (p *queryOptions) GenDeleteSql() (string, []interface{}, error) {
-	return GenDeleteSql(p.Table(), p._selector)
+func (p *queryOptions) GenDeleteSql(db Driver) (string, []interface{}, error) {
+	if f := softDeleteField(p.sample, db); f != nil && !p.unscoped {
+		return genSoftDeleteSql(dialectOf(db), p.Table(), f, p._selector)
+	}
+	return genDeleteSql(dialectOf(db), p.Table(), p._selector)
 }
 
 func (p *queryOptions) GenInsertSql(db Driver) (string, []interface{}, error) {
-	return GenInsertSql(p.Table(), p.sample, db)
+	query, args, cols, err := genInsertSql(p.Table(), p.sample, db)
+	if err != nil || !p.upsert {
+		return query, args, err
+	}
+
+	clause, err := p.genUpsertClause(db, cols)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return query + clause, args, nil
+}
+
+// GenInsertBatchSql generate the multi-row insert statements for the sample slice,
+// the rows are grouped by the non-nil fields and chunked by the max placeholders
+func (p *queryOptions) GenInsertBatchSql(db Driver) ([]string, [][]interface{}, error) {
+	max := p.maxPlaceholders
+	if max <= 0 {
+		max = dialectOf(db).MaxPlaceholders()
+	}
+
+	queries, args, cols, err := genInsertBatchSql(dialectOf(db), p.Table(), p.sample, db, max)
+	if err != nil || !p.upsert {
+		return queries, args, err
+	}
+
+	for i := range queries {
+		clause, err := p.genUpsertClause(db, cols[i])
+		if err != nil {
+			return nil, nil, err
+		}
+		queries[i] += clause
+	}
+
+	return queries, args, nil
+}
+
+func (p *queryOptions) genUpsertClause(db Driver, insertCols []string) (string, error) {
+	keys, cols := p.UpsertCols(db, insertCols)
+	return dialectOf(db).Upsert(keys, cols)
 }
@@ -0,0 +1,105 @@
+package orm
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+type SchemaChangeType string
+
+const (
+	ChangeCreateTable   SchemaChangeType = "create_table"
+	ChangeAddColumn     SchemaChangeType = "add_column"
+	ChangeAlterType     SchemaChangeType = "alter_type"
+	ChangeAlterNullable SchemaChangeType = "alter_nullable"
+	ChangeAddIndex      SchemaChangeType = "add_index"
+	ChangeRecreateTable SchemaChangeType = "recreate_table"
+)
+
+// SchemaChange is a pending change reported by Driver.PlanMigrate
+type SchemaChange struct {
+	Type    SchemaChangeType
+	Table   string
+	Column  string
+	Message string
+	// Sql the exact statements which AutoMigrate would execute
+	Sql []string
+}
+
+func (p SchemaChange) String() string {
+	name := p.Table
+	if p.Column != "" {
+		name += "." + p.Column
+	}
+
+	s := fmt.Sprintf("%s %s", p.Type, name)
+	if p.Message != "" {
+		s += ": " + p.Message
+	}
+	for _, v := range p.Sql {
+		s += "\n  " + v
+	}
+	return s
+}
+
+type SchemaChanges []SchemaChange
+
+func (p SchemaChanges) String() string {
+	s := make([]string, len(p))
+	for i, v := range p {
+		s[i] = v.String()
+	}
+	return strings.Join(s, "\n")
+}
+
+// migratePlan collects the changes instead of executing them
+type migratePlan struct {
+	changes SchemaChanges
+}
+
+func withPlan() QueryOption {
+	return func(o *queryOptions) {
+		o.plan = &migratePlan{}
+	}
+}
+
+// add starts a new change, the following statements will be attached to it
+func (p *migratePlan) add(typ SchemaChangeType, table, column, format string, args ...interface{}) {
+	if p == nil {
+		return
+	}
+	p.changes = append(p.changes, SchemaChange{
+		Type:    typ,
+		Table:   table,
+		Column:  column,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+func (p *migratePlan) addSql(query string, args ...interface{}) error {
+	if len(args) > 0 {
+		var err error
+		if query, err = interpolateParams(query, args); err != nil {
+			return err
+		}
+	}
+
+	if len(p.changes) == 0 {
+		return fmt.Errorf("unexpected statement %s without schema change", query)
+	}
+
+	change := &p.changes[len(p.changes)-1]
+	change.Sql = append(change.Sql, query)
+	return nil
+}
+
+// execDDL executes the ddl statement, or records it if the options is in plan mode
+func execDDL(ctx context.Context, db Execer, o *queryOptions, query string, args ...interface{}) error {
+	if o != nil && o.plan != nil {
+		return o.plan.addSql(query, args...)
+	}
+
+	_, err := db.Exec(ctx, query, args...)
+	return err
+}
@@ -0,0 +1,89 @@
+package orm
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlanMigrate(t *testing.T) {
+	runTests(t, func(db DB, ctx context.Context) {
+		type test struct {
+			ID   *int   `sql:"primary_key,auto_increment=1000"`
+			Name string `sql:"index"`
+		}
+
+		changes, err := db.PlanMigrate(ctx, &test{})
+		require.NoError(t, err)
+		require.Len(t, changes, 1)
+		assert.Equal(t, ChangeCreateTable, changes[0].Type)
+		assert.NotEmpty(t, changes[0].Sql)
+		assert.False(t, db.HasTable(ctx, "test"), "plan should not create the table")
+
+		require.NoError(t, db.AutoMigrate(ctx, &test{}))
+
+		changes, err = db.PlanMigrate(ctx, &test{})
+		require.NoError(t, err)
+		assert.Empty(t, changes, changes.String())
+	}, func(db DB, ctx context.Context) {
+		{
+			type test struct {
+				ID   *int `sql:"primary_key,auto_increment=1000"`
+				Name string
+			}
+			require.NoError(t, db.AutoMigrate(ctx, &test{}))
+		}
+
+		type test struct {
+			ID          *int `sql:"primary_key,auto_increment=1000"`
+			Name        string
+			DisplayName string `sql:"index"`
+		}
+
+		changes, err := db.PlanMigrate(ctx, &test{})
+		require.NoError(t, err)
+		require.Len(t, changes, 2, changes.String())
+		assert.Equal(t, ChangeAddColumn, changes[0].Type)
+		assert.Equal(t, "display_name", changes[0].Column)
+		assert.Len(t, changes[0].Sql, 1)
+		assert.Equal(t, ChangeAddIndex, changes[1].Type)
+		assert.Len(t, changes[1].Sql, 1)
+
+		assert.False(t, db.HasColumn(ctx, "display_name", &queryOptions{table: "test"}), "plan should not add the column")
+	})
+}
+
+func TestSqlitePlanRecreateTable(t *testing.T) {
+	if testDriver != "sqlite3" {
+		t.Skip("sqlite only")
+	}
+
+	runTests(t, func(db DB, ctx context.Context) {
+		{
+			type test struct {
+				Name string
+				Age  int
+			}
+			require.NoError(t, db.AutoMigrate(ctx, &test{}))
+		}
+
+		type test struct {
+			Name string `sql:"not_null"`
+			Age  int
+		}
+
+		changes, err := db.PlanMigrate(ctx, &test{})
+		require.NoError(t, err)
+		require.Len(t, changes, 2, changes.String())
+		assert.Equal(t, ChangeAlterNullable, changes[0].Type)
+		assert.Equal(t, ChangeRecreateTable, changes[1].Type)
+		assert.Equal(t, []string{
+			"CREATE TABLE `test__temp` (`name` text NOT NULL,`age` integer)",
+			"INSERT INTO `test__temp`(`name`,`age`) SELECT `name`,`age` FROM `test`",
+			"DROP TABLE `test`",
+			"ALTER TABLE `test__temp` RENAME TO `test`",
+		}, changes[1].Sql)
+	})
+}
@@ -0,0 +1,10 @@
+package postgres
+
+import (
+	_ "github.com/lib/pq"
+	"github.com/yubo/golib/orm"
+)
+
+func init() {
+	orm.RegisterPostgres()
+}
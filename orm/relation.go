@@ -0,0 +1,236 @@
+package orm
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/yubo/golib/util"
+)
+
+// preload loads the relations of the WithPreload for the rows of List/Get,
+// one `IN (...)` query per relation and per MaxPlaceholders keys, e.g. "Orders", "Orders.Items"
+func (p *baseInterface) preload(ctx context.Context, o *queryOptions, into interface{}) error {
+	if len(o.preload) == 0 {
+		return nil
+	}
+
+	rt, ok := structTypeOf(into)
+	if !ok {
+		return fmt.Errorf("preload: unsupported type %T", into)
+	}
+
+	rows := structValuesOf(reflect.ValueOf(into))
+	for _, path := range o.preload {
+		if err := p.preloadRelation(ctx, o, rt, rows, strings.Split(path, ".")); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (p *baseInterface) preloadRelation(ctx context.Context, o *queryOptions, rt reflect.Type, rows []reflect.Value, path []string) error {
+	if len(rows) == 0 {
+		return nil
+	}
+
+	fields := cachedTypeFields(rt, p.Driver)
+
+	var rel *StructField
+	for _, f := range fields.Relations {
+		if f.FieldName == path[0] {
+			rel = f
+			break
+		}
+	}
+	if rel == nil {
+		return fmt.Errorf("preload: relation %s not found in %s", path[0], rt)
+	}
+
+	target, ok := structTypeOf(reflect.New(rel.Type).Interface())
+	if !ok {
+		return fmt.Errorf("preload: unsupported relation type %s of %s.%s", rel.Type, rt, rel.FieldName)
+	}
+	targetFields := cachedTypeFields(target, p.Driver)
+
+	// has_one/has_many: owner.references = target.foreign_key
+	// belongs_to: owner.foreign_key = target.references
+	var ownerKey, targetKey *StructField
+	var err error
+	switch rel.Relation {
+	case HasOne, HasMany:
+		if ownerKey, err = referencesField(fields, rel.References); err != nil {
+			return fmt.Errorf("preload %s.%s: %s", rt, rel.FieldName, err)
+		}
+		targetKey = fieldOf(targetFields, rel.ForeignKey)
+	case BelongsTo:
+		ownerKey = fieldOf(fields, rel.ForeignKey)
+		if targetKey, err = referencesField(targetFields, rel.References); err != nil {
+			return fmt.Errorf("preload %s.%s: %s", rt, rel.FieldName, err)
+		}
+	}
+	if ownerKey == nil || targetKey == nil {
+		return fmt.Errorf("preload %s.%s: foreign key %s not found", rt, rel.FieldName, rel.ForeignKey)
+	}
+
+	// collect the keys of the owners
+	keys := make([]string, len(rows))
+	args := []interface{}{}
+	uniq := map[string]bool{}
+	for i, row := range rows {
+		fv, err := getSubv(row, ownerKey.Index, false)
+		if err != nil || IsNil(fv) {
+			continue
+		}
+		fv = reflect.Indirect(fv)
+		keys[i] = relationKey(fv)
+		if !uniq[keys[i]] {
+			uniq[keys[i]] = true
+			args = append(args, fv.Interface())
+		}
+	}
+	if len(args) == 0 {
+		return nil
+	}
+
+	d := dialectOf(p.Driver)
+	query := fmt.Sprintf("SELECT * FROM %s WHERE %s IN (?)", d.Quote(tableOf(target)), d.Quote(targetKey.Name))
+	if f := softDeleteField(reflect.New(target).Interface(), p.Driver); f != nil && !o.unscoped {
+		query += " AND " + notDeletedSql(d, f)
+	}
+
+	// the keys are chunked by the max placeholders of the dialect
+	max := o.maxPlaceholders
+	if max <= 0 {
+		max = d.MaxPlaceholders()
+	}
+
+	targets := reflect.New(reflect.SliceOf(target))
+	for start := 0; start < len(args); start += max {
+		end := start + max
+		if end > len(args) {
+			end = len(args)
+		}
+
+		chunk := reflect.New(reflect.SliceOf(target))
+		if err := p.query(ctx, query, args[start:end]).Rows(chunk.Interface()); err != nil {
+			return err
+		}
+		targets.Elem().Set(reflect.AppendSlice(targets.Elem(), chunk.Elem()))
+	}
+
+	targetRows := structValuesOf(targets)
+	if len(path) > 1 {
+		if err := p.preloadRelation(ctx, o, target, targetRows, path[1:]); err != nil {
+			return err
+		}
+	}
+
+	// stitch the targets into the owners
+	group := map[string][]reflect.Value{}
+	for _, row := range targetRows {
+		fv, err := getSubv(row, targetKey.Index, false)
+		if err != nil || IsNil(fv) {
+			continue
+		}
+		k := relationKey(reflect.Indirect(fv))
+		group[k] = append(group[k], row)
+	}
+
+	for i, row := range rows {
+		matches := group[keys[i]]
+		if keys[i] == "" || len(matches) == 0 {
+			continue
+		}
+
+		fv, err := getSubv(row, rel.Index, true)
+		if err != nil {
+			return err
+		}
+
+		if rel.Relation == HasMany {
+			list := reflect.MakeSlice(rel.Type, 0, len(matches))
+			for _, m := range matches {
+				list = reflect.Append(list, relationValue(m, rel.Type.Elem()))
+			}
+			fv.Set(list)
+			continue
+		}
+
+		fv.Set(relationValue(matches[0], rel.Type))
+	}
+
+	return nil
+}
+
+// structValuesOf returns the addressable struct values of *T, *[]T or *[]*T
+func structValuesOf(rv reflect.Value) []reflect.Value {
+	rv = reflect.Indirect(rv)
+
+	if rv.Kind() == reflect.Struct {
+		return []reflect.Value{rv}
+	}
+
+	if rv.Kind() != reflect.Slice {
+		return nil
+	}
+
+	ret := make([]reflect.Value, 0, rv.Len())
+	for i := 0; i < rv.Len(); i++ {
+		v := rv.Index(i)
+		if v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				continue
+			}
+			v = v.Elem()
+		}
+		ret = append(ret, v)
+	}
+	return ret
+}
+
+// relationValue converts the struct value to T or *T
+func relationValue(rv reflect.Value, rt reflect.Type) reflect.Value {
+	if rt.Kind() == reflect.Ptr {
+		return rv.Addr()
+	}
+	return rv
+}
+
+// relationKey is used to match the keys of the different types, e.g. int64 and int
+func relationKey(rv reflect.Value) string {
+	return fmt.Sprint(rv.Interface())
+}
+
+func fieldOf(fields StructFields, name string) *StructField {
+	if i, ok := fields.nameIndex[name]; ok {
+		return fields.Fields[i]
+	}
+	return nil
+}
+
+// referencesField returns the references field, default is the primary key
+func referencesField(fields StructFields, references string) (*StructField, error) {
+	if references != "" {
+		if f := fieldOf(fields, references); f != nil {
+			return f, nil
+		}
+		return nil, fmt.Errorf("references %s not found", references)
+	}
+
+	for _, f := range fields.Fields {
+		if f.PrimaryKey {
+			return f, nil
+		}
+	}
+	return nil, fmt.Errorf("primary_key is not set, the references is required")
+}
+
+func tableOf(rt reflect.Type) string {
+	if n, ok := reflect.New(rt).Interface().(Namer); ok {
+		return util.SnakeCasedName(n.Name())
+	}
+	return util.SnakeCasedName(rt.Name())
+}
@@ -0,0 +1,168 @@
+package orm
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	goerrors "errors"
+	"sync/atomic"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+var _ RawDB = &replicaSet{}
+
+type ReplicaPolicy string
+
+const (
+	// ReplicaRoundRobin choose the healthy replicas in turn
+	ReplicaRoundRobin ReplicaPolicy = "round_robin"
+	// ReplicaLeastConn choose the healthy replica with the least in use connections
+	ReplicaLeastConn ReplicaPolicy = "least_conn"
+)
+
+type replica struct {
+	dsn     string
+	db      *sql.DB
+	healthy atomic.Bool
+}
+
+// replicaSet routes the queries to the replicas, and the others to the primary,
+// the queries with WithPrimary(ctx) or in a Tx are sent to the primary
+type replicaSet struct {
+	primary  *sql.DB
+	replicas []*replica
+	policy   ReplicaPolicy
+	next     atomic.Uint32
+	stopCh   chan struct{}
+}
+
+func openReplicas(primary *sql.DB, opts *DBOptions) (*replicaSet, error) {
+	p := &replicaSet{
+		primary: primary,
+		policy:  opts.replicaPolicy,
+		stopCh:  make(chan struct{}),
+	}
+
+	for _, dsn := range opts.replicas {
+		db, err := sql.Open(opts.driver, dsn)
+		if err != nil {
+			p.Close()
+			return nil, err
+		}
+		setConnPool(db, opts)
+
+		r := &replica{dsn: dsn, db: db}
+		r.healthy.Store(true)
+		p.replicas = append(p.replicas, r)
+	}
+
+	p.check()
+	if opts.replicaCheckInterval > 0 {
+		go p.run(opts.replicaCheckInterval)
+	}
+
+	return p, nil
+}
+
+func (p *replicaSet) run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.stopCh:
+			return
+		case <-ticker.C:
+			p.check()
+		}
+	}
+}
+
+// check ping the replicas, the failing replica is taken out of rotation until it recovers
+func (p *replicaSet) check() {
+	for _, r := range p.replicas {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		err := r.db.PingContext(ctx)
+		cancel()
+
+		healthy := err == nil
+		if r.healthy.Swap(healthy) != healthy {
+			klog.InfoS("replica health changed", "dsn", r.dsn, "healthy", healthy, "err", err)
+		}
+	}
+}
+
+// pick returns a healthy replica, nil if there is no one
+func (p *replicaSet) pick() *replica {
+	n := len(p.replicas)
+
+	if p.policy == ReplicaLeastConn {
+		var ret *replica
+		inUse := 0
+		for _, r := range p.replicas {
+			if !r.healthy.Load() {
+				continue
+			}
+			if i := r.db.Stats().InUse; ret == nil || i < inUse {
+				ret, inUse = r, i
+			}
+		}
+		return ret
+	}
+
+	start := int(p.next.Add(1))
+	for i := 0; i < n; i++ {
+		if r := p.replicas[(start+i)%n]; r.healthy.Load() {
+			return r
+		}
+	}
+	return nil
+}
+
+func (p *replicaSet) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return p.primary.ExecContext(ctx, query, args...)
+}
+
+func (p *replicaSet) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	if IsPrimary(ctx) {
+		return p.primary.QueryContext(ctx, query, args...)
+	}
+
+	r := p.pick()
+	if r == nil {
+		return p.primary.QueryContext(ctx, query, args...)
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if goerrors.Is(err, driver.ErrBadConn) {
+		klog.InfoS("replica health changed", "dsn", r.dsn, "healthy", false, "err", err)
+		r.healthy.Store(false)
+		return p.primary.QueryContext(ctx, query, args...)
+	}
+
+	return rows, err
+}
+
+func (p *replicaSet) Close() error {
+	close(p.stopCh)
+
+	var errs []error
+	for _, r := range p.replicas {
+		if err := r.db.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return goerrors.Join(errs...)
+}
+
+// primaryExecer sends the queries of the driver to the primary,
+// e.g. the table schema should be read from the primary during AutoMigrate
+type primaryExecer struct {
+	Execer
+}
+
+func (p primaryExecer) Query(ctx context.Context, query string, args ...interface{}) *Rows {
+	return p.Execer.Query(WithPrimary(ctx), query, args...)
+}
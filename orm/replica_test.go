@@ -0,0 +1,91 @@
+package orm
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplicas(t *testing.T) {
+	if !testAvailable || testDriver != "sqlite3" {
+		t.Skipf("sqlite3 is required")
+	}
+
+	// the replicas are the different in-memory databases,
+	// the value of the test table shows where the query is sent
+	var dsns []string
+	for i := 1; i <= 2; i++ {
+		dsn := fmt.Sprintf("file:replica%d?cache=shared&mode=memory", i)
+		db, err := sql.Open(testDriver, dsn)
+		require.NoError(t, err)
+		defer db.Close()
+
+		_, err = db.Exec("CREATE TABLE test (value int)")
+		require.NoError(t, err)
+		_, err = db.Exec("INSERT INTO test VALUES (?)", i)
+		require.NoError(t, err)
+
+		dsns = append(dsns, dsn)
+	}
+
+	db, err := Open(testDriver, testDsn, WithReplicas(dsns...))
+	require.NoError(t, err)
+	defer db.Close()
+
+	ctx := context.Background()
+	db.Exec(ctx, "DROP TABLE IF EXISTS test")
+	defer db.Exec(ctx, "DROP TABLE IF EXISTS test")
+
+	_, err = db.Exec(ctx, "CREATE TABLE test (value int)")
+	require.NoError(t, err)
+	_, err = db.Exec(ctx, "INSERT INTO test VALUES (?)", 0)
+	require.NoError(t, err)
+
+	value := func(ctx context.Context, db Interface) int {
+		var v int
+		require.NoError(t, db.Query(ctx, "SELECT value FROM test").Row(&v))
+		return v
+	}
+
+	// round robin
+	got := map[int]int{}
+	for i := 0; i < 4; i++ {
+		got[value(ctx, db)]++
+	}
+	assert.Equal(t, map[int]int{1: 2, 2: 2}, got)
+
+	// read after write
+	assert.Equal(t, 0, value(WithPrimary(ctx), db))
+
+	// tx
+	err = db.Transaction(ctx, func(ctx context.Context) error {
+		assert.Equal(t, 0, value(ctx, db))
+		return nil
+	})
+	require.NoError(t, err)
+
+	// the unhealthy replica is taken out of rotation
+	replicas := db.(*ormDB).replicas
+	replicas.replicas[0].healthy.Store(false)
+	for i := 0; i < 2; i++ {
+		assert.Equal(t, 2, value(ctx, db))
+	}
+
+	replicas.replicas[1].healthy.Store(false)
+	assert.Equal(t, 0, value(ctx, db), "fallback to the primary")
+
+	replicas.check()
+	assert.True(t, replicas.replicas[0].healthy.Load())
+	assert.True(t, replicas.replicas[1].healthy.Load())
+
+	// least conn
+	replicas.policy = ReplicaLeastConn
+	rows, err := replicas.replicas[0].db.Query("SELECT value FROM test")
+	require.NoError(t, err)
+	defer rows.Close()
+	assert.Equal(t, 2, value(ctx, db))
+}
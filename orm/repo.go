@@ -0,0 +1,188 @@
+package orm
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Repo is the type-safe wrapper of the Interface for the struct T,
+// the cols of WithCols and WithOrderby are checked against the fields of T
+type Repo[T any] struct {
+	db     Interface
+	opts   []QueryOption
+	rt     reflect.Type
+	fields StructFields
+}
+
+// NewRepo returns the Repo of T, the opts are applied to all of the calls,
+// e.g. NewRepo[User](db, WithTable("system_user"))
+func NewRepo[T any](db Interface, opts ...QueryOption) (*Repo[T], error) {
+	rt := reflect.TypeOf((*T)(nil)).Elem()
+	if rt.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("repo: unsupported type %s, it should be a struct", rt)
+	}
+
+	p := &Repo[T]{
+		db:     db,
+		rt:     rt,
+		fields: cachedTypeFields(rt, db),
+	}
+
+	if _, err := p.options(nil, opts); err != nil {
+		return nil, err
+	}
+	p.opts = opts
+
+	return p, nil
+}
+
+// options merge the opts with the default opts of the repo, and check the cols
+func (p *Repo[T]) options(sample interface{}, opts []QueryOption) ([]QueryOption, error) {
+	opts = append(append([]QueryOption{}, p.opts...), opts...)
+
+	o, err := NewOptions(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, col := range o.cols {
+		if _, ok := p.fields.nameIndex[col]; !ok {
+			return nil, fmt.Errorf("repo: column %s not found in %s", col, p.rt)
+		}
+	}
+
+	for _, v := range o.orderby {
+		match := regOrderby.FindStringSubmatch(strings.TrimSpace(v))
+		if match == nil {
+			return nil, fmt.Errorf("repo: unsupported order by %q", v)
+		}
+		if _, ok := p.fields.nameIndex[match[1]]; !ok {
+			return nil, fmt.Errorf("repo: order by column %s not found in %s", match[1], p.rt)
+		}
+	}
+
+	if sample != nil {
+		opts = append(opts, WithSample(sample))
+	}
+
+	return opts, nil
+}
+
+func (p *Repo[T]) Get(ctx context.Context, opts ...QueryOption) (*T, error) {
+	opts, err := p.options(nil, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := new(T)
+	if err := p.db.Get(ctx, ret, opts...); err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+// List returns the rows and the total number of the rows matched by the selector
+func (p *Repo[T]) List(ctx context.Context, opts ...QueryOption) ([]T, int, error) {
+	var total int
+	opts, err := p.options(nil, append(opts, WithTotal(&total)))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var ret []T
+	if err := p.db.List(ctx, &ret, opts...); err != nil {
+		return nil, 0, err
+	}
+
+	return ret, total, nil
+}
+
+func (p *Repo[T]) Insert(ctx context.Context, obj *T, opts ...QueryOption) error {
+	opts, err := p.options(nil, opts)
+	if err != nil {
+		return err
+	}
+
+	return p.db.Insert(ctx, obj, opts...)
+}
+
+func (p *Repo[T]) Update(ctx context.Context, obj *T, opts ...QueryOption) error {
+	opts, err := p.options(nil, opts)
+	if err != nil {
+		return err
+	}
+
+	return p.db.Update(ctx, obj, opts...)
+}
+
+// Delete deletes the rows matched by WithSelector
+func (p *Repo[T]) Delete(ctx context.Context, opts ...QueryOption) error {
+	opts, err := p.options(nil, opts)
+	if err != nil {
+		return err
+	}
+
+	return p.db.Delete(ctx, new(T), opts...)
+}
+
+// Iter returns the iterator of the rows, it's not limited by WithMaxRows,
+// the iterator should be closed after used
+func (p *Repo[T]) Iter(ctx context.Context, opts ...QueryOption) (*RepoIter[T], error) {
+	opts, err := p.options(new(T), opts)
+	if err != nil {
+		return nil, err
+	}
+
+	o, err := NewOptions(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	// the deterministic fields are selected by the ciphertexts, like List
+	if o._selector != nil {
+		rt := reflect.TypeOf(new(T)).Elem()
+		if o._selector, err = encryptSelector(o._selector, cachedTypeFields(rt, p.db), keyringOf(p.db)); err != nil {
+			return nil, err
+		}
+	}
+
+	query, _, args, _, err := o.GenListSql(p.db)
+	if err != nil {
+		return nil, err
+	}
+
+	it, err := p.db.Query(ctx, query, args...).Iterator()
+	if err != nil {
+		return nil, err
+	}
+
+	return &RepoIter[T]{it: it}, nil
+}
+
+// RepoIter is the iterator of Repo.Iter
+//
+//	for it.Next() {
+//		row, err := it.Row()
+//	}
+type RepoIter[T any] struct {
+	it RowsIter
+}
+
+func (p *RepoIter[T]) Next() bool {
+	return p.it.Next()
+}
+
+func (p *RepoIter[T]) Row() (*T, error) {
+	ret := new(T)
+	if err := p.it.Row(ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func (p *RepoIter[T]) Close() error {
+	return p.it.Close()
+}
@@ -0,0 +1,104 @@
+package orm
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRepo(t *testing.T) {
+	runTests(t, func(db DB, ctx context.Context) {
+		type test struct {
+			Name string `sql:"where,primary_key,size=32"`
+			Age  int
+		}
+
+		_, err := NewRepo[int](db)
+		assert.Error(t, err)
+
+		_, err = NewRepo[test](db, WithOrderby("unknown"))
+		assert.Error(t, err)
+
+		repo, err := NewRepo[test](db)
+		require.NoError(t, err)
+
+		require.NoError(t, db.AutoMigrate(ctx, &test{}))
+
+		for _, v := range []test{{"tom", 14}, {"jerry", 12}, {"spike", 30}} {
+			v := v
+			require.NoError(t, repo.Insert(ctx, &v))
+		}
+
+		got, err := repo.Get(ctx, WithSelector("name=tom"))
+		require.NoError(t, err)
+		assert.Equal(t, &test{"tom", 14}, got)
+
+		list, total, err := repo.List(ctx, WithSelector("age<20"), WithOrderby("age"), WithLimit(0, 1))
+		require.NoError(t, err)
+		assert.Equal(t, []test{{"jerry", 12}}, list)
+		assert.Equal(t, 2, total)
+
+		_, _, err = repo.List(ctx, WithCols("name", "unknown"))
+		assert.Error(t, err)
+
+		_, _, err = repo.List(ctx, WithOrderby("age desc, name"))
+		assert.Error(t, err)
+
+		require.NoError(t, repo.Update(ctx, &test{"tom", 15}))
+		got, err = repo.Get(ctx, WithSelector("name=tom"))
+		require.NoError(t, err)
+		assert.Equal(t, 15, got.Age)
+
+		require.NoError(t, repo.Delete(ctx, WithSelector("name=spike")))
+
+		it, err := repo.Iter(ctx, WithOrderby("name"))
+		require.NoError(t, err)
+		defer it.Close()
+
+		var rows []test
+		for it.Next() {
+			row, err := it.Row()
+			require.NoError(t, err)
+			rows = append(rows, *row)
+		}
+		assert.Equal(t, []test{{"jerry", 12}, {"tom", 15}}, rows)
+	})
+}
+
+func TestRepoIterEncrypt(t *testing.T) {
+	if !testAvailable {
+		t.Skipf("SQL server not running on %s:%s", testDriver, testDsn)
+	}
+
+	type test struct {
+		ID    int    `sql:"primary_key"`
+		Email string `sql:"encrypt=deterministic"`
+	}
+
+	ctx := context.Background()
+	db, err := Open(testDriver, testDsn, WithKeyring(newTestKeyring(t, "k1")))
+	require.NoError(t, err)
+	defer db.Close()
+	defer db.Exec(ctx, "DROP TABLE IF EXISTS test")
+
+	require.NoError(t, db.AutoMigrate(ctx, &test{}))
+	require.NoError(t, db.InsertBatch(ctx, []test{{1, "tom"}, {2, "jerry"}}))
+
+	repo, err := NewRepo[test](db)
+	require.NoError(t, err)
+
+	// the selector of the deterministic field matches the ciphertext
+	it, err := repo.Iter(ctx, WithSelector("email=jerry"))
+	require.NoError(t, err)
+	defer it.Close()
+
+	var rows []test
+	for it.Next() {
+		row, err := it.Row()
+		require.NoError(t, err)
+		rows = append(rows, *row)
+	}
+	assert.Equal(t, []test{{2, "jerry"}}, rows)
+}
@@ -0,0 +1,174 @@
+package orm
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// structTypeOf returns the struct type of the sample, e.g. *T, []T, *[]*T -> T
+func structTypeOf(sample interface{}) (reflect.Type, bool) {
+	if sample == nil {
+		return nil, false
+	}
+
+	rt := reflect.TypeOf(sample)
+	for rt.Kind() == reflect.Ptr || rt.Kind() == reflect.Slice || rt.Kind() == reflect.Array {
+		rt = rt.Elem()
+	}
+
+	return rt, rt.Kind() == reflect.Struct
+}
+
+// softDeleteField returns the `sql:"soft_delete"` field of the sample
+func softDeleteField(sample interface{}, db Driver) *StructField {
+	rt, ok := structTypeOf(sample)
+	if !ok {
+		return nil
+	}
+
+	for _, f := range cachedTypeFields(rt, db).Fields {
+		if f.SoftDelete > 0 {
+			return f
+		}
+	}
+	return nil
+}
+
+// versionField returns the `sql:"version"` field of the sample
+func versionField(sample interface{}, db Driver) *StructField {
+	rt, ok := structTypeOf(sample)
+	if !ok {
+		return nil
+	}
+
+	for _, f := range cachedTypeFields(rt, db).Fields {
+		if f.Version {
+			return f
+		}
+	}
+	return nil
+}
+
+// versionValue returns the version field value of the sample,
+// ok is false if the sample has no version field or the value is nil
+func versionValue(sample interface{}, db Driver) (fv reflect.Value, ok bool) {
+	f := versionField(sample, db)
+	if f == nil {
+		return
+	}
+
+	fv, err := getSubv(reflect.Indirect(reflect.ValueOf(sample)), f.Index, false)
+	if err != nil || IsNil(fv) {
+		return
+	}
+
+	return fv, true
+}
+
+// notDeletedSql the rows which are not soft deleted
+func notDeletedSql(d Dialect, f *StructField) string {
+	if f.SoftDelete == UnixTime {
+		return d.Quote(f.Name) + " IS NULL"
+	}
+	return d.Quote(f.Name) + " = 0"
+}
+
+// isZeroSoftDelete the zero value of the soft_delete field means not deleted,
+// it should not be set by Update, and the zero time.Time should be inserted as NULL
+func isZeroSoftDelete(f *StructField, fv reflect.Value) bool {
+	return f.SoftDelete > 0 && reflect.Indirect(fv).IsZero()
+}
+
+// scope returns the selector with the soft delete condition
+func (p *queryOptions) scope(db Driver) Selector {
+	if p.unscoped {
+		return p._selector
+	}
+
+	f := softDeleteField(p.sample, db)
+	if f == nil {
+		return p._selector
+	}
+
+	return &scopedSelector{Selector: p._selector, field: f}
+}
+
+// scopedSelector append the soft delete condition to the selector
+type scopedSelector struct {
+	Selector
+	field *StructField
+}
+
+func (s *scopedSelector) Empty() bool {
+	return false
+}
+
+func (s *scopedSelector) String() string {
+	if s.Selector == nil || s.Selector.Empty() {
+		return notDeletedSql(DefaultDialect, s.field)
+	}
+	return s.Selector.String() + "," + notDeletedSql(DefaultDialect, s.field)
+}
+
+func (s *scopedSelector) Sql() (string, []interface{}) {
+	return s.DialectSql(DefaultDialect)
+}
+
+func (s *scopedSelector) DialectSql(d Dialect) (string, []interface{}) {
+	scope := notDeletedSql(d, s.field)
+	if s.Selector == nil {
+		return scope, nil
+	}
+
+	query, args := s.Selector.DialectSql(d)
+	if query == "" {
+		return scope, nil
+	}
+
+	return query + " and " + scope, args
+}
+
+// genSoftDeleteSql UPDATE `table` SET `deleted_at` = ? WHERE ... and `deleted_at` IS NULL
+func genSoftDeleteSql(d Dialect, table string, f *StructField, selector Selector) (string, []interface{}, error) {
+	if table == "" {
+		return "", nil, errTableEmpty
+	}
+	if selector == nil {
+		return "", nil, errSelectorNil
+	}
+
+	query, args := selector.DialectSql(d)
+	if query == "" {
+		return "", nil, errSelectorEmpty
+	}
+
+	return fmt.Sprintf("UPDATE %s SET %s = ? WHERE %s and %s", d.Quote(table), d.Quote(f.Name), query, notDeletedSql(d, f)),
+		append([]interface{}{NewCurTime(f.SoftDelete, defaultClock.Now())}, args...), nil
+}
+
+// versionOf returns the value of the version field
+func versionOf(fv reflect.Value) int64 {
+	fv = reflect.Indirect(fv)
+	switch fv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return fv.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(fv.Uint())
+	}
+	return 0
+}
+
+// setVersion set the version of the sample after updated, if it's addressable
+func setVersion(fv reflect.Value, version int64) {
+	fv = reflect.Indirect(fv)
+	if !fv.CanSet() {
+		return
+	}
+
+	switch fv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		fv.SetInt(version)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		fv.SetUint(uint64(version))
+	}
+}
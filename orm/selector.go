@@ -19,6 +19,8 @@ var (
 		string(selection.Equals), string(selection.DoubleEquals), string(selection.NotEquals),
 		string(selection.Exists), string(selection.DoesNotExist),
 		string(selection.GreaterThan), string(selection.LessThan),
+		string(selection.GreaterThanOrEquals), string(selection.LessThanOrEquals),
+		string(selection.Between),
 		string(selection.Contains), string(selection.NotContains),
 		string(selection.HasPrefix), string(selection.HasSuffix),
 	}
@@ -56,6 +58,9 @@ type Selector interface {
 	RequiresExactMatch(field string) (value string, found bool)
 
 	Sql() (string, []interface{})
+
+	// DialectSql is like Sql, but quotes the keys with the dialect
+	DialectSql(d Dialect) (string, []interface{})
 }
 
 // NewSelector returns a nil selector
@@ -102,6 +107,9 @@ type Requirement struct {
 	// than on a single-element map, so we have a slice here.
 	strValues []string
 	//values    []interface{}
+
+	// groups of the Or operator, the requirements of each group are ANDed together
+	groups []Requirements
 }
 
 // NewRequirement is the constructor for a Requirement.
@@ -151,6 +159,15 @@ func NewRequirement(key string, op selection.Operator, vals []string, opts ...fi
 				allErrs = append(allErrs, field.Invalid(valuePath.Index(i), vals[i], "for 'Gt', 'Lt' operators, the value must be an integer"))
 			}
 		}
+	// the values are compared by the database, e.g. created>=2023-01-01
+	case selection.GreaterThanOrEquals, selection.LessThanOrEquals:
+		if len(vals) != 1 {
+			allErrs = append(allErrs, field.Invalid(valuePath, vals, "for 'Gte', 'Lte' operators, exactly one value is required"))
+		}
+	case selection.Between:
+		if len(vals) != 2 {
+			allErrs = append(allErrs, field.Invalid(valuePath, vals, "for 'between' operator, exactly two values are required"))
+		}
 	default:
 		allErrs = append(allErrs, field.NotSupported(path.Child("operator"), op, validRequirementOperators))
 	}
@@ -163,6 +180,24 @@ func NewRequirement(key string, op selection.Operator, vals []string, opts ...fi
 	return &Requirement{key: key, operator: op, strValues: vals}, allErrs.ToAggregate()
 }
 
+// NewOrRequirement returns a requirement which matches any of the groups,
+// the requirements of each group are ANDed together.
+func NewOrRequirement(groups ...[]Requirement) (*Requirement, error) {
+	if len(groups) == 0 {
+		return nil, fmt.Errorf("for 'or' operator, the groups can't be empty")
+	}
+
+	r := &Requirement{operator: selection.Or, groups: make([]Requirements, len(groups))}
+	for i, group := range groups {
+		if len(group) == 0 {
+			return nil, fmt.Errorf("for 'or' operator, the group %d can't be empty", i)
+		}
+		r.groups[i] = Requirements(internalSelector(group).DeepCopy())
+	}
+
+	return r, nil
+}
+
 func (r *Requirement) hasValue(value string) bool {
 	for i := range r.strValues {
 		if r.strValues[i] == value {
@@ -200,7 +235,7 @@ func sqlArray(key, op string, values []string) (field string, args []interface{}
 		return "", nil
 	}
 
-	field = fmt.Sprintf("`%s` %s (?", key, op)
+	field = fmt.Sprintf("%s %s (?", key, op)
 	args = append(args, values[0])
 
 	for i := 1; i < len(values); i++ {
@@ -213,53 +248,96 @@ func sqlArray(key, op string, values []string) (field string, args []interface{}
 }
 
 func (r *Requirement) Sql() (string, []interface{}) {
+	return r.DialectSql(DefaultDialect)
+}
+
+func (r *Requirement) DialectSql(d Dialect) (string, []interface{}) {
 	if r == nil {
 		return "", nil
 	}
 
+	key := d.Quote(r.key)
+
 	switch r.operator {
 	case selection.In, selection.Equals, selection.DoubleEquals:
 		if len(r.strValues) == 1 {
-			return fmt.Sprintf("`%s` = ?", r.key), []interface{}{r.strValues[0]}
+			return fmt.Sprintf("%s = ?", key), []interface{}{r.strValues[0]}
 		}
-		return sqlArray(r.key, "in", r.strValues)
+		return sqlArray(key, "in", r.strValues)
 	case selection.NotIn, selection.NotEquals:
 		if len(r.strValues) == 1 {
-			return fmt.Sprintf("`%s` != ?", r.key), []interface{}{r.strValues[0]}
+			return fmt.Sprintf("%s != ?", key), []interface{}{r.strValues[0]}
 		}
-		return sqlArray(r.key, "not in", r.strValues)
+		return sqlArray(key, "not in", r.strValues)
 	case selection.Exists:
-		return fmt.Sprintf("`%s` NOT NULL", r.key), nil
+		return fmt.Sprintf("%s NOT NULL", key), nil
 	case selection.DoesNotExist:
-		return fmt.Sprintf("`%s` IS NULL", r.key), nil
+		return fmt.Sprintf("%s IS NULL", key), nil
 	case selection.GreaterThan:
 		if len(r.strValues) == 1 {
-			return fmt.Sprintf("`%s` > ?", r.key), []interface{}{r.strValues[0]}
+			return fmt.Sprintf("%s > ?", key), []interface{}{r.strValues[0]}
 		}
 	case selection.LessThan:
 		if len(r.strValues) == 1 {
-			return fmt.Sprintf("`%s` < ?", r.key), []interface{}{r.strValues[0]}
+			return fmt.Sprintf("%s < ?", key), []interface{}{r.strValues[0]}
+		}
+	case selection.GreaterThanOrEquals:
+		if len(r.strValues) == 1 {
+			return fmt.Sprintf("%s >= ?", key), []interface{}{r.strValues[0]}
+		}
+	case selection.LessThanOrEquals:
+		if len(r.strValues) == 1 {
+			return fmt.Sprintf("%s <= ?", key), []interface{}{r.strValues[0]}
 		}
+	case selection.Between:
+		if len(r.strValues) == 2 {
+			return fmt.Sprintf("%s between ? and ?", key), []interface{}{r.strValues[0], r.strValues[1]}
+		}
+	case selection.Or:
+		return r.groupsSql(d)
 	case selection.Contains:
 		if len(r.strValues) == 1 {
-			return fmt.Sprintf("`%s` like ?", r.key), []interface{}{"%" + r.strValues[0] + "%"}
+			return fmt.Sprintf("%s like ?", key), []interface{}{"%" + r.strValues[0] + "%"}
 		}
 	case selection.NotContains:
 		if len(r.strValues) == 1 {
-			return fmt.Sprintf("`%s` not like ?", r.key), []interface{}{"%" + r.strValues[0] + "%"}
+			return fmt.Sprintf("%s not like ?", key), []interface{}{"%" + r.strValues[0] + "%"}
 		}
 	case selection.HasPrefix:
 		if len(r.strValues) == 1 {
-			return fmt.Sprintf("`%s` like ?", r.key), []interface{}{r.strValues[0] + "%"}
+			return fmt.Sprintf("%s like ?", key), []interface{}{r.strValues[0] + "%"}
 		}
 	case selection.HasSuffix:
 		if len(r.strValues) == 1 {
-			return fmt.Sprintf("`%s` like ?", r.key), []interface{}{"%" + r.strValues[0]}
+			return fmt.Sprintf("%s like ?", key), []interface{}{"%" + r.strValues[0]}
 		}
 	}
 	return "", nil
 }
 
+// groupsSql: (`a` = ? or (`b` = ? and `c` = ?))
+func (r *Requirement) groupsSql(d Dialect) (string, []interface{}) {
+	fields := []string{}
+	args := []interface{}{}
+	for _, group := range r.Groups() {
+		q, a := internalSelector(group).DialectSql(d)
+		if q == "" {
+			continue
+		}
+		if len(group) > 1 {
+			q = "(" + q + ")"
+		}
+		fields = append(fields, q)
+		args = append(args, a...)
+	}
+
+	if len(fields) == 0 {
+		return "", nil
+	}
+
+	return "(" + strings.Join(fields, " or ") + ")", args
+}
+
 // Key returns requirement key
 func (r *Requirement) Key() string {
 	return r.key
@@ -270,6 +348,15 @@ func (r *Requirement) Operator() selection.Operator {
 	return r.operator
 }
 
+// Groups returns the requirements of the Or operator
+func (r *Requirement) Groups() []Requirements {
+	if r.operator != selection.Or {
+		return nil
+	}
+
+	return r.groups
+}
+
 // Values returns requirement values
 func (r *Requirement) Values() sets.String {
 	ret := sets.String{}
@@ -279,6 +366,12 @@ func (r *Requirement) Values() sets.String {
 	return ret
 }
 
+// ValuesUnsorted returns requirement values in the order of the selector,
+// e.g. the lower and upper bound of Between
+func (r *Requirement) ValuesUnsorted() []string {
+	return append([]string{}, r.strValues...)
+}
+
 // Equal checks the equality of requirement.
 func (r Requirement) Equal(x Requirement) bool {
 	if r.key != x.key {
@@ -287,6 +380,22 @@ func (r Requirement) Equal(x Requirement) bool {
 	if r.operator != x.operator {
 		return false
 	}
+	if r.operator == selection.Or {
+		if len(r.groups) != len(x.groups) {
+			return false
+		}
+		for i := range r.groups {
+			if len(r.groups[i]) != len(x.groups[i]) {
+				return false
+			}
+			for j := range r.groups[i] {
+				if !r.groups[i][j].Equal(x.groups[i][j]) {
+					return false
+				}
+			}
+		}
+		return true
+	}
 	return cmp.Equal(r.strValues, x.strValues)
 }
 
@@ -302,6 +411,14 @@ func (s internalSelector) Empty() bool {
 // Requirement. If called on an invalid Requirement, an error is
 // returned. See NewRequirement for creating a valid Requirement.
 func (r *Requirement) String() string {
+	if r.operator == selection.Or {
+		groups := make([]string, len(r.groups))
+		for i, group := range r.groups {
+			groups[i] = internalSelector(group).String()
+		}
+		return "(" + strings.Join(groups, " or ") + ")"
+	}
+
 	var sb strings.Builder
 	sb.Grow(
 		// length of r.key
@@ -330,6 +447,12 @@ func (r *Requirement) String() string {
 		sb.WriteString(">")
 	case selection.LessThan:
 		sb.WriteString("<")
+	case selection.GreaterThanOrEquals:
+		sb.WriteString(">=")
+	case selection.LessThanOrEquals:
+		sb.WriteString("<=")
+	case selection.Between:
+		sb.WriteString(" between ")
 	case selection.Contains:
 		sb.WriteString("~")
 	case selection.NotContains:
@@ -343,11 +466,14 @@ func (r *Requirement) String() string {
 	}
 
 	switch r.operator {
-	case selection.In, selection.NotIn:
+	case selection.In, selection.NotIn, selection.Between:
 		sb.WriteString("(")
 	}
 	if len(r.strValues) == 1 {
 		sb.WriteString(r.strValues[0])
+	} else if r.operator == selection.Between {
+		// the order of the range matters
+		sb.WriteString(strings.Join(r.strValues, ","))
 	} else { // only > 1 since == 0 prohibited by NewRequirement
 		// normalizes value order on output, without mutating the in-memory selector representation
 		// also avoids normalization when it is not required, and ensures we do not mutate shared data
@@ -355,7 +481,7 @@ func (r *Requirement) String() string {
 	}
 
 	switch r.operator {
-	case selection.In, selection.NotIn:
+	case selection.In, selection.NotIn, selection.Between:
 		sb.WriteString(")")
 	}
 	return sb.String()
@@ -398,10 +524,14 @@ func (s internalSelector) Matches(db DB) bool {
 }
 
 func (s internalSelector) Sql() (string, []interface{}) {
+	return s.DialectSql(DefaultDialect)
+}
+
+func (s internalSelector) DialectSql(d Dialect) (string, []interface{}) {
 	fields := []string{}
 	args := []interface{}{}
 	for i := range s {
-		if q, a := s[i].Sql(); len(q) > 0 {
+		if q, a := s[i].DialectSql(d); len(q) > 0 {
 			fields = append(fields, q)
 			args = append(args, a...)
 
@@ -485,26 +615,38 @@ const (
 	NotInToken
 	// OpenParToken represents open parenthesis
 	OpenParToken
+	// GreaterThanOrEqualsToken represents greater than or equals
+	GreaterThanOrEqualsToken
+	// LessThanOrEqualsToken represents less than or equals
+	LessThanOrEqualsToken
+	// BetweenToken represents between
+	BetweenToken
+	// OrToken represents or
+	OrToken
 )
 
 // string2token contains the mapping between lexer Token and token literal
 // (except IdentifierToken, EndOfStringToken and ErrorToken since it makes no sense)
 var string2token = map[string]Token{
-	")":     ClosedParToken,
-	",":     CommaToken,
-	"!":     DoesNotExistToken,
-	"==":    DoubleEqualsToken,
-	"=":     EqualsToken,
-	">":     GreaterThanToken,
-	"in":    InToken,
-	"<":     LessThanToken,
-	"~":     ContainsToken,
-	"!~":    NotContainsToken,
-	"=~":    HasPrefixToken,
-	"~=":    HasSuffixToken,
-	"!=":    NotEqualsToken,
-	"notin": NotInToken,
-	"(":     OpenParToken,
+	")":       ClosedParToken,
+	",":       CommaToken,
+	"!":       DoesNotExistToken,
+	"==":      DoubleEqualsToken,
+	"=":       EqualsToken,
+	">":       GreaterThanToken,
+	"in":      InToken,
+	"<":       LessThanToken,
+	"~":       ContainsToken,
+	"!~":      NotContainsToken,
+	"=~":      HasPrefixToken,
+	"~=":      HasSuffixToken,
+	"!=":      NotEqualsToken,
+	"notin":   NotInToken,
+	"(":       OpenParToken,
+	">=":      GreaterThanOrEqualsToken,
+	"<=":      LessThanOrEqualsToken,
+	"between": BetweenToken,
+	"or":      OrToken,
 }
 
 // ScannedItem contains the Token and the literal produced by the lexer.
@@ -655,7 +797,7 @@ func (p *Parser) lookahead(context ParserContext) (Token, string) {
 	tok, lit := p.scannedItems[p.position].tok, p.scannedItems[p.position].literal
 	if context == Values {
 		switch tok {
-		case InToken, NotInToken:
+		case InToken, NotInToken, BetweenToken, OrToken:
 			tok = IdentifierToken
 		}
 	}
@@ -668,7 +810,7 @@ func (p *Parser) consume(context ParserContext) (Token, string) {
 	tok, lit := p.scannedItems[p.position-1].tok, p.scannedItems[p.position-1].literal
 	if context == Values {
 		switch tok {
-		case InToken, NotInToken:
+		case InToken, NotInToken, BetweenToken, OrToken:
 			tok = IdentifierToken
 		}
 	}
@@ -696,8 +838,8 @@ func (p *Parser) parse() (internalSelector, error) {
 	for {
 		tok, lit := p.lookahead(Values)
 		switch tok {
-		case IdentifierToken, DoesNotExistToken:
-			r, err := p.parseRequirement()
+		case IdentifierToken, DoesNotExistToken, OpenParToken:
+			r, err := p.parseRequirementOrGroup()
 			if err != nil {
 				return nil, fmt.Errorf("unable to parse requirement: %v", err)
 			}
@@ -708,8 +850,8 @@ func (p *Parser) parse() (internalSelector, error) {
 				return requirements, nil
 			case CommaToken:
 				t2, l2 := p.lookahead(Values)
-				if t2 != IdentifierToken && t2 != DoesNotExistToken {
-					return nil, fmt.Errorf("found '%s', expected: identifier after ','", l2)
+				if t2 != IdentifierToken && t2 != DoesNotExistToken && t2 != OpenParToken {
+					return nil, fmt.Errorf("found '%s', expected: identifier or '(' after ','", l2)
 				}
 			default:
 				return nil, fmt.Errorf("found '%s', expected: ',' or 'end of string'", l)
@@ -717,7 +859,47 @@ func (p *Parser) parse() (internalSelector, error) {
 		case EndOfStringToken:
 			return requirements, nil
 		default:
-			return nil, fmt.Errorf("found '%s', expected: !, identifier, or 'end of string'", lit)
+			return nil, fmt.Errorf("found '%s', expected: !, identifier, '(' or 'end of string'", lit)
+		}
+	}
+}
+
+func (p *Parser) parseRequirementOrGroup() (*Requirement, error) {
+	if tok, _ := p.lookahead(Values); tok == OpenParToken {
+		return p.parseGroup()
+	}
+	return p.parseRequirement()
+}
+
+// parseGroup parses the parenthesised requirements, e.g. (x=a,y=b or z=c),
+// ',' binds tighter than 'or'
+func (p *Parser) parseGroup() (*Requirement, error) {
+	p.consume(Values) // (
+
+	var groups [][]Requirement
+	var requirements []Requirement
+	for {
+		tok, lit := p.lookahead(Values)
+		if tok != IdentifierToken && tok != DoesNotExistToken && tok != OpenParToken {
+			return nil, fmt.Errorf("found '%s', expected: !, identifier or '('", lit)
+		}
+
+		r, err := p.parseRequirementOrGroup()
+		if err != nil {
+			return nil, err
+		}
+		requirements = append(requirements, *r)
+
+		t, l := p.consume(KeyAndOperator)
+		switch t {
+		case CommaToken:
+		case OrToken:
+			groups = append(groups, requirements)
+			requirements = nil
+		case ClosedParToken:
+			return NewOrRequirement(append(groups, requirements)...)
+		default:
+			return nil, fmt.Errorf("found '%s', expected: ',', 'or' or ')'", l)
 		}
 	}
 }
@@ -738,7 +920,15 @@ func (p *Parser) parseRequirement() (*Requirement, error) {
 	switch operator {
 	case selection.In, selection.NotIn:
 		values, err = p.parseValues()
-	case selection.Equals, selection.DoubleEquals, selection.NotEquals, selection.GreaterThan, selection.LessThan, selection.Contains, selection.NotContains, selection.HasPrefix, selection.HasSuffix:
+	case selection.Between:
+		var rangeValues []string
+		if rangeValues, err = p.parseRangeValues(); err != nil {
+			return nil, err
+		}
+		return NewRequirement(key, operator, rangeValues, field.WithPath(p.path))
+	case selection.Equals, selection.DoubleEquals, selection.NotEquals, selection.GreaterThan, selection.LessThan,
+		selection.GreaterThanOrEquals, selection.LessThanOrEquals,
+		selection.Contains, selection.NotContains, selection.HasPrefix, selection.HasSuffix:
 		values, err = p.parseExactValue()
 	}
 	if err != nil {
@@ -765,7 +955,7 @@ func (p *Parser) parseKeyAndInferOperator() (string, selection.Operator, error)
 	if err := validateFieldKey(literal, p.path); err != nil {
 		return "", "", err
 	}
-	if t, _ := p.lookahead(Values); t == EndOfStringToken || t == CommaToken {
+	if t, _ := p.lookahead(KeyAndOperator); t == EndOfStringToken || t == CommaToken || t == ClosedParToken || t == OrToken {
 		if operator != selection.DoesNotExist {
 			operator = selection.Exists
 		}
@@ -789,6 +979,12 @@ func (p *Parser) parseOperator() (op selection.Operator, err error) {
 		op = selection.GreaterThan
 	case LessThanToken:
 		op = selection.LessThan
+	case GreaterThanOrEqualsToken:
+		op = selection.GreaterThanOrEquals
+	case LessThanOrEqualsToken:
+		op = selection.LessThanOrEquals
+	case BetweenToken:
+		op = selection.Between
 	case ContainsToken:
 		op = selection.Contains
 	case NotContainsToken:
@@ -832,6 +1028,21 @@ func (p *Parser) parseValues() (sets.String, error) {
 	}
 }
 
+// parseRangeValues parses the ordered values of the range (min,max)
+func (p *Parser) parseRangeValues() ([]string, error) {
+	var values []string
+	for i, expected := range []Token{OpenParToken, IdentifierToken, CommaToken, IdentifierToken, ClosedParToken} {
+		tok, lit := p.consume(Values)
+		if tok != expected {
+			return nil, fmt.Errorf("found '%s', expected: '(min,max)'", lit)
+		}
+		if i == 1 || i == 3 {
+			values = append(values, lit)
+		}
+	}
+	return values, nil
+}
+
 // parseIdentifiersList parses a (possibly empty) list of
 // of comma separated (possibly empty) identifiers
 func (p *Parser) parseIdentifiersList() (sets.String, error) {
@@ -873,7 +1084,7 @@ func (p *Parser) parseIdentifiersList() (sets.String, error) {
 func (p *Parser) parseExactValue() (sets.String, error) {
 	s := sets.NewString()
 	tok, _ := p.lookahead(Values)
-	if tok == EndOfStringToken || tok == CommaToken {
+	if tok == EndOfStringToken || tok == CommaToken || tok == ClosedParToken {
 		s.Insert("")
 		return s, nil
 	}
@@ -891,14 +1102,17 @@ func (p *Parser) parseExactValue() (sets.String, error) {
 // The input will cause an error if it does not follow this form:
 //
 //	<selector-syntax>         ::= <requirement> | <requirement> "," <selector-syntax>
-//	<requirement>             ::= [!] KEY [ <set-based-restriction> | <exact-match-restriction> ]
+//	<requirement>             ::= <group> | [!] KEY [ <set-based-restriction> | <range-restriction> | <exact-match-restriction> ]
+//	<group>                   ::= "(" <group-syntax> ")"
+//	<group-syntax>            ::= <selector-syntax> | <selector-syntax> "or" <group-syntax>
 //	<set-based-restriction>   ::= "" | <inclusion-exclusion> <value-set>
 //	<inclusion-exclusion>     ::= <inclusion> | <exclusion>
 //	<exclusion>               ::= "notin"
 //	<inclusion>               ::= "in"
 //	<value-set>               ::= "(" <values> ")"
 //	<values>                  ::= VALUE | VALUE "," <values>
-//	<exact-match-restriction> ::= ["="|"=="|"!="] VALUE
+//	<range-restriction>       ::= "between" "(" VALUE "," VALUE ")"
+//	<exact-match-restriction> ::= ["="|"=="|"!="|">"|"<"|">="|"<="|"~"|"!~"|"=~"|"~="] VALUE
 //
 // KEY is a sequence of one or more characters following [ DNS_SUBDOMAIN "/" ] DNS_field. Max length is 63 characters.
 // VALUE is a sequence of zero or more characters "([A-Za-z0-9_-\.])". Max length is 63 characters.
@@ -906,6 +1120,7 @@ func (p *Parser) parseExactValue() (sets.String, error) {
 // Example of valid syntax:
 //
 //	"x in (foo,,baz),y,z notin ()"
+//	"(status in (a,b) or owner=me),created>=2023-01-01,age between (10,20)"
 //
 // Note:
 //
@@ -917,6 +1132,7 @@ func (p *Parser) parseExactValue() (sets.String, error) {
 //	(4) A requirement with just a KEY - as in "y" above - denotes that
 //	    the KEY exists and can be any VALUE.
 //	(5) A requirement with just !KEY requires that the KEY not exist.
+//	(6) "," binds tighter than "or" in the group.
 func Parse(selector string, opts ...field.PathOption) (Selector, error) {
 	parsedSelector, err := parse(selector, field.ToPath(opts...))
 	if err != nil {
@@ -990,6 +1206,13 @@ func (in *Requirement) DeepCopyInto(out *Requirement) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.groups != nil {
+		in, out := &in.groups, &out.groups
+		*out = make([]Requirements, len(*in))
+		for i := range *in {
+			(*out)[i] = Requirements(internalSelector((*in)[i]).DeepCopy())
+		}
+	}
 	return
 }
 
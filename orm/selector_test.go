@@ -33,12 +33,21 @@ func TestSelectorParse(t *testing.T) {
 		"x!~2",
 		"x !~ 2,x =~ 3",
 		"x>1,z<5",
+		"x>=1,z<=5",
+		"x>=2023-01-01",
 	}
 	testBadStrings := []string{
 		"x=a||y=b",
 		"x==a==b",
 		"!x=a",
 		"x<a",
+		"(x=a",
+		"(x=a or)",
+		"(x=a,)",
+		"()",
+		"x between (1)",
+		"x between (1,2,3)",
+		"x=a or y=b",
 	}
 	for _, test := range testGoodStrings {
 		lq, err := Parse(test)
@@ -88,6 +97,60 @@ func TestSelectorQuery(t *testing.T) {
 	expectQuery(t, "x!~y", "`x` not like ?", "%y%")
 	expectQuery(t, "x=~y", "`x` like ?", "y%")
 	expectQuery(t, "x~=y", "`x` like ?", "%y")
+	expectQuery(t, "x>=1", "`x` >= ?", "1")
+	expectQuery(t, "x<=1", "`x` <= ?", "1")
+	expectQuery(t, "x between (9,10)", "`x` between ? and ?", "9", "10")
+	expectQuery(t, "(x=a or y=b)", "(`x` = ? or `y` = ?)", "a", "b")
+	expectQuery(t, "(x=a,y=b or z=c),w=d", "((`x` = ? and `y` = ?) or `z` = ?) and `w` = ?", "a", "b", "c", "d")
+	expectQuery(t, "(x=a or (y=b or z=c),!w)", "(`x` = ? or ((`y` = ? or `z` = ?) and `w` IS NULL))", "a", "b", "c")
+	expectQuery(t, "or=between,between=or", "`or` = ? and `between` = ?", "between", "or") // or and between in exactMatch
+}
+
+func TestSelectorGroupParse(t *testing.T) {
+	cases := []struct {
+		selector string
+		str      string
+	}{
+		{"(x=a or y=b)", "(x=a or y=b)"},
+		{"( x = a , y in (b, c) or !z ) , w", "(x=a,y in (b,c) or !z),w"},
+		{"(x or (y>=1 or z between (2,1)))", "(x or (y>=1 or z between (2,1)))"},
+		{"x between ( 10, 9 )", "x between (10,9)"},
+	}
+
+	for i, c := range cases {
+		s, err := Parse(c.selector)
+		require.NoError(t, err, "case-%d", i)
+		require.Equal(t, c.str, s.String(), "case-%d", i)
+
+		// the string form keeps parsing the same
+		s2, err := Parse(s.String())
+		require.NoError(t, err, "case-%d", i)
+		require.Equal(t, s.String(), s2.String(), "case-%d", i)
+	}
+
+	r, err := NewOrRequirement(
+		[]Requirement{getRequirement("x", selection.Equals, sets.NewString("a"), t)},
+		[]Requirement{
+			getRequirement("y", selection.GreaterThanOrEquals, sets.NewString("1"), t),
+			getRequirement("z", selection.LessThanOrEquals, sets.NewString("2"), t),
+		},
+	)
+	require.NoError(t, err)
+	require.Equal(t, "(x=a or y>=1,z<=2)", r.String())
+	require.Len(t, r.Groups(), 2)
+	require.Len(t, r.Groups()[1], 2)
+
+	// the groups are copied
+	cp := r.DeepCopy()
+	require.True(t, r.Equal(*cp))
+	cp.groups[1][0].strValues[0] = "3"
+	require.False(t, r.Equal(*cp))
+	require.Equal(t, "(x=a or y>=1,z<=2)", r.String())
+
+	_, err = NewOrRequirement()
+	require.Error(t, err)
+	_, err = NewOrRequirement([]Requirement{})
+	require.Error(t, err)
 }
 
 func TestLexer(t *testing.T) {
@@ -114,6 +177,10 @@ func TestLexer(t *testing.T) {
 		{"||", IdentifierToken},
 		{"=~", HasPrefixToken},
 		{"~=", HasSuffixToken},
+		{">=", GreaterThanOrEqualsToken},
+		{"<=", LessThanOrEqualsToken},
+		{"between", BetweenToken},
+		{"or", OrToken},
 	}
 	for _, c := range cases {
 		l := &Lexer{s: c.s, pos: 0}
@@ -149,6 +216,10 @@ func TestLexerSequence(t *testing.T) {
 		{"== != (), = notin", []Token{DoubleEqualsToken, NotEqualsToken, OpenParToken, ClosedParToken, CommaToken, EqualsToken, NotInToken}},
 		{"key>2", []Token{IdentifierToken, GreaterThanToken, IdentifierToken}},
 		{"key<1", []Token{IdentifierToken, LessThanToken, IdentifierToken}},
+		{"key>=1", []Token{IdentifierToken, GreaterThanOrEqualsToken, IdentifierToken}},
+		{"key<=1", []Token{IdentifierToken, LessThanOrEqualsToken, IdentifierToken}},
+		{"(x or y)", []Token{OpenParToken, IdentifierToken, OrToken, IdentifierToken, ClosedParToken}},
+		{"key between (1,2)", []Token{IdentifierToken, BetweenToken, OpenParToken, IdentifierToken, CommaToken, IdentifierToken, ClosedParToken}},
 	}
 	for _, c := range cases {
 		var tokens []Token
@@ -554,17 +625,17 @@ func TestAdd(t *testing.T) {
 			"key",
 			selection.In,
 			[]string{"value"},
-			internalSelector{Requirement{"key", selection.In, []string{"value"}}},
+			internalSelector{Requirement{key: "key", operator: selection.In, strValues: []string{"value"}}},
 		},
 		{
 			"keyEqualsOperator",
-			internalSelector{Requirement{"key", selection.In, []string{"value"}}},
+			internalSelector{Requirement{key: "key", operator: selection.In, strValues: []string{"value"}}},
 			"key2",
 			selection.Equals,
 			[]string{"value2"},
 			internalSelector{
-				Requirement{"key", selection.In, []string{"value"}},
-				Requirement{"key2", selection.Equals, []string{"value2"}},
+				Requirement{key: "key", operator: selection.In, strValues: []string{"value"}},
+				Requirement{key: "key2", operator: selection.Equals, strValues: []string{"value2"}},
 			},
 		},
 	}
@@ -634,14 +705,14 @@ func TestRequiresExactMatch(t *testing.T) {
 	}{
 		{
 			name:          "keyInOperatorExactMatch",
-			sel:           internalSelector{Requirement{"key", selection.In, []string{"value"}}},
+			sel:           internalSelector{Requirement{key: "key", operator: selection.In, strValues: []string{"value"}}},
 			field:         "key",
 			expectedFound: true,
 			expectedValue: "value",
 		},
 		{
 			name:          "keyInOperatorNotExactMatch",
-			sel:           internalSelector{Requirement{"key", selection.In, []string{"value", "value2"}}},
+			sel:           internalSelector{Requirement{key: "key", operator: selection.In, strValues: []string{"value", "value2"}}},
 			field:         "key",
 			expectedFound: false,
 			expectedValue: "",
@@ -649,8 +720,8 @@ func TestRequiresExactMatch(t *testing.T) {
 		{
 			name: "keyInOperatorNotExactMatch",
 			sel: internalSelector{
-				Requirement{"key", selection.In, []string{"value", "value1"}},
-				Requirement{"key2", selection.In, []string{"value2"}},
+				Requirement{key: "key", operator: selection.In, strValues: []string{"value", "value1"}},
+				Requirement{key: "key2", operator: selection.In, strValues: []string{"value2"}},
 			},
 			field:         "key2",
 			expectedFound: true,
@@ -658,21 +729,21 @@ func TestRequiresExactMatch(t *testing.T) {
 		},
 		{
 			name:          "keyEqualOperatorExactMatch",
-			sel:           internalSelector{Requirement{"key", selection.Equals, []string{"value"}}},
+			sel:           internalSelector{Requirement{key: "key", operator: selection.Equals, strValues: []string{"value"}}},
 			field:         "key",
 			expectedFound: true,
 			expectedValue: "value",
 		},
 		{
 			name:          "keyDoubleEqualOperatorExactMatch",
-			sel:           internalSelector{Requirement{"key", selection.DoubleEquals, []string{"value"}}},
+			sel:           internalSelector{Requirement{key: "key", operator: selection.DoubleEquals, strValues: []string{"value"}}},
 			field:         "key",
 			expectedFound: true,
 			expectedValue: "value",
 		},
 		{
 			name:          "keyNotEqualOperatorExactMatch",
-			sel:           internalSelector{Requirement{"key", selection.NotEquals, []string{"value"}}},
+			sel:           internalSelector{Requirement{key: "key", operator: selection.NotEquals, strValues: []string{"value"}}},
 			field:         "key",
 			expectedFound: false,
 			expectedValue: "",
@@ -680,8 +751,8 @@ func TestRequiresExactMatch(t *testing.T) {
 		{
 			name: "keyEqualOperatorExactMatchFirst",
 			sel: internalSelector{
-				Requirement{"key", selection.In, []string{"value"}},
-				Requirement{"key2", selection.In, []string{"value2"}},
+				Requirement{key: "key", operator: selection.In, strValues: []string{"value"}},
+				Requirement{key: "key2", operator: selection.In, strValues: []string{"value2"}},
 			},
 			field:         "key",
 			expectedFound: true,
@@ -997,6 +1068,21 @@ func TestSelectorSql(t *testing.T) {
 		selector: "user_name!~tom",
 		field:    "`user_name` not like ?",
 		args:     []interface{}{"%tom%"},
+	}, {
+		name:     "gte and lte",
+		selector: "created >= 2023-01-01, created <= 2023-12-31",
+		field:    "`created` >= ? and `created` <= ?",
+		args:     []interface{}{"2023-01-01", "2023-12-31"},
+	}, {
+		name:     "between",
+		selector: "age between (10, 20)",
+		field:    "`age` between ? and ?",
+		args:     []interface{}{"10", "20"},
+	}, {
+		name:     "or",
+		selector: "(status in (a,b) or owner=me),created>=1",
+		field:    "(`status` in (?,?) or `owner` = ?) and `created` >= ?",
+		args:     []interface{}{"a", "b", "me", "1"},
 	}}
 	for _, c := range cases {
 		t.Run(c.name, func(t *testing.T) {
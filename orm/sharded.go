@@ -0,0 +1,433 @@
+package orm
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yubo/golib/consistent"
+)
+
+var _ Store = &ShardedDB{}
+
+// ShardedDB routes the calls to the shards by the consistent hash of the shard key,
+// the shard key is from WithShardKey(ctx) or the `sql:"shard_key"` field of the sample.
+// List without the shard key is sent to all of the shards, and the rows are merged.
+type ShardedDB struct {
+	shards map[string]DB
+	ring   *consistent.Consistent
+}
+
+// NewShardedDB returns the ShardedDB of the shards, the key of the map is the name of the shard,
+// it should not be changed once the data is written
+func NewShardedDB(shards map[string]DB) (*ShardedDB, error) {
+	if len(shards) == 0 {
+		return nil, fmt.Errorf("sharded db: the shards are empty")
+	}
+
+	ring := consistent.New()
+	for name := range shards {
+		ring.Add(name)
+	}
+
+	return &ShardedDB{shards: shards, ring: ring}, nil
+}
+
+// Shards returns the shards, the key is the name of the shard
+func (p *ShardedDB) Shards() map[string]DB {
+	return p.shards
+}
+
+// ShardOf returns the shard of the key
+func (p *ShardedDB) ShardOf(key string) (DB, error) {
+	name, err := p.ring.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	return p.shards[name], nil
+}
+
+// Shard returns the shard of the ctx or the sample
+func (p *ShardedDB) Shard(ctx context.Context, sample interface{}) (DB, error) {
+	key, ok := p.shardKey(ctx, sample)
+	if !ok {
+		return nil, fmt.Errorf("sharded db: the shard key is not set for %T", sample)
+	}
+	return p.ShardOf(key)
+}
+
+// shardKey returns the shard key from the ctx, or the shard_key field of the sample
+func (p *ShardedDB) shardKey(ctx context.Context, sample interface{}) (string, bool) {
+	if key, ok := ShardKeyFrom(ctx); ok {
+		return key, true
+	}
+
+	rv := reflect.Indirect(reflect.ValueOf(sample))
+	if rv.Kind() != reflect.Struct {
+		return "", false
+	}
+
+	for _, db := range p.shards {
+		for _, f := range cachedTypeFields(rv.Type(), db).Fields {
+			if !f.ShardKey {
+				continue
+			}
+			fv, err := getSubv(rv, f.Index, false)
+			if err != nil || IsNil(fv) || reflect.Indirect(fv).IsZero() {
+				return "", false
+			}
+			return fmt.Sprint(reflect.Indirect(fv).Interface()), true
+		}
+		break
+	}
+
+	return "", false
+}
+
+func (p *ShardedDB) Close() error {
+	var errs []string
+	for name, db := range p.shards {
+		if err := db.Close(); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %s", name, err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("sharded db: close %s", strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+// AutoMigrate migrates the table on all of the shards
+func (p *ShardedDB) AutoMigrate(ctx context.Context, sample interface{}, opts ...QueryOption) error {
+	return p.each(func(name string, db DB) error {
+		return db.AutoMigrate(ctx, sample, opts...)
+	})
+}
+
+// each runs fn on all of the shards concurrently, the errors of the shards are joined
+func (p *ShardedDB) each(fn func(name string, db DB) error) error {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var errs []string
+
+	for name, db := range p.shards {
+		wg.Add(1)
+		go func(name string, db DB) {
+			defer wg.Done()
+			if err := fn(name, db); err != nil {
+				mu.Lock()
+				errs = append(errs, fmt.Sprintf("%s: %s", name, err))
+				mu.Unlock()
+			}
+		}(name, db)
+	}
+	wg.Wait()
+
+	if len(errs) > 0 {
+		sort.Strings(errs)
+		return fmt.Errorf("sharded db: %s", strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+// Exec runs the query on the shard of WithShardKey(ctx)
+func (p *ShardedDB) Exec(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	db, err := p.Shard(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	return db.Exec(ctx, query, args...)
+}
+
+// Query runs the query on the shard of WithShardKey(ctx)
+func (p *ShardedDB) Query(ctx context.Context, query string, args ...interface{}) *Rows {
+	db, err := p.Shard(ctx, nil)
+	if err != nil {
+		return ErrRows(err)
+	}
+	return db.Query(ctx, query, args...)
+}
+
+func (p *ShardedDB) Insert(ctx context.Context, sample interface{}, opts ...QueryOption) error {
+	db, err := p.Shard(ctx, sample)
+	if err != nil {
+		return err
+	}
+	return db.Insert(ctx, sample, opts...)
+}
+
+func (p *ShardedDB) InsertLastId(ctx context.Context, sample interface{}, opts ...QueryOption) (int64, error) {
+	db, err := p.Shard(ctx, sample)
+	if err != nil {
+		return 0, err
+	}
+	return db.InsertLastId(ctx, sample, opts...)
+}
+
+// InsertBatch groups the samples by the shard, and inserts them into the shards one by one
+func (p *ShardedDB) InsertBatch(ctx context.Context, samples interface{}, opts ...QueryOption) error {
+	rv := reflect.Indirect(reflect.ValueOf(samples))
+	if rv.Kind() != reflect.Slice {
+		return fmt.Errorf("sharded db: InsertBatch needs a slice, got %T", samples)
+	}
+
+	if !hasTable(opts) {
+		opts = append([]QueryOption{WithTable(typeOfArray(samples))}, opts...)
+	}
+
+	var names []string
+	groups := map[string]reflect.Value{}
+	for i := 0; i < rv.Len(); i++ {
+		key, ok := p.shardKey(ctx, rv.Index(i).Interface())
+		if !ok {
+			return fmt.Errorf("sharded db: the shard key is not set for the sample %d", i)
+		}
+		name, err := p.ring.Get(key)
+		if err != nil {
+			return err
+		}
+
+		group, ok := groups[name]
+		if !ok {
+			group = reflect.MakeSlice(rv.Type(), 0, 0)
+			names = append(names, name)
+		}
+		groups[name] = reflect.Append(group, rv.Index(i))
+	}
+
+	for _, name := range names {
+		if err := p.shards[name].InsertBatch(ctx, groups[name].Interface(), opts...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (p *ShardedDB) Get(ctx context.Context, into interface{}, opts ...QueryOption) error {
+	db, err := p.Shard(ctx, into)
+	if err != nil {
+		return err
+	}
+	return db.Get(ctx, into, opts...)
+}
+
+func (p *ShardedDB) Update(ctx context.Context, sample interface{}, opts ...QueryOption) error {
+	db, err := p.Shard(ctx, sample)
+	if err != nil {
+		return err
+	}
+	return db.Update(ctx, sample, opts...)
+}
+
+func (p *ShardedDB) Delete(ctx context.Context, sample interface{}, opts ...QueryOption) error {
+	db, err := p.Shard(ctx, sample)
+	if err != nil {
+		return err
+	}
+	return db.Delete(ctx, sample, opts...)
+}
+
+// List runs on the shard of WithShardKey(ctx), or all of the shards if the shard key is not set.
+// The rows of the shards are merged by WithOrderby, and then WithLimit is applied,
+// the totals of the shards are summed for WithTotal.
+func (p *ShardedDB) List(ctx context.Context, into interface{}, opts ...QueryOption) error {
+	if key, ok := ShardKeyFrom(ctx); ok {
+		db, err := p.ShardOf(key)
+		if err != nil {
+			return err
+		}
+		return db.List(ctx, into, opts...)
+	}
+
+	o, err := NewOptions(opts...)
+	if err != nil {
+		return err
+	}
+	if o.cursor != "" || o.next != nil {
+		return fmt.Errorf("sharded db: the cursor pagination requires the shard key")
+	}
+
+	rv, err := rowsInputValue(into)
+	if err != nil {
+		return err
+	}
+
+	var orders []orderCol
+	if len(o.orderby) > 0 {
+		if orders, err = parseOrderby(o.orderby); err != nil {
+			return err
+		}
+	}
+
+	// each shard returns the first offset+limit rows, the offset is applied after merged
+	shardOpts := append([]QueryOption{}, opts...)
+	if o.limit > 0 {
+		shardOpts = append(shardOpts, WithLimit(0, o.offset+o.limit))
+	}
+
+	var mu sync.Mutex
+	var total int
+	results := map[string]reflect.Value{}
+	err = p.each(func(name string, db DB) error {
+		var n int
+		rows := reflect.New(rv.Type())
+		// copy the options, the shards are listed concurrently
+		if err := db.List(ctx, rows.Interface(), append(shardOpts[:len(shardOpts):len(shardOpts)], WithTotal(&n))...); err != nil {
+			return err
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		total += n
+		results[name] = rows.Elem()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// in the order of the shard names if the order by is not set
+	names := p.ring.Members()
+	sort.Strings(names)
+	merged := reflect.MakeSlice(rv.Type(), 0, 0)
+	for _, name := range names {
+		merged = reflect.AppendSlice(merged, results[name])
+	}
+
+	if len(orders) > 0 {
+		less, err := rowsLess(merged.Type().Elem(), orders, p.anyShard())
+		if err != nil {
+			return err
+		}
+		sort.SliceStable(merged.Interface(), func(i, j int) bool {
+			return less(merged.Index(i), merged.Index(j))
+		})
+	}
+
+	if o.limit > 0 {
+		start, end := o.offset, o.offset+o.limit
+		if start > merged.Len() {
+			start = merged.Len()
+		}
+		if end > merged.Len() {
+			end = merged.Len()
+		}
+		merged = merged.Slice(start, end)
+	}
+
+	rv.Set(reflect.AppendSlice(rv, merged))
+
+	if o.total != nil {
+		*o.total = total
+	}
+
+	return nil
+}
+
+func (p *ShardedDB) anyShard() DB {
+	for _, db := range p.shards {
+		return db
+	}
+	return nil
+}
+
+func hasTable(opts []QueryOption) bool {
+	o, err := NewOptions(opts...)
+	return err == nil && o.table != ""
+}
+
+// rowsLess returns the less func of the rows by the order by cols
+func rowsLess(rt reflect.Type, orders []orderCol, db Driver) (func(a, b reflect.Value) bool, error) {
+	elem := rt
+	if elem.Kind() == reflect.Ptr {
+		elem = elem.Elem()
+	}
+	if elem.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("sharded db: unsupported type %s", rt)
+	}
+
+	tf := cachedTypeFields(elem, db)
+	fields := make([]*StructField, len(orders))
+	for i, order := range orders {
+		idx, ok := tf.nameIndex[order.name]
+		if !ok {
+			return nil, fmt.Errorf("sharded db: order by field %s not found in %s", order.name, elem)
+		}
+		fields[i] = tf.Fields[idx]
+	}
+
+	return func(a, b reflect.Value) bool {
+		a, b = reflect.Indirect(a), reflect.Indirect(b)
+		for i, order := range orders {
+			av, _ := getSubv(a, fields[i].Index, false)
+			bv, _ := getSubv(b, fields[i].Index, false)
+			c := compareValue(av, bv)
+			if c == 0 {
+				continue
+			}
+			if order.desc {
+				return c > 0
+			}
+			return c < 0
+		}
+		return false
+	}, nil
+}
+
+// compareValue compares the values of the same type, nil is the smallest
+func compareValue(a, b reflect.Value) int {
+	aNil, bNil := !a.IsValid() || IsNil(a), !b.IsValid() || IsNil(b)
+	switch {
+	case aNil && bNil:
+		return 0
+	case aNil:
+		return -1
+	case bNil:
+		return 1
+	}
+
+	a, b = reflect.Indirect(a), reflect.Indirect(b)
+
+	if at, ok := a.Interface().(time.Time); ok {
+		bt := b.Interface().(time.Time)
+		return at.Compare(bt)
+	}
+
+	switch a.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return compareOrdered(a.Int(), b.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return compareOrdered(a.Uint(), b.Uint())
+	case reflect.Float32, reflect.Float64:
+		return compareOrdered(a.Float(), b.Float())
+	case reflect.String:
+		return strings.Compare(a.String(), b.String())
+	case reflect.Bool:
+		return compareOrdered(boolInt(a.Bool()), boolInt(b.Bool()))
+	}
+
+	return strings.Compare(fmt.Sprint(a.Interface()), fmt.Sprint(b.Interface()))
+}
+
+func compareOrdered[T int64 | uint64 | float64 | int](a, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,121 @@
+package orm
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompareValue(t *testing.T) {
+	now := time.Now()
+	one := 1
+	cases := []struct {
+		a, b interface{}
+		want int
+	}{
+		{1, 2, -1},
+		{uint(2), uint(1), 1},
+		{1.5, 1.5, 0},
+		{"a", "b", -1},
+		{now, now.Add(time.Second), -1},
+		{&one, (*int)(nil), 1},
+		{(*int)(nil), (*int)(nil), 0},
+		{true, false, 1},
+	}
+
+	for i, c := range cases {
+		assert.Equal(t, c.want, compareValue(reflect.ValueOf(c.a), reflect.ValueOf(c.b)), fmt.Sprintf("case-%d", i))
+	}
+}
+
+func TestShardedDB(t *testing.T) {
+	if !testAvailable || testDriver != "sqlite3" {
+		t.Skipf("sqlite3 is required")
+	}
+
+	type test struct {
+		ID     int    `sql:"primary_key"`
+		Tenant string `sql:"shard_key,size=32"`
+		Age    int
+	}
+
+	shards := map[string]DB{}
+	for i := 0; i < 3; i++ {
+		db, err := Open(testDriver, fmt.Sprintf("file:shard%d?cache=shared&mode=memory", i))
+		require.NoError(t, err)
+		shards[fmt.Sprintf("shard-%d", i)] = db
+	}
+
+	db, err := NewShardedDB(shards)
+	require.NoError(t, err)
+	defer db.Close()
+
+	ctx := context.Background()
+	require.NoError(t, db.AutoMigrate(ctx, &test{}))
+
+	var rows []test
+	for i := 0; i < 20; i++ {
+		rows = append(rows, test{ID: i, Tenant: fmt.Sprintf("tenant-%d", i%10), Age: 20 - i})
+	}
+	require.NoError(t, db.InsertBatch(ctx, rows))
+
+	// the rows are stored in the shard of the tenant
+	used := map[string]bool{}
+	for name, shard := range shards {
+		var got []test
+		require.NoError(t, shard.List(ctx, &got))
+		for _, row := range got {
+			expect, err := db.ShardOf(row.Tenant)
+			require.NoError(t, err)
+			assert.True(t, expect == shard, "%s of %s", name, row.Tenant)
+			used[name] = true
+		}
+	}
+	assert.True(t, len(used) > 1, "the rows should be sharded")
+
+	// scatter-gather
+	var got []test
+	var total int
+	err = db.List(ctx, &got, WithOrderby("age"), WithLimit(2, 3), WithTotal(&total))
+	require.NoError(t, err)
+	assert.Equal(t, 20, total)
+	assert.Equal(t, []test{{17, "tenant-7", 3}, {16, "tenant-6", 4}, {15, "tenant-5", 5}}, got)
+
+	got = nil
+	err = db.List(ctx, &got, WithOrderby("tenant desc", "id"), WithLimit(0, 3))
+	require.NoError(t, err)
+	assert.Equal(t, []test{{9, "tenant-9", 11}, {19, "tenant-9", 1}, {8, "tenant-8", 12}}, got)
+
+	// the shard key of ctx
+	got = nil
+	err = db.List(WithShardKey(ctx, "tenant-3"), &got, WithSelector("tenant=tenant-3"))
+	require.NoError(t, err)
+	ids := []int{}
+	for _, v := range got {
+		ids = append(ids, v.ID)
+	}
+	sort.Ints(ids)
+	assert.Equal(t, []int{3, 13}, ids)
+
+	var row test
+	require.NoError(t, db.Get(WithShardKey(ctx, "tenant-3"), &row, WithSelector("id=13")))
+	assert.Equal(t, test{13, "tenant-3", 7}, row)
+
+	err = db.Get(ctx, &test{}, WithSelector("id=13"))
+	assert.Error(t, err, "the shard key is required")
+
+	// the shard key of the sample
+	require.NoError(t, db.Update(ctx, &test{ID: 13, Tenant: "tenant-3", Age: 30}, WithSelector("id=13")))
+	require.NoError(t, db.Get(ctx, &row, WithSelector("id=13")))
+	assert.Equal(t, 30, row.Age)
+
+	require.NoError(t, db.Delete(ctx, &test{Tenant: "tenant-3"}, WithSelector("id=13")))
+	err = db.Get(WithShardKey(ctx, "tenant-3"), &row, WithSelector("id=13"))
+	assert.Error(t, err)
+}
@@ -30,13 +30,26 @@ var (
 		"comment",
 		"auto_createtime",
 		"auto_updatetime",
+		"soft_delete",
+		"version",
+		"has_one",
+		"has_many",
+		"belongs_to",
+		"foreign_key",
+		"references",
+		"shard_key",
 		"type",
+		"values",
+		"encrypt",
 	}
 )
 
 type StructFields struct {
 	Fields    []*StructField
 	nameIndex map[string]int
+
+	// Relations the has_one/has_many/belongs_to fields, not the columns
+	Relations []*StructField
 }
 
 func (p StructFields) String() (ret string) {
@@ -56,12 +69,15 @@ type StructField struct {
 	Where     bool
 	Skip      bool
 	Inline    bool
+	ShardKey  bool // the key of ShardedDB
 	//key       string // use name instead of key
 
 	// from tag
 	DataType              DataType
 	AutoCreatetime        TimeType // auto_createtime
 	AutoUpdatetime        TimeType // auto_updatetime
+	SoftDelete            TimeType // soft_delete
+	Version               bool     // version
 	PrimaryKey            bool
 	AutoIncrement         bool
 	AutoIncrementNum      int64
@@ -74,6 +90,15 @@ type StructField struct {
 	NotNull               *bool
 	Unique                *bool
 	Comment               *string
+	EnumValues            []string   // type=enum,values=a|b|c
+	Codec                 *TypeCodec // type=json or RegisterType
+	Encrypt               bool       // encrypt, the value is encrypted with the keyring
+	Deterministic         bool       // encrypt=deterministic, can be used in the equality selector
+
+	// relation
+	Relation   RelationType // has_one, has_many, belongs_to
+	ForeignKey string       // foreign_key
+	References string       // references
 
 	// index
 	IndexComment string
@@ -121,6 +146,7 @@ func parseTypeFields(t reflect.Type, driver Driver) StructFields {
 
 	// Fields found.
 	var fields []*StructField
+	var relations []*StructField
 
 	// Buffer to run HTMLEscape on field names.
 	// var nameEscBuf bytes.Buffer
@@ -171,6 +197,14 @@ func parseTypeFields(t reflect.Type, driver Driver) StructFields {
 					ft = ft.Elem()
 				}
 
+				// the relations are loaded by WithPreload
+				if field.Relation != "" {
+					field.Index = index
+					field.Type = sf.Type
+					relations = append(relations, field)
+					continue
+				}
+
 				// Record found field and index sequence.
 				// if opt.name != "" || !sf.Anonymous || ft.Kind() != reflect.Struct {
 				if field.Name != "" && !sf.Anonymous {
@@ -207,7 +241,7 @@ func parseTypeFields(t reflect.Type, driver Driver) StructFields {
 		}
 		nameIndex[field.Name] = i
 	}
-	return StructFields{fields, nameIndex}
+	return StructFields{fields, nameIndex, relations}
 }
 
 func getSubv(rv reflect.Value, index []int, allowCreate bool) (reflect.Value, error) {
@@ -253,6 +287,9 @@ func parseStructField(sf reflect.StructField) (*StructField, error) {
 	if set.Has("inline") {
 		opt.Inline = true
 	}
+	if set.Has("shard_key") {
+		opt.ShardKey = true
+	}
 	opt.Set = set
 
 	opt.FieldName = sf.Name
@@ -262,6 +299,18 @@ func parseStructField(sf reflect.StructField) (*StructField, error) {
 	}
 	opt.Name = strings.ToLower(opt.Name)
 
+	for _, rel := range []RelationType{HasOne, HasMany, BelongsTo} {
+		if set.Has(string(rel)) {
+			opt.Relation = rel
+			opt.ForeignKey = set.Get("foreign_key")
+			opt.References = set.Get("references")
+			if opt.ForeignKey == "" {
+				return nil, fmt.Errorf("%s field %s requires the foreign_key", rel, sf.Name)
+			}
+			return opt, nil
+		}
+	}
+
 	if set.Has("index") {
 		opt.IndexKey = true
 		opt.IndexName = set.Get("index")
@@ -401,16 +450,86 @@ func parseStructField(sf reflect.StructField) (*StructField, error) {
 		}
 	}
 
+	if set.Has("soft_delete") {
+		v := set.Get("soft_delete")
+		switch {
+		case opt.DataType == Time:
+			opt.SoftDelete = UnixTime
+		case opt.DataType != Int && opt.DataType != Uint:
+			return nil, fmt.Errorf("soft_delete field %s should be a time or an integer", sf.Name)
+		case strings.ToLower(v) == "nano":
+			opt.SoftDelete = UnixNanosecond
+		case strings.ToLower(v) == "milli":
+			opt.SoftDelete = UnixMillisecond
+		default:
+			opt.SoftDelete = UnixSecond
+		}
+
+		// 0 means the row is not deleted
+		if opt.DataType != Time && !opt.HasDefaultValue {
+			opt.HasDefaultValue = true
+			opt.DefaultValue = "0"
+			opt.DefaultValueInterface = int64(0)
+		}
+	}
+
+	if set.Has("version") {
+		if opt.DataType != Int && opt.DataType != Uint {
+			return nil, fmt.Errorf("version field %s should be an integer", sf.Name)
+		}
+		opt.Version = true
+	}
+
 	if set.Has("type") {
 		val := set.Get("type")
 		switch DataType(strings.ToLower(val)) {
-		case Bool, Int, Uint, Float, String, Time, Bytes:
+		case Bool, Int, Uint, Float, String, Time, Bytes, JSON, Enum:
 			opt.DataType = DataType(strings.ToLower(val))
 		default:
 			opt.DataType = DataType(val)
 		}
 	}
 
+	switch {
+	case opt.DataType == JSON:
+		opt.Codec = jsonCodec
+	case opt.DataType == Enum:
+		if set.Get("values") == "" {
+			return nil, fmt.Errorf("enum field %s requires the values, e.g. values=a|b|c", sf.Name)
+		}
+		opt.EnumValues = strings.Split(set.Get("values"), "|")
+	default:
+		if codec := typeCodecOf(t); codec != nil {
+			opt.Codec = codec
+			if !set.Has("type") && codec.DataType != "" {
+				opt.DataType = codec.DataType
+			}
+		}
+	}
+
+	if set.Has("encrypt") {
+		switch v := set.Get("encrypt"); strings.ToLower(v) {
+		case "":
+		case "deterministic":
+			opt.Deterministic = true
+		default:
+			return nil, fmt.Errorf("invalid encrypt mode %q of field %s", v, sf.Name)
+		}
+		opt.Encrypt = true
+
+		// the column stores the ciphertext
+		if opt.DataType == JSON || !set.Has("type") {
+			opt.DataType = String
+		}
+
+		// the size is of the plaintext, the column is text without the size
+		if opt.Size != nil {
+			opt.Size = util.Int64(ciphertextSize(*opt.Size))
+		} else {
+			opt.Size = util.Int64(65535)
+		}
+	}
+
 	if opt.Size == nil {
 		switch t.Kind() {
 		case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint64, reflect.Float64:
@@ -0,0 +1,139 @@
+package orm
+
+import (
+	"context"
+	goerrors "errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// the messages of the deadlock and serialization errors,
+// the driver errors may be wrapped as string by Exec
+var retryableTxErrors = []string{
+	"Error 1213",                     // mysql, ER_LOCK_DEADLOCK
+	"Error 1205",                     // mysql, ER_LOCK_WAIT_TIMEOUT
+	"pq: deadlock detected",          // postgres, 40P01
+	"pq: could not serialize access", // postgres, 40001
+	"database is locked",             // sqlite, SQLITE_BUSY
+	"database table is locked",       // sqlite, SQLITE_LOCKED
+}
+
+// IsRetryableTxError returns true if the transaction is aborted by
+// a deadlock or a serialization failure, it's the default of WithTxRetryable
+func IsRetryableTxError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var e interface{ SQLState() string }
+	if goerrors.As(err, &e) {
+		switch e.SQLState() {
+		case "40001", "40P01":
+			return true
+		}
+	}
+
+	msg := err.Error()
+	for _, s := range retryableTxErrors {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Transaction runs fn in a transaction, the Tx is set to the ctx of fn by WithDB,
+// it's committed if fn returns nil, and rolled back if fn returns an error or panics,
+// the retryable error is retried with the backoff of WithTxRetry.
+// If there is a Tx in the ctx already, fn runs in a savepoint of it.
+func (p *ormDB) Transaction(ctx context.Context, fn func(ctx context.Context) error, opts ...TxOption) error {
+	if i, ok := DBFrom(ctx); ok {
+		if tx, ok := i.(Tx); ok {
+			return savepoint(ctx, tx, fn)
+		}
+	}
+
+	o := newTxOptions(opts...)
+	backoff := o.backoff
+	for attempt := 1; ; attempt++ {
+		err := p.transaction(ctx, o, fn)
+		if err == nil || attempt >= o.backoff.Steps || !o.retryable(err) {
+			return err
+		}
+
+		d := backoff.Step()
+		klog.V(3).InfoS("retry transaction", "attempt", attempt, "after", d, "err", err)
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(d):
+		}
+	}
+}
+
+func (p *ormDB) transaction(ctx context.Context, o *txOptions, fn func(ctx context.Context) error) (err error) {
+	tx, err := p.BeginTx(ctx, o.sqlOptions)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+			panic(r)
+		}
+	}()
+
+	if err := fn(WithDB(ctx, tx)); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Transaction runs fn in a savepoint of the Tx, see DB.Transaction
+func (p *ormTx) Transaction(ctx context.Context, fn func(ctx context.Context) error, opts ...TxOption) error {
+	return savepoint(ctx, p, fn)
+}
+
+// savepoint runs fn in a savepoint, only the savepoint is rolled back on error
+func savepoint(ctx context.Context, tx Tx, fn func(ctx context.Context) error) error {
+	depth := txDepthFrom(ctx) + 1
+	name := fmt.Sprintf("sp_%d", depth)
+
+	if _, err := tx.Exec(ctx, "SAVEPOINT "+name); err != nil {
+		return err
+	}
+
+	// the pending changes after the savepoint are dropped with it
+	var pending *pendingChanges
+	if t, ok := tx.(*ormTx); ok {
+		pending = t.pending
+	}
+	mark := pending.mark()
+
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Exec(ctx, "ROLLBACK TO SAVEPOINT "+name)
+			pending.truncate(mark)
+			panic(r)
+		}
+	}()
+
+	if err := fn(withTxDepth(WithDB(ctx, tx), depth)); err != nil {
+		if _, err := tx.Exec(ctx, "ROLLBACK TO SAVEPOINT "+name); err != nil {
+			klog.ErrorS(err, "rollback to savepoint", "name", name)
+		}
+		pending.truncate(mark)
+		return err
+	}
+
+	_, err := tx.Exec(ctx, "RELEASE SAVEPOINT "+name)
+	return err
+}
@@ -0,0 +1,130 @@
+package orm
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yubo/golib/util/wait"
+)
+
+type testSQLStateError string
+
+func (p testSQLStateError) Error() string    { return "sql state " + string(p) }
+func (p testSQLStateError) SQLState() string { return string(p) }
+
+func TestIsRetryableTxError(t *testing.T) {
+	cases := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{fmt.Errorf("Exec() err: Error 1213: Deadlock found when trying to get lock"), true},
+		{fmt.Errorf("Error 1205 (HY000): Lock wait timeout exceeded"), true},
+		{fmt.Errorf("pq: could not serialize access due to concurrent update"), true},
+		{fmt.Errorf("database is locked"), true},
+		{fmt.Errorf("wrapped: %w", testSQLStateError("40P01")), true},
+		{testSQLStateError("23505"), false},
+		{fmt.Errorf("Error 1062: Duplicate entry"), false},
+	}
+
+	for i, c := range cases {
+		assert.Equal(t, c.want, IsRetryableTxError(c.err), fmt.Sprintf("case-%d", i))
+	}
+}
+
+func TestTransaction(t *testing.T) {
+	runTests(t, func(db DB, ctx context.Context) {
+		_, err := db.Exec(ctx, "CREATE TABLE test (value int)")
+		require.NoError(t, err)
+
+		values := func() (ret []int) {
+			require.NoError(t, db.Query(ctx, "SELECT value FROM test ORDER BY value").Rows(&ret))
+			return
+		}
+		insert := func(ctx context.Context, v int) error {
+			_, err := db.Exec(ctx, "INSERT INTO test VALUES (?)", v)
+			return err
+		}
+
+		// commit
+		err = db.Transaction(ctx, func(ctx context.Context) error {
+			return insert(ctx, 1)
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []int{1}, values())
+
+		// rollback on error
+		err = db.Transaction(ctx, func(ctx context.Context) error {
+			require.NoError(t, insert(ctx, 2))
+			return fmt.Errorf("failed")
+		})
+		assert.EqualError(t, err, "failed")
+		assert.Equal(t, []int{1}, values())
+
+		// rollback on panic
+		assert.Panics(t, func() {
+			db.Transaction(ctx, func(ctx context.Context) error {
+				require.NoError(t, insert(ctx, 3))
+				panic("oops")
+			})
+		})
+		assert.Equal(t, []int{1}, values())
+
+		// the nested transaction rolls back to the savepoint only
+		err = db.Transaction(ctx, func(ctx context.Context) error {
+			if err := insert(ctx, 4); err != nil {
+				return err
+			}
+
+			err := db.Transaction(ctx, func(ctx context.Context) error {
+				if err := insert(ctx, 5); err != nil {
+					return err
+				}
+				return db.Transaction(ctx, func(ctx context.Context) error {
+					return insert(ctx, 6)
+				})
+			})
+			if err != nil {
+				return err
+			}
+
+			err = db.Transaction(ctx, func(ctx context.Context) error {
+				require.NoError(t, insert(ctx, 7))
+				return fmt.Errorf("failed")
+			})
+			assert.EqualError(t, err, "failed")
+
+			return nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []int{1, 4, 5, 6}, values())
+
+		// retry
+		attempts := 0
+		err = db.Transaction(ctx, func(ctx context.Context) error {
+			attempts++
+			if err := insert(ctx, 10+attempts); err != nil {
+				return err
+			}
+			if attempts < 3 {
+				return testSQLStateError("40001")
+			}
+			return nil
+		}, WithTxRetry(wait.Backoff{Steps: 5}))
+		require.NoError(t, err)
+		assert.Equal(t, 3, attempts)
+		assert.Equal(t, []int{1, 4, 5, 6, 13}, values())
+
+		// the max attempts
+		attempts = 0
+		err = db.Transaction(ctx, func(ctx context.Context) error {
+			attempts++
+			return testSQLStateError("40001")
+		}, WithTxRetry(wait.Backoff{Steps: 2}))
+		assert.Error(t, err)
+		assert.Equal(t, 2, attempts)
+	})
+}
@@ -3,6 +3,8 @@ package orm
 import (
 	"context"
 	"database/sql"
+
+	"github.com/yubo/golib/watch"
 )
 
 type DataType string
@@ -17,10 +19,20 @@ const (
 	String DataType = "string"
 	Time   DataType = "time"
 	Bytes  DataType = "bytes"
+	JSON   DataType = "json" // marshalled with encoding/json
+	Enum   DataType = "enum" // one of the values, e.g. `sql:"type=enum,values=a|b|c"`
 )
 
 type TimeType int64
 
+type RelationType string
+
+const (
+	HasOne    RelationType = "has_one"
+	HasMany   RelationType = "has_many"
+	BelongsTo RelationType = "belongs_to"
+)
+
 const (
 	UnixTime        TimeType = 1
 	UnixSecond      TimeType = 2
@@ -35,6 +47,12 @@ type DB interface {
 	BeginTx(ctx context.Context, ops *sql.TxOptions) (Tx, error)
 	ExecRows(bytes []byte) error // like mysql < a.sql
 
+	// Transaction runs fn in a transaction or a savepoint of the Tx in ctx
+	Transaction(ctx context.Context, fn func(ctx context.Context) error, opts ...TxOption) error
+
+	// Watch returns the events of the Insert/Update/Delete of the table
+	Watch(ctx context.Context, table string) (watch.Interface, error)
+
 	Interface
 }
 
@@ -48,6 +66,9 @@ type Tx interface {
 	Rollback() error
 	Commit() error
 
+	// Transaction runs fn in a savepoint
+	Transaction(ctx context.Context, fn func(ctx context.Context) error, opts ...TxOption) error
+
 	Interface
 }
 
@@ -71,6 +92,7 @@ type Execer interface {
 type Store interface {
 	Insert(ctx context.Context, sample interface{}, opts ...QueryOption) error
 	InsertLastId(ctx context.Context, sample interface{}, opts ...QueryOption) (int64, error)
+	InsertBatch(ctx context.Context, samples interface{}, opts ...QueryOption) error
 	Get(ctx context.Context, into interface{}, opts ...QueryOption) error
 	List(ctx context.Context, into interface{}, opts ...QueryOption) error
 	Update(ctx context.Context, sample interface{}, opts ...QueryOption) error
@@ -82,9 +104,15 @@ type Driver interface {
 	// refer: https://gorm.io/docs/migration.html
 	AutoMigrate(ctx context.Context, sample interface{}, opts ...QueryOption) error
 
+	// PlanMigrate reports the changes AutoMigrate would apply, without executing them
+	PlanMigrate(ctx context.Context, sample interface{}, opts ...QueryOption) (SchemaChanges, error)
+
 	//  parse datatype
 	ParseField(opts *StructField)
 
+	// Dialect used to generate the dml sql
+	Dialect() Dialect
+
 	// Database
 	CurrentDatabase(ctx context.Context) string
 	FullDataTypeOf(field *StructField) string
@@ -109,12 +137,22 @@ type Driver interface {
 	HasIndex(ctx context.Context, name string, o *queryOptions) bool
 }
 
+// NewNonDriver returns the Driver which does nothing,
+// used by the Interface implementations out of the package, e.g. orm/fake
+func NewNonDriver() Driver {
+	return &nonDriver{}
+}
+
 type nonDriver struct{}
 
 func (b nonDriver) AutoMigrate(ctx context.Context, sample interface{}, opts ...QueryOption) error {
 	return nil
 }
+func (b nonDriver) PlanMigrate(ctx context.Context, sample interface{}, opts ...QueryOption) (SchemaChanges, error) {
+	return nil, nil
+}
 func (b nonDriver) ParseField(opts *StructField)                                         {}
+func (b nonDriver) Dialect() Dialect                                                     { return DefaultDialect }
 func (b nonDriver) CurrentDatabase(ctx context.Context) string                           { return "" }
 func (b nonDriver) FullDataTypeOf(field *StructField) string                             { return "" }
 func (b nonDriver) CreateTable(ctx context.Context, o *queryOptions) error               { return nil }
@@ -103,46 +103,171 @@ type kv struct {
 	v interface{}
 }
 
+// whereIn is the value of the where field which matches any of the values, e.g. the ciphertexts of all the keys
+type whereIn []interface{}
+
 func GenInsertSql(table string, sample interface{}, db Driver) (string, []interface{}, error) {
+	query, args, _, err := genInsertSql(table, sample, db)
+	return query, args, err
+}
+
+// genInsertSql also returns the inserted columns
+func genInsertSql(table string, sample interface{}, db Driver) (string, []interface{}, []string, error) {
 	if sample == nil {
-		return "", nil, errSampleNil
+		return "", nil, nil, errSampleNil
 	}
 	if table == "" {
-		return "", nil, errTableEmpty
+		return "", nil, nil, errTableEmpty
 	}
 
 	values := []kv{}
+	d := dialectOf(db)
 
 	rv := reflect.Indirect(reflect.ValueOf(sample))
 
-	if err := genInsertSql(rv, &values, db); err != nil {
-		return "", nil, err
+	if err := genInsertValues(rv, &values, db); err != nil {
+		return "", nil, nil, err
 	}
 
 	if len(values) == 0 {
-		return "", nil, fmt.Errorf("INSERT INTO `%s` `VALUES` is empty", table)
+		return "", nil, nil, fmt.Errorf("INSERT INTO %s `VALUES` is empty", d.Quote(table))
 	}
 
 	buf := &bytes.Buffer{}
 	buf2 := &bytes.Buffer{}
 	args := []interface{}{}
+	cols := []string{}
 
-	buf.WriteString("INSERT INTO `" + table + "` (")
+	buf.WriteString("INSERT INTO " + d.Quote(table) + " (")
 
 	for i, v := range values {
 		if i != 0 {
 			buf.WriteString(", ")
 			buf2.WriteString(", ")
 		}
-		buf.WriteString("`" + v.k + "`")
+		buf.WriteString(d.Quote(v.k))
 		buf2.WriteString("?")
 		args = append(args, v.v)
+		cols = append(cols, v.k)
+	}
+
+	return buf.String() + ") VALUES (" + buf2.String() + ")", args, cols, nil
+}
+
+// genInsertBatchSql generate the multi-row insert statements,
+// the adjacent rows with the same non-nil fields are inserted by one statement,
+// so the nil fields get the column DEFAULT like Insert,
+// the rows of one statement are limited by maxPlaceholders
+func genInsertBatchSql(d Dialect, table string, samples interface{}, db Driver, maxPlaceholders int) ([]string, [][]interface{}, [][]string, error) {
+	if samples == nil {
+		return nil, nil, nil, errSampleNil
+	}
+	if table == "" {
+		return nil, nil, nil, errTableEmpty
+	}
+
+	rv := reflect.Indirect(reflect.ValueOf(samples))
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, nil, nil, fmt.Errorf("needs a slice of struct, got %s", rv.Type())
+	}
+	if rv.Len() == 0 {
+		return nil, nil, nil, fmt.Errorf("INSERT INTO %s `VALUES` is empty", d.Quote(table))
+	}
+
+	var queries []string
+	var args [][]interface{}
+	var colsList [][]string
+
+	var cols []string
+	var key string
+	var a []interface{}
+	var n int
+	flush := func() {
+		if n == 0 {
+			return
+		}
+
+		buf := &bytes.Buffer{}
+		buf.WriteString("INSERT INTO " + d.Quote(table) + " (")
+		for i, col := range cols {
+			if i != 0 {
+				buf.WriteString(", ")
+			}
+			buf.WriteString(d.Quote(col))
+		}
+		buf.WriteString(") VALUES ")
+
+		placeholder := "(?" + strings.Repeat(", ?", len(cols)-1) + ")"
+		for i := 0; i < n; i++ {
+			if i != 0 {
+				buf.WriteString(", ")
+			}
+			buf.WriteString(placeholder)
+		}
+
+		queries = append(queries, buf.String())
+		args = append(args, a)
+		colsList = append(colsList, cols)
+		cols, a, n = nil, nil, 0
 	}
 
-	return buf.String() + ") VALUES (" + buf2.String() + ")", args, nil
+	for i := 0; i < rv.Len(); i++ {
+		row := reflect.Indirect(rv.Index(i))
+		if !row.IsValid() {
+			return nil, nil, nil, fmt.Errorf("INSERT INTO %s row %d is nil", d.Quote(table), i)
+		}
+
+		values := []kv{}
+		if err := genInsertValues(row, &values, db); err != nil {
+			return nil, nil, nil, err
+		}
+		if len(values) == 0 {
+			return nil, nil, nil, fmt.Errorf("INSERT INTO %s row %d `VALUES` is empty", d.Quote(table), i)
+		}
+
+		rowCols := make([]string, len(values))
+		for j, v := range values {
+			rowCols[j] = v.k
+		}
+
+		rowKey := strings.Join(rowCols, ",")
+		if n > 0 && (rowKey != key || (n+1)*len(cols) > maxPlaceholders) {
+			flush()
+		}
+
+		cols, key = rowCols, rowKey
+		for _, v := range values {
+			a = append(a, v.v)
+		}
+		n++
+	}
+	flush()
+
+	return queries, args, colsList, nil
+}
+
+// conflictKeysOf returns the primary_key fields, or the first unique field
+func conflictKeysOf(fields StructFields) []string {
+	keys := []string{}
+	for _, f := range fields.Fields {
+		if f.PrimaryKey {
+			keys = append(keys, f.Name)
+		}
+	}
+	if len(keys) > 0 {
+		return keys
+	}
+
+	for _, f := range fields.Fields {
+		if util.BoolValue(f.Unique) {
+			return []string{f.Name}
+		}
+	}
+
+	return nil
 }
 
-func genInsertSql(rv reflect.Value, values *[]kv, db Driver) error {
+func genInsertValues(rv reflect.Value, values *[]kv, db Driver) error {
 	fields := cachedTypeFields(rv.Type(), db)
 	curTime := defaultClock.Now()
 
@@ -162,11 +287,11 @@ func genInsertSql(rv reflect.Value, values *[]kv, db Driver) error {
 		}
 
 		fv, err := getSubv(rv, f.Index, false)
-		if err != nil || IsNil(fv) {
+		if err != nil || IsNil(fv) || (f.SoftDelete == UnixTime && isZeroSoftDelete(f, fv)) {
 			continue
 		}
 
-		v, err := sqlInterface(fv)
+		v, err := f.sqlInterface(fv, keyringOf(db))
 		if err != nil {
 			return err
 		}
@@ -191,16 +316,24 @@ func NewCurTime(t TimeType, cur time.Time) interface{} {
 	}
 }
 
+// GenListSql generate the list sql with the DefaultDialect
 func GenListSql(table string, cols []string, selector Selector, orderby []string, offset, limit int) (string, string, []interface{}, error) {
+	query, countQuery, args, _, err := genListSql(DefaultDialect, table, cols, selector, orderby, offset, limit, nil)
+	return query, countQuery, args, err
+}
+
+// genListSql the offset and orderby will be ignored if the cursor is set,
+// the cursor predicate is not applied to the count sql
+func genListSql(d Dialect, table string, cols []string, selector Selector, orderby []string, offset, limit int, cursor *listCursor) (query, countQuery string, args, countArgs []interface{}, err error) {
 	if table == "" {
-		return "", "", nil, errTableEmpty
+		return "", "", nil, nil, errTableEmpty
 	}
 
 	// SELECT *
 	buf := bytes.NewBufferString("SELECT")
 	// SELECT count(*)
-	buf2 := bytes.NewBufferString("SELECT COUNT(*) FROM `" + table + "`")
-	args := []interface{}{}
+	buf2 := bytes.NewBufferString("SELECT COUNT(*) FROM " + d.Quote(table))
+	args = []interface{}{}
 
 	// cols
 	if len(cols) == 0 {
@@ -210,21 +343,41 @@ func GenListSql(table string, cols []string, selector Selector, orderby []string
 			if i != 0 {
 				buf.WriteString(",")
 			}
-			buf.WriteString(" `" + col + "`")
+			buf.WriteString(" " + d.Quote(col))
 		}
 	}
 
 	// table
-	buf.WriteString(" FROM `" + table + "`")
+	buf.WriteString(" FROM " + d.Quote(table))
 
 	// selector
+	where := ""
 	if selector != nil {
-		if q, a := selector.Sql(); q != "" {
-			buf.WriteString(" WHERE " + q)
+		if q, a := selector.DialectSql(d); q != "" {
+			where = q
 			buf2.WriteString(" WHERE " + q)
 			args = a
 		}
 	}
+	countArgs = args
+
+	// cursor
+	if cursor != nil {
+		if q, a := cursor.sql(d); q != "" {
+			if where != "" {
+				where = "(" + where + ") AND " + q
+			} else {
+				where = q
+			}
+			args = append(append([]interface{}{}, args...), a...)
+		}
+		orderby = cursor.orderby(d)
+		offset = 0
+	}
+
+	if where != "" {
+		buf.WriteString(" WHERE " + where)
+	}
 
 	// order
 	if len(orderby) > 0 {
@@ -233,13 +386,18 @@ func GenListSql(table string, cols []string, selector Selector, orderby []string
 
 	// limit
 	if limit > 0 {
-		fmt.Fprintf(buf, " LIMIT %d, %d", offset, limit)
+		buf.WriteString(d.Limit(offset, limit))
 	}
 
-	return buf.String(), buf2.String(), args, nil
+	return buf.String(), buf2.String(), args, countArgs, nil
 }
 
+// GenGetSql generate the get sql with the DefaultDialect
 func GenGetSql(table string, cols []string, selector Selector) (string, []interface{}, error) {
+	return genGetSql(DefaultDialect, table, cols, selector)
+}
+
+func genGetSql(d Dialect, table string, cols []string, selector Selector) (string, []interface{}, error) {
 	if table == "" {
 		return "", nil, errTableEmpty
 	}
@@ -247,7 +405,7 @@ func GenGetSql(table string, cols []string, selector Selector) (string, []interf
 		return "", nil, errSelectorNil
 	}
 
-	query, args := selector.Sql()
+	query, args := selector.DialectSql(d)
 	if query == "" {
 		return "", nil, errSelectorEmpty
 	}
@@ -263,17 +421,23 @@ func GenGetSql(table string, cols []string, selector Selector) (string, []interf
 			if i != 0 {
 				buf.WriteString(",")
 			}
-			buf.WriteString(" `" + col + "`")
+			buf.WriteString(" " + d.Quote(col))
 		}
 	}
 
 	// table
-	buf.WriteString(" FROM `" + table + "` WHERE " + query)
+	buf.WriteString(" FROM " + d.Quote(table) + " WHERE " + query)
 
 	return buf.String(), args, nil
 }
 
 func GenUpdateSql(table string, sample interface{}, db Driver, selector Selector) (string, []interface{}, error) {
+	return genUpdateSql(table, sample, db, selector, false)
+}
+
+// genUpdateSql the soft deleted rows are skipped unless unscoped,
+// and the version field is checked and increased if it's set
+func genUpdateSql(table string, sample interface{}, db Driver, selector Selector, unscoped bool) (string, []interface{}, error) {
 	if table == "" {
 		return "", nil, errTableEmpty
 	}
@@ -283,24 +447,26 @@ func GenUpdateSql(table string, sample interface{}, db Driver, selector Selector
 
 	set := []kv{}
 	where := []kv{}
+	lock := []kv{}
+	d := dialectOf(db)
 
 	rv := reflect.Indirect(reflect.ValueOf(sample))
 
-	if err := genUpdateSql(rv, &set, &where, db); err != nil {
+	if err := genUpdateValues(rv, &set, &where, &lock, db); err != nil {
 		return "", nil, err
 	}
 
 	if len(set) == 0 {
-		return "", nil, fmt.Errorf("UPDATE `%s` `SET` is empty", table)
+		return "", nil, fmt.Errorf("UPDATE %s `SET` is empty", d.Quote(table))
 	}
 
-	buf := bytes.NewBufferString("UPDATE `" + table + "` SET")
+	buf := bytes.NewBufferString("UPDATE " + d.Quote(table) + " SET")
 	args := []interface{}{}
 	for i, v := range set {
 		if i != 0 {
 			buf.WriteString(",")
 		}
-		buf.WriteString(" `" + v.k + "` = ?")
+		buf.WriteString(" " + d.Quote(v.k) + " = ?")
 		args = append(args, v.v)
 	}
 
@@ -308,7 +474,7 @@ func GenUpdateSql(table string, sample interface{}, db Driver, selector Selector
 
 	// selector
 	if selector != nil {
-		query, args2 := selector.Sql()
+		query, args2 := selector.DialectSql(d)
 		if query == "" {
 			return "", nil, errSelectorEmpty
 		}
@@ -319,17 +485,32 @@ func GenUpdateSql(table string, sample interface{}, db Driver, selector Selector
 			if i != 0 {
 				buf.WriteString(" AND")
 			}
-			buf.WriteString(" `" + v.k + "` = ?")
+			if in, ok := v.v.(whereIn); ok {
+				buf.WriteString(" " + d.Quote(v.k) + " IN (" + strings.TrimSuffix(strings.Repeat("?, ", len(in)), ", ") + ")")
+				args = append(args, in...)
+				continue
+			}
+			buf.WriteString(" " + d.Quote(v.k) + " = ?")
 			args = append(args, v.v)
 		}
 	} else {
-		return "", nil, fmt.Errorf("UPDATE `%s` `WHERE` is empty", table)
+		return "", nil, fmt.Errorf("UPDATE %s `WHERE` is empty", d.Quote(table))
+	}
+
+	// optimistic locking
+	for _, v := range lock {
+		buf.WriteString(" AND " + d.Quote(v.k) + " = ?")
+		args = append(args, v.v)
+	}
+
+	if f := softDeleteField(sample, db); f != nil && !unscoped {
+		buf.WriteString(" AND " + notDeletedSql(d, f))
 	}
 
 	return buf.String(), args, nil
 }
 
-func genUpdateSql(rv reflect.Value, set, where *[]kv, db Driver) error {
+func genUpdateValues(rv reflect.Value, set, where, lock *[]kv, db Driver) error {
 	fields := cachedTypeFields(rv.Type(), db)
 	curTime := defaultClock.Now()
 	for _, f := range fields.Fields {
@@ -348,11 +529,39 @@ func genUpdateSql(rv reflect.Value, set, where *[]kv, db Driver) error {
 			continue
 		}
 
+		if isZeroSoftDelete(f, fv) {
+			continue
+		}
+
 		if fv.Kind() == reflect.Ptr {
 			fv = fv.Elem()
 		}
 
-		v, err := sqlInterface(fv)
+		if f.Version {
+			version := versionOf(fv)
+			*set = append(*set, kv{f.Name, version + 1})
+			*lock = append(*lock, kv{f.Name, version})
+			continue
+		}
+
+		if f.Where && f.Encrypt {
+			if !f.Deterministic {
+				return fmt.Errorf("the where field %s should be encrypt=deterministic", f.Name)
+			}
+			v, err := f.encodeValue(fv)
+			if err != nil {
+				return err
+			}
+			// the row may be written with any of the keys
+			vs, err := f.ciphertextsOf(keyringOf(db), v)
+			if err != nil {
+				return err
+			}
+			*where = append(*where, kv{f.Name, whereIn(vs)})
+			continue
+		}
+
+		v, err := f.sqlInterface(fv, keyringOf(db))
 		if err != nil {
 			return err
 		}
@@ -366,7 +575,12 @@ func genUpdateSql(rv reflect.Value, set, where *[]kv, db Driver) error {
 	return nil
 }
 
+// GenDeleteSql generate the delete sql with the DefaultDialect
 func GenDeleteSql(table string, selector Selector) (string, []interface{}, error) {
+	return genDeleteSql(DefaultDialect, table, selector)
+}
+
+func genDeleteSql(d Dialect, table string, selector Selector) (string, []interface{}, error) {
 	if table == "" {
 		return "", nil, errTableEmpty
 	}
@@ -374,12 +588,12 @@ func GenDeleteSql(table string, selector Selector) (string, []interface{}, error
 		return "", nil, errSelectorNil
 	}
 
-	query, args := selector.Sql()
+	query, args := selector.DialectSql(d)
 	if query == "" {
 		return "", nil, errSelectorEmpty
 	}
 
-	return fmt.Sprintf("DELETE FROM `%s` WHERE %s", table, query), args, nil
+	return fmt.Sprintf("DELETE FROM %s WHERE %s", d.Quote(table), query), args, nil
 }
 
 func GetFields(sample interface{}, driver Driver) StructFields {
@@ -406,7 +620,7 @@ func IsNil(rv reflect.Value) bool {
 }
 
 // scanInterface input is struct's field
-func scanInterface(rv reflect.Value, tran *[]*transfer) (interface{}, error) {
+func scanInterface(rv reflect.Value, f *StructField, kr Keyring, tran *[]*transfer) (interface{}, error) {
 	rt := rv.Type()
 	ptr := false
 
@@ -417,6 +631,15 @@ func scanInterface(rv reflect.Value, tran *[]*transfer) (interface{}, error) {
 
 	iface := rv.Addr().Interface()
 
+	if f.Codec != nil || f.Encrypt {
+		node := &transfer{dst: iface, ptr: ptr, codec: f.Codec, encrypted: f.Encrypt}
+		if f.Encrypt {
+			node.keyring = kr
+		}
+		*tran = append(*tran, node)
+		return &node.dstProxy, nil
+	}
+
 	switch iface.(type) {
 	case *time.Time:
 		return iface, nil
@@ -442,6 +665,36 @@ func scanInterface(rv reflect.Value, tran *[]*transfer) (interface{}, error) {
 	return iface, nil
 }
 
+// sqlInterface returns the column value of the field, encoded by the codec if it has one,
+// and encrypted with the keyring if it's an encrypt field
+func (p *StructField) sqlInterface(rv reflect.Value, kr Keyring) (interface{}, error) {
+	v, err := p.encodeValue(rv)
+	if err != nil || !p.Encrypt {
+		return v, err
+	}
+
+	return p.encryptValue(kr, v)
+}
+
+// encodeValue returns the value of the field before encrypted
+func (p *StructField) encodeValue(rv reflect.Value) (interface{}, error) {
+	if p.Codec == nil {
+		return sqlInterface(rv)
+	}
+
+	if rv.Kind() == reflect.Ptr {
+		rv = rv.Elem()
+	}
+	return p.Codec.Encode(rv.Interface())
+}
+
+func keyringOf(db Driver) Keyring {
+	if o, ok := db.(interface{ getKeyring() Keyring }); ok {
+		return o.getKeyring()
+	}
+	return nil
+}
+
 // sqlInterface: rv should not be ptr, return interface for use in sql's args
 func sqlInterface(rv reflect.Value) (interface{}, error) {
 	if rv.Kind() == reflect.Ptr {
@@ -485,6 +738,11 @@ func SetClock(clock clock.Clock) {
 	defaultClock = clock
 }
 
+// Clock returns the clock set by SetClock
+func Clock() clock.Clock {
+	return defaultClock
+}
+
 func typeOfArray(in interface{}) string {
 	rt := reflect.TypeOf(in)
 	if rt.Kind() == reflect.Ptr {
@@ -493,6 +751,9 @@ func typeOfArray(in interface{}) string {
 	if k := rt.Kind(); k == reflect.Slice || k == reflect.Array {
 		rt = rt.Elem()
 	}
+	if rt.Kind() == reflect.Ptr {
+		rt = rt.Elem()
+	}
 	return util.SnakeCasedName(rt.Name())
 }
 
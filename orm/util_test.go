@@ -1,10 +1,15 @@
 package orm
 
 import (
+	"reflect"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/yubo/golib/util"
+	"github.com/yubo/golib/util/clock"
+	testingclock "github.com/yubo/golib/util/clock/testing"
 )
 
 func TestGenInsertSql(t *testing.T) {
@@ -82,6 +87,66 @@ func TestGenListSql(t *testing.T) {
 	}
 }
 
+func TestGenCursorSql(t *testing.T) {
+	type user struct {
+		Name string
+		Age  int
+	}
+
+	cases := []struct {
+		db      Driver
+		orderby []string
+		query   string
+		args    []interface{}
+	}{{
+		&mysql{DBOptions: NewDefaultDBOptions()},
+		[]string{"`name` DESC", "age desc"},
+		"SELECT * FROM `user` WHERE (`age` > ?) AND (`name`, `age`) < (?, ?) ORDER BY `name` DESC, `age` DESC LIMIT 0, 3",
+		[]interface{}{"10", "tom", 20},
+	}, {
+		&postgres{DBOptions: NewDefaultDBOptions()},
+		[]string{"name", "age DESC"},
+		`SELECT * FROM "user" WHERE ("age" > ?) AND ("name" > ? OR ("name" = ? AND "age" < ?)) ORDER BY "name", "age" DESC LIMIT 3 OFFSET 0`,
+		[]interface{}{"10", "tom", "tom", 20},
+	}}
+
+	for i, c := range cases {
+		cursor, err := newListCursor(c.orderby, []user{}, "", c.db)
+		require.NoError(t, err, "case-%d", i)
+		token, err := cursor.encode(reflect.ValueOf(user{"tom", 20}))
+		require.NoError(t, err, "case-%d", i)
+
+		var next string
+		o, err := NewOptions(
+			WithTable("user"),
+			WithSelector("age>10"),
+			WithOrderby(c.orderby...),
+			WithLimit(100, 2),
+			WithCursor(token),
+			WithContinue(&next),
+			WithSample(&[]user{}),
+		)
+		require.NoError(t, err, "case-%d", i)
+
+		query, queryCount, args, countArgs, err := o.GenListSql(c.db)
+		require.NoError(t, err, "case-%d", i)
+		assert.Equal(t, c.query, query, "case-%d", i)
+		assert.Equal(t, c.args, args, "case-%d", i)
+		assert.Contains(t, queryCount, "COUNT(*)", "case-%d", i)
+		assert.Equal(t, []interface{}{"10"}, countArgs, "case-%d", i)
+	}
+
+	// the order by is changed
+	db := cases[0].db
+	cursor, _ := newListCursor([]string{"name"}, []user{}, "", db)
+	token, _ := cursor.encode(reflect.ValueOf(user{"tom", 20}))
+	_, err := newListCursor([]string{"name desc"}, []user{}, token, db)
+	assert.Error(t, err)
+
+	_, err = newListCursor([]string{"count(*)"}, []user{}, "", db)
+	assert.Error(t, err)
+}
+
 func TestGenGetSql(t *testing.T) {
 	cases := []struct {
 		table    string
@@ -171,6 +236,68 @@ func TestGenUpdateSql(t *testing.T) {
 	}
 }
 
+func TestGenScopedSql(t *testing.T) {
+	type User struct {
+		Name      *string `sql:"where"`
+		Age       *int
+		Version   *int64 `sql:"version"`
+		DeletedAt int64  `sql:"soft_delete=milli"`
+	}
+
+	fakeClock := testingclock.NewFakeClock(time.Unix(1000, 0))
+	SetClock(fakeClock)
+	defer SetClock(clock.RealClock{})
+
+	db := &nonDriver{}
+	cases := []struct {
+		opts  []QueryOption
+		gen   func(o *queryOptions) (string, []interface{}, error)
+		query string
+		args  []interface{}
+	}{{
+		[]QueryOption{WithSample(&User{Name: util.String("tom"), Age: util.Int(14), Version: util.Int64(2)})},
+		func(o *queryOptions) (string, []interface{}, error) { return o.GenUpdateSql(db) },
+		"UPDATE `user` SET `age` = ?, `version` = ? WHERE `name` = ? AND `version` = ? AND `deleted_at` = 0",
+		[]interface{}{14, int64(3), "tom", int64(2)},
+	}, {
+		[]QueryOption{WithSample(&User{Age: util.Int(14)}), WithSelector("name=tom"), WithUnscoped()},
+		func(o *queryOptions) (string, []interface{}, error) { return o.GenUpdateSql(db) },
+		"UPDATE `user` SET `age` = ? WHERE `name` = ?",
+		[]interface{}{14, "tom"},
+	}, {
+		[]QueryOption{WithSample(&User{}), WithSelector("name=tom")},
+		func(o *queryOptions) (string, []interface{}, error) { return o.GenGetSql(db) },
+		"SELECT * FROM `user` WHERE `name` = ? and `deleted_at` = 0",
+		[]interface{}{"tom"},
+	}, {
+		[]QueryOption{WithSample(&User{}), WithSelector("name=tom")},
+		func(o *queryOptions) (string, []interface{}, error) { return o.GenDeleteSql(db) },
+		"UPDATE `user` SET `deleted_at` = ? WHERE `name` = ? and `deleted_at` = 0",
+		[]interface{}{int64(1000000), "tom"},
+	}, {
+		[]QueryOption{WithSample(&User{}), WithSelector("name=tom"), WithUnscoped()},
+		func(o *queryOptions) (string, []interface{}, error) { return o.GenDeleteSql(db) },
+		"DELETE FROM `user` WHERE `name` = ?",
+		[]interface{}{"tom"},
+	}}
+
+	for i, c := range cases {
+		o, err := NewOptions(c.opts...)
+		require.NoError(t, err, "case-%d", i)
+
+		query, args, err := c.gen(o)
+		require.NoError(t, err, "case-%d", i)
+		assert.Equal(t, c.query, query, "case-%d", i)
+		assert.Equal(t, c.args, args, "case-%d", i)
+	}
+
+	o, _ := NewOptions(WithTable("user"), WithSample(&[]User{}))
+	query, countQuery, _, _, err := o.GenListSql(db)
+	require.NoError(t, err)
+	assert.Equal(t, "SELECT * FROM `user` WHERE `deleted_at` = 0", query)
+	assert.Equal(t, "SELECT COUNT(*) FROM `user` WHERE `deleted_at` = 0", countQuery)
+}
+
 func TestGenDeleteSql(t *testing.T) {
 	cases := []struct {
 		table    string
@@ -201,3 +328,187 @@ func TestGenDeleteSql(t *testing.T) {
 
 	}
 }
+
+func TestGenSqlPostgres(t *testing.T) {
+	type User struct {
+		Name   *string `sql:"where"`
+		Age    *int
+		Passwd *string
+	}
+
+	db := &postgres{DBOptions: NewDefaultDBOptions()}
+	o, _ := NewOptions(
+		WithTable("user"),
+		WithCols("name", "age"),
+		WithSelector("name=tom,age>10"),
+		WithOrderby("name DESC"),
+		WithLimit(20, 10),
+		WithSample(&User{util.String("tom"), util.Int(14), nil}),
+	)
+
+	query, queryCount, args, _, err := o.GenListSql(db)
+	assert.NoError(t, err)
+	assert.Equal(t, `SELECT "name", "age" FROM "user" WHERE "name" = ? and "age" > ? ORDER BY name DESC LIMIT 10 OFFSET 20`, query)
+	assert.Equal(t, `SELECT COUNT(*) FROM "user" WHERE "name" = ? and "age" > ?`, queryCount)
+	assert.Equal(t, []interface{}{"tom", "10"}, args)
+
+	query, args, err = o.GenGetSql(db)
+	assert.NoError(t, err)
+	assert.Equal(t, `SELECT "name", "age" FROM "user" WHERE "name" = ? and "age" > ?`, query)
+	assert.Equal(t, []interface{}{"tom", "10"}, args)
+
+	query, args, err = o.GenInsertSql(db)
+	assert.NoError(t, err)
+	assert.Equal(t, `INSERT INTO "user" ("name", "age") VALUES (?, ?)`, query)
+	assert.Equal(t, []interface{}{"tom", 14}, args)
+
+	query, args, err = GenUpdateSql("user", &User{util.String("tom"), util.Int(14), nil}, db, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, `UPDATE "user" SET "age" = ? WHERE "name" = ?`, query)
+	assert.Equal(t, []interface{}{14, "tom"}, args)
+
+	query, args, err = o.GenDeleteSql(db)
+	assert.NoError(t, err)
+	assert.Equal(t, `DELETE FROM "user" WHERE "name" = ? and "age" > ?`, query)
+	assert.Equal(t, []interface{}{"tom", "10"}, args)
+}
+
+func TestPostgresRebind(t *testing.T) {
+	cases := []struct {
+		query string
+		want  string
+	}{
+		{"SELECT 1", "SELECT 1"},
+		{`SELECT * FROM "user" WHERE "name" = ? and "age" > ?`, `SELECT * FROM "user" WHERE "name" = $1 and "age" > $2`},
+		{`SELECT * FROM "user" WHERE "name" = '?' and "age" in (?,?)`, `SELECT * FROM "user" WHERE "name" = '?' and "age" in ($1,$2)`},
+	}
+
+	d := &postgresDialect{}
+	for i, c := range cases {
+		assert.Equal(t, c.want, d.Rebind(c.query), "case-%d", i)
+	}
+}
+
+func TestGenInsertBatchSql(t *testing.T) {
+	type User struct {
+		ID        *int   `sql:"primary_key,auto_increment"`
+		Name      string `sql:"unique"`
+		Age       *int
+		CreatedAt int64
+		UpdatedAt int64
+	}
+
+	c := &testingclock.FakeClock{}
+	c.SetTime(time.Unix(1000, 0))
+	SetClock(c)
+	defer SetClock(clock.RealClock{})
+
+	users := []User{{Name: "tom", Age: util.Int(14)}, {Name: "bob", Age: util.Int(16)}, {Name: "ann", Age: util.Int(18)}, {Name: "jerry"}}
+
+	cases := []struct {
+		name    string
+		db      Driver
+		opts    []QueryOption
+		queries []string
+		args    [][]interface{}
+	}{{
+		name: "mysql chunk",
+		db:   &nonDriver{},
+		opts: []QueryOption{WithMaxPlaceholders(8)},
+		queries: []string{
+			"INSERT INTO `user` (`name`, `age`, `created_at`, `updated_at`) VALUES (?, ?, ?, ?), (?, ?, ?, ?)",
+			"INSERT INTO `user` (`name`, `age`, `created_at`, `updated_at`) VALUES (?, ?, ?, ?)",
+			// the nil age is omitted to use the column default
+			"INSERT INTO `user` (`name`, `created_at`, `updated_at`) VALUES (?, ?, ?)",
+		},
+		args: [][]interface{}{
+			{"tom", 14, int64(1000), int64(1000), "bob", 16, int64(1000), int64(1000)},
+			{"ann", 18, int64(1000), int64(1000)},
+			{"jerry", int64(1000), int64(1000)},
+		},
+	}, {
+		name: "mysql upsert",
+		db:   &nonDriver{},
+		opts: []QueryOption{WithUpsert()},
+		queries: []string{
+			"INSERT INTO `user` (`name`, `age`, `created_at`, `updated_at`) VALUES (?, ?, ?, ?), (?, ?, ?, ?), (?, ?, ?, ?)" +
+				" ON DUPLICATE KEY UPDATE `name` = VALUES(`name`), `age` = VALUES(`age`), `updated_at` = VALUES(`updated_at`)",
+			"INSERT INTO `user` (`name`, `created_at`, `updated_at`) VALUES (?, ?, ?)" +
+				" ON DUPLICATE KEY UPDATE `name` = VALUES(`name`), `updated_at` = VALUES(`updated_at`)",
+		},
+	}, {
+		name: "sqlite upsert",
+		db:   &sqlite{},
+		opts: []QueryOption{WithUpsert("age"), WithConflictKeys("name")},
+		queries: []string{
+			"INSERT INTO `user` (`name`, `age`, `created_at`, `updated_at`) VALUES (?, ?, ?, ?), (?, ?, ?, ?), (?, ?, ?, ?)" +
+				" ON CONFLICT (`name`) DO UPDATE SET `age` = excluded.`age`",
+			"INSERT INTO `user` (`name`, `created_at`, `updated_at`) VALUES (?, ?, ?)" +
+				" ON CONFLICT (`name`) DO UPDATE SET `age` = excluded.`age`",
+		},
+	}, {
+		name: "postgres upsert",
+		db:   &postgres{DBOptions: NewDefaultDBOptions()},
+		opts: []QueryOption{WithUpsert(), WithConflictKeys("name")},
+		queries: []string{
+			`INSERT INTO "user" ("name", "age", "created_at", "updated_at") VALUES (?, ?, ?, ?), (?, ?, ?, ?), (?, ?, ?, ?)` +
+				` ON CONFLICT ("name") DO UPDATE SET "age" = excluded."age", "updated_at" = excluded."updated_at"`,
+			`INSERT INTO "user" ("name", "created_at", "updated_at") VALUES (?, ?, ?)` +
+				` ON CONFLICT ("name") DO UPDATE SET "updated_at" = excluded."updated_at"`,
+		},
+	}}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			o, err := NewOptions(append(c.opts, WithTable("user"), WithSample(users))...)
+			require.NoError(t, err)
+
+			queries, args, err := o.GenInsertBatchSql(c.db)
+			require.NoError(t, err)
+			assert.Equal(t, c.queries, queries)
+			if c.args != nil {
+				assert.Equal(t, c.args, args)
+			}
+		})
+	}
+}
+
+func TestGenUpsertSql(t *testing.T) {
+	type User struct {
+		ID   int `sql:"primary_key"`
+		Name string
+	}
+
+	o, err := NewOptions(WithTable("user"), WithSample(&User{1, "tom"}), WithUpsert())
+	require.NoError(t, err)
+
+	query, args, err := o.GenInsertSql(&sqlite{})
+	require.NoError(t, err)
+	assert.Equal(t, "INSERT INTO `user` (`id`, `name`) VALUES (?, ?) ON CONFLICT (`id`) DO UPDATE SET `name` = excluded.`name`", query)
+	assert.Equal(t, []interface{}{1, "tom"}, args)
+}
+
+func TestSplitStatements(t *testing.T) {
+	cases := []struct {
+		in   string
+		want []string
+	}{
+		{"", nil},
+		{"-- comment\n\n", nil},
+		{"CREATE TABLE t (\n  id int\n);\nDROP TABLE t;", []string{"CREATE TABLE t ( id int );", "DROP TABLE t;"}},
+		{"SELECT 1; SELECT 2;", []string{"SELECT 1;", "SELECT 2;"}},
+		{"WITH a AS (SELECT 1) SELECT * FROM a;\nGRANT ALL ON t TO u", []string{"WITH a AS (SELECT 1) SELECT * FROM a;", "GRANT ALL ON t TO u"}},
+		{"INSERT INTO t VALUES ('a;b', \"c;\", 'it''s;', 'x\\';');", []string{"INSERT INTO t VALUES ('a;b', \"c;\", 'it''s;', 'x\\';');"}},
+		{"COMMENT ON TABLE t IS 'a\n-- b;'\n;", []string{"COMMENT ON TABLE t IS 'a\n-- b;' ;"}},
+		{";;", nil},
+		// the trailing comment
+		{"CREATE TABLE t (\n id int, -- the id\n name text\n);", []string{"CREATE TABLE t ( id int, name text );"}},
+		// the quote in the comment
+		{"DROP TABLE t; -- don't\nCREATE TABLE u (id int);\nCREATE TABLE v (id int);", []string{"DROP TABLE t;", "CREATE TABLE u (id int);", "CREATE TABLE v (id int);"}},
+		{"/* it's\n a; comment */ SELECT 1 /**/;\nSELECT '/* -- ';", []string{"SELECT 1 ;", "SELECT '/* -- ';"}},
+	}
+
+	for i, c := range cases {
+		assert.Equal(t, c.want, SplitStatements([]byte(c.in)), "case-%d", i)
+	}
+}
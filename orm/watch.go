@@ -0,0 +1,252 @@
+package orm
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/yubo/golib/watch"
+	"k8s.io/klog/v2"
+)
+
+// Change is the object of the watch.Event emitted by Insert, Update and Delete,
+// the event type is watch.Added, watch.Modified or watch.Deleted
+type Change struct {
+	// Table the table of the statement
+	Table string
+	// Object the sample of Insert/Update/Delete, each element of InsertBatch has its own event
+	Object interface{}
+	// Selector the selector of Update/Delete, it may be nil
+	Selector Selector
+}
+
+// changeFeed holds a broadcaster for each watched table
+type changeFeed struct {
+	sync.RWMutex
+	tables  map[string]*watch.Broadcaster
+	stopped bool
+}
+
+func newChangeFeed() *changeFeed {
+	return &changeFeed{tables: map[string]*watch.Broadcaster{}}
+}
+
+func (p *changeFeed) watch(table string) (watch.Interface, error) {
+	p.Lock()
+	defer p.Unlock()
+
+	if p.stopped {
+		return watch.NewEmptyWatch(), nil
+	}
+
+	b, ok := p.tables[table]
+	if !ok {
+		// the writes should not be blocked by the slow watchers
+		b = watch.NewBroadcaster(int(watch.DefaultChanSize), watch.DropIfChannelFull)
+		p.tables[table] = b
+	}
+
+	return b.Watch()
+}
+
+func (p *changeFeed) action(typ watch.EventType, c *Change) {
+	if p == nil {
+		return
+	}
+
+	p.RLock()
+	defer p.RUnlock()
+
+	b, ok := p.tables[c.Table]
+	if !ok {
+		return
+	}
+
+	if err := b.Action(typ, c); err != nil {
+		klog.V(3).InfoS("watch action", "table", c.Table, "type", typ, "err", err)
+	}
+}
+
+func (p *changeFeed) shutdown() {
+	if p == nil {
+		return
+	}
+
+	p.Lock()
+	defer p.Unlock()
+
+	if p.stopped {
+		return
+	}
+	p.stopped = true
+
+	for _, b := range p.tables {
+		b.Shutdown()
+	}
+}
+
+// pendingChanges buffers the events of a Tx until it's committed, see WithWatchAfterCommit,
+// the methods are safe on the nil pendingChanges
+type pendingChanges struct {
+	sync.Mutex
+	events []watch.Event
+	tables map[string]bool // the tables written in the Tx
+}
+
+func (p *pendingChanges) add(typ watch.EventType, c *Change) {
+	p.Lock()
+	defer p.Unlock()
+	p.events = append(p.events, watch.Event{Type: typ, Object: c})
+}
+
+// written records the table, the query cache of it is invalidated again after the Tx is committed
+func (p *pendingChanges) written(table string) {
+	if p == nil {
+		return
+	}
+
+	p.Lock()
+	defer p.Unlock()
+	if p.tables == nil {
+		p.tables = map[string]bool{}
+	}
+	p.tables[table] = true
+}
+
+// mark returns the position of the savepoint
+func (p *pendingChanges) mark() int {
+	if p == nil {
+		return 0
+	}
+
+	p.Lock()
+	defer p.Unlock()
+	return len(p.events)
+}
+
+// truncate drops the events after the savepoint
+func (p *pendingChanges) truncate(n int) {
+	if p == nil {
+		return
+	}
+
+	p.Lock()
+	defer p.Unlock()
+	if n < len(p.events) {
+		p.events = p.events[:n]
+	}
+}
+
+func (p *pendingChanges) flush(feed *changeFeed, cache *queryCache) {
+	if p == nil {
+		return
+	}
+
+	p.Lock()
+	events, tables := p.events, p.tables
+	p.events, p.tables = nil, nil
+	p.Unlock()
+
+	for table := range tables {
+		cache.invalidate(table)
+	}
+
+	for _, e := range events {
+		feed.action(e.Type, e.Object.(*Change))
+	}
+}
+
+// Watch returns the events of the successful Insert/Update/Delete of the table,
+// the Object of the event is *Change, the watch is stopped when the ctx is done.
+// The events are dropped if the watcher is too slow.
+func (p *ormDB) Watch(ctx context.Context, table string) (watch.Interface, error) {
+	if p.feed == nil {
+		return nil, fmt.Errorf("the change feed is not available")
+	}
+
+	w, err := p.feed.watch(table)
+	if err != nil {
+		return nil, err
+	}
+
+	if ctx.Done() != nil {
+		w = newContextWatcher(ctx, w)
+	}
+
+	return w, nil
+}
+
+// contextWatcher stops the watcher when the ctx is done
+type contextWatcher struct {
+	watch.Interface
+	stopCh chan struct{}
+	once   sync.Once
+}
+
+func newContextWatcher(ctx context.Context, w watch.Interface) watch.Interface {
+	cw := &contextWatcher{Interface: w, stopCh: make(chan struct{})}
+	go func() {
+		select {
+		case <-ctx.Done():
+			cw.Stop()
+		case <-cw.stopCh:
+		}
+	}()
+	return cw
+}
+
+func (p *contextWatcher) Stop() {
+	p.once.Do(func() {
+		close(p.stopCh)
+		p.Interface.Stop()
+	})
+}
+
+// emit invalidates the query cache of the table, and sends the event of the write,
+// the event is buffered in the Tx if WithWatchAfterCommit is set
+func (p *baseInterface) emit(ctx context.Context, typ watch.EventType, table string, object interface{}, selector Selector) {
+	if p.DBOptions == nil {
+		return
+	}
+
+	pending := p.pendingFrom(ctx)
+
+	// the cache may be filled with the old rows by the other connections before the Tx is committed
+	p.cache.invalidate(table)
+	pending.written(table)
+
+	if p.feed == nil {
+		return
+	}
+
+	c := &Change{Table: table, Object: object, Selector: selector}
+	if p.watchAfterCommit && pending != nil {
+		pending.add(typ, c)
+		return
+	}
+
+	p.feed.action(typ, c)
+}
+
+// emitBatch sends an Added event for each element of the samples of InsertBatch
+func (p *baseInterface) emitBatch(ctx context.Context, table string, samples interface{}) {
+	rv := reflect.Indirect(reflect.ValueOf(samples))
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return
+	}
+
+	for i := 0; i < rv.Len(); i++ {
+		p.emit(ctx, watch.Added, table, rv.Index(i).Interface(), nil)
+	}
+}
+
+// pendingFrom returns the pending changes of the Tx which executes the write
+func (p *baseInterface) pendingFrom(ctx context.Context) *pendingChanges {
+	if i, ok := DBFrom(ctx); ok {
+		if tx, ok := i.(*ormTx); ok {
+			return tx.pending
+		}
+	}
+	return p.pending
+}
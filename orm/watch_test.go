@@ -0,0 +1,204 @@
+package orm
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yubo/golib/watch"
+)
+
+type testWatchEvent struct {
+	Type  watch.EventType
+	Table string
+	ID    int
+}
+
+// receiveEvents returns the events until no event is received in a short time
+func receiveEvents(w watch.Interface) (ret []testWatchEvent) {
+	for {
+		select {
+		case e, ok := <-w.ResultChan():
+			if !ok {
+				return
+			}
+			c := e.Object.(*Change)
+			ev := testWatchEvent{Type: e.Type, Table: c.Table}
+			switch v := c.Object.(type) {
+			case *testWatch:
+				ev.ID = v.ID
+			case testWatch:
+				ev.ID = v.ID
+			}
+			ret = append(ret, ev)
+		case <-time.After(50 * time.Millisecond):
+			return
+		}
+	}
+}
+
+type testWatch struct {
+	ID    int `sql:"primary_key"`
+	Value string
+}
+
+func (testWatch) Name() string { return "test" }
+
+func openWatchDB(t *testing.T, opts ...DBOption) DB {
+	if !testAvailable {
+		t.Skipf("SQL server not running on %s:%s", testDriver, testDsn)
+	}
+
+	db, err := Open(testDriver, testDsn, opts...)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	db.Exec(ctx, "DROP TABLE IF EXISTS test")
+	require.NoError(t, db.AutoMigrate(ctx, &testWatch{}))
+
+	t.Cleanup(func() {
+		db.Exec(ctx, "DROP TABLE IF EXISTS test")
+		db.Close()
+	})
+
+	return db
+}
+
+func TestWatch(t *testing.T) {
+	db := openWatchDB(t)
+	ctx := context.Background()
+
+	w, err := db.Watch(ctx, "test")
+	require.NoError(t, err)
+	defer w.Stop()
+
+	other, err := db.Watch(ctx, "other")
+	require.NoError(t, err)
+	defer other.Stop()
+
+	require.NoError(t, db.Insert(ctx, &testWatch{ID: 1, Value: "a"}))
+	_, err = db.InsertLastId(ctx, &testWatch{ID: 2, Value: "b"})
+	require.NoError(t, err)
+	require.NoError(t, db.InsertBatch(ctx, []testWatch{{ID: 3}, {ID: 4}}, WithTable("test")))
+	require.NoError(t, db.Update(ctx, &testWatch{ID: 1, Value: "c"}, WithSelector("id=1")))
+	require.NoError(t, db.Delete(ctx, &testWatch{}, WithSelector("id=2")))
+
+	// the failed writes have no event
+	assert.Error(t, db.Insert(ctx, &testWatch{ID: 1}))
+	assert.Error(t, db.Delete(ctx, &testWatch{}, WithSelector("id=100")))
+
+	assert.Equal(t, []testWatchEvent{
+		{watch.Added, "test", 1},
+		{watch.Added, "test", 2},
+		{watch.Added, "test", 3},
+		{watch.Added, "test", 4},
+		{watch.Modified, "test", 1},
+		{watch.Deleted, "test", 0},
+	}, receiveEvents(w))
+	assert.Empty(t, receiveEvents(other))
+
+	// the selector of the event
+	require.NoError(t, db.Delete(ctx, &testWatch{}, WithSelector("id=3")))
+	e := <-w.ResultChan()
+	assert.Equal(t, "id=3", e.Object.(*Change).Selector.String())
+}
+
+func TestWatchContext(t *testing.T) {
+	db := openWatchDB(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	w, err := db.Watch(ctx, "test")
+	require.NoError(t, err)
+
+	cancel()
+	select {
+	case _, ok := <-w.ResultChan():
+		assert.False(t, ok, "the result chan should be closed")
+	case <-time.After(time.Second):
+		t.Fatal("the watcher is not stopped")
+	}
+
+	// closed by db.Close()
+	w, err = db.Watch(context.Background(), "test")
+	require.NoError(t, err)
+	db.Close()
+	_, ok := <-w.ResultChan()
+	assert.False(t, ok)
+}
+
+func TestWatchAfterCommit(t *testing.T) {
+	cases := []struct {
+		afterCommit bool
+		fn          func(ctx context.Context, db DB) error
+		want        []int
+	}{
+		// the events are sent immediately without WithWatchAfterCommit
+		{false, func(ctx context.Context, db DB) error {
+			tx, err := db.Begin()
+			if err != nil {
+				return err
+			}
+			tx.Insert(ctx, &testWatch{ID: 1})
+			return tx.Rollback()
+		}, []int{1}},
+		// commit
+		{true, func(ctx context.Context, db DB) error {
+			tx, err := db.Begin()
+			if err != nil {
+				return err
+			}
+			tx.Insert(ctx, &testWatch{ID: 1})
+			tx.Insert(ctx, &testWatch{ID: 2})
+			return tx.Commit()
+		}, []int{1, 2}},
+		// rollback
+		{true, func(ctx context.Context, db DB) error {
+			tx, err := db.Begin()
+			if err != nil {
+				return err
+			}
+			tx.Insert(ctx, &testWatch{ID: 1})
+			return tx.Rollback()
+		}, nil},
+		// the db in the ctx of Transaction, the savepoint is rolled back
+		{true, func(ctx context.Context, db DB) error {
+			return db.Transaction(ctx, func(ctx context.Context) error {
+				if err := db.Insert(ctx, &testWatch{ID: 1}); err != nil {
+					return err
+				}
+				db.Transaction(ctx, func(ctx context.Context) error {
+					db.Insert(ctx, &testWatch{ID: 2})
+					return fmt.Errorf("rollback the savepoint")
+				})
+				return db.Insert(ctx, &testWatch{ID: 3})
+			})
+		}, []int{1, 3}},
+	}
+
+	for i, c := range cases {
+		opts := []DBOption{}
+		if c.afterCommit {
+			opts = append(opts, WithWatchAfterCommit())
+		}
+		db := openWatchDB(t, opts...)
+		ctx := context.Background()
+
+		w, err := db.Watch(ctx, "test")
+		require.NoError(t, err, fmt.Sprintf("case-%d", i))
+
+		require.NoError(t, c.fn(ctx, db), fmt.Sprintf("case-%d", i))
+
+		var got []int
+		for _, e := range receiveEvents(w) {
+			got = append(got, e.ID)
+		}
+		assert.Equal(t, c.want, got, fmt.Sprintf("case-%d", i))
+
+		w.Stop()
+		db.Exec(ctx, "DROP TABLE IF EXISTS test")
+		db.Close()
+	}
+}
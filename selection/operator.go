@@ -34,4 +34,9 @@ const (
 	NotContains  Operator = "!~"
 	HasPrefix    Operator = "=~"
 	HasSuffix    Operator = "~="
+
+	GreaterThanOrEquals Operator = "gte"
+	LessThanOrEquals    Operator = "lte"
+	Between             Operator = "between"
+	Or                  Operator = "or"
 )